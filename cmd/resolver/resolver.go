@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"log"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"z42-core/internal/resolver"
 	"z42-core/internal/server"
 	"z42-core/internal/storage"
+	"z42-core/pkg/hiredis"
 	"z42-core/pkg/ratelimit"
 	"github.com/json-iterator/go"
 	"github.com/miekg/dns"
@@ -20,7 +22,7 @@ import (
 )
 
 var (
-	servers           []*dns.Server
+	servers           []server.Server
 	redisDataHandler  *storage.DataHandler
 	redisStatHandler  *storage.StatHandler
 	dnsRequestHandler *resolver.DnsRequestHandler
@@ -59,6 +61,11 @@ func main() {
 
 	Start()
 
+	// counters are served with pprof under /debug/vars
+	expvar.Publish("response_ratelimit", expvar.Func(func() any {
+		return dnsRequestHandler.ResponseRateLimitStats()
+	}))
+
 	// TODO: this should be part of a general api
 	go func() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
@@ -122,10 +129,12 @@ func Start() {
 	redisStatHandler = storage.NewStatHandler(&cfg.RedisStat)
 
 	eventLogger.Info("starting handler...")
-	dnsRequestHandler = resolver.NewHandler(&cfg.Handler, redisDataHandler, accessLogger)
+	dnsRequestHandler = resolver.NewHandler(&cfg.Handler, redisDataHandler, redisStatHandler, accessLogger)
+	server.SetTsigProvider(servers, dnsRequestHandler.TsigProvider())
 	eventLogger.Info("handler started")
 
 	rateLimiter = ratelimit.NewRateLimiter(&cfg.RateLimit)
+	rateLimiter.WatchLists(hiredis.NewRedis(&cfg.RedisData.Redis))
 
 	dns.HandleFunc(".", handleRequest)
 
@@ -146,6 +155,7 @@ func Stop() {
 		_ = servers[i].Shutdown()
 	}
 	dnsRequestHandler.ShutDown()
+	rateLimiter.ShutDown()
 	redisDataHandler.ShutDown()
 	redisStatHandler.ShutDown()
 	_ = accessLogger.Sync()
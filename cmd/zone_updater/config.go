@@ -6,13 +6,21 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"z42-core/internal/logger"
+	"z42-core/internal/notify"
+	"z42-core/internal/rollover"
+	"z42-core/internal/secondary"
 	"z42-core/internal/storage"
+	"z42-core/internal/upstream"
 )
 
 type Config struct {
 	EventLog           logger.Config             `json:"event_log"`
 	DBConnectionString string                    `json:"db_connection_string"`
 	RedisData          storage.DataHandlerConfig `json:"redis_data"`
+	Secondary          secondary.Config          `json:"secondary"`
+	Notify             notify.Config             `json:"notify"`
+	Rollover           rollover.Config           `json:"rollover"`
+	Upstream           []upstream.Config         `json:"upstream"`
 }
 
 func DefaultConfig() Config {
@@ -20,6 +28,10 @@ func DefaultConfig() Config {
 		EventLog:           logger.DefaultConfig(),
 		DBConnectionString: "root:root@tcp(127.0.0.1:3306)/z42",
 		RedisData:          storage.DefaultDataHandlerConfig(),
+		Secondary:          secondary.DefaultConfig(),
+		Notify:             notify.DefaultConfig(),
+		Rollover:           rollover.DefaultConfig(),
+		Upstream:           []upstream.Config{upstream.DefaultConfig()},
 	}
 }
 
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"z42-core/internal/api/database"
 	"z42-core/internal/logger"
+	"z42-core/internal/notify"
+	"z42-core/internal/rollover"
+	"z42-core/internal/secondary"
 	"z42-core/internal/storage"
+	"z42-core/internal/upstream"
 	"go.uber.org/zap"
 	"time"
 )
@@ -31,6 +35,11 @@ func main() {
 	}
 
 	dh := storage.NewDataHandler(&config.RedisData)
+	sec := secondary.NewSecondary(&config.Secondary, dh)
+	sec.Start()
+	roll := rollover.NewRollover(&config.Rollover, dh, upstream.NewUpstream(config.Upstream))
+	roll.Start()
+	notifier := notify.NewNotifier(&config.Notify, dh)
 
 	for {
 		revision, err := dh.GetRevision()
@@ -50,6 +59,7 @@ func main() {
 			if err := dh.ApplyEvent(event); err != nil {
 				zap.L().Fatal("apply event failed", zap.Error(err))
 			}
+			notifier.EventApplied(event)
 		}
 
 		time.Sleep(time.Second)
@@ -551,6 +551,127 @@ func (db *DataBase) DeleteRecordSet(userId ObjectId, r RecordSetDelete) error {
 	return parseError(err)
 }
 
+// ApplyRecordSetChanges replaces rrsets of a zone in a single transaction, missing locations are added
+// and changes with empty values delete their rrset. no change is applied if any of them fails
+func (db *DataBase) ApplyRecordSetChanges(userId ObjectId, zoneName string, changes []RecordSetChange) error {
+	zoneId, err := db.getZoneId(zoneName)
+	if err != nil {
+		return parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return ErrUnauthorized
+	}
+	err = db.withTransaction(func(t *sql.Tx) error {
+		for _, change := range changes {
+			if err := applyRecordSetChange(t, zoneId, zoneName, change); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return parseError(err)
+}
+
+func (db *DataBase) AddTSIGKey(userId ObjectId, k NewTSIGKey) error {
+	zoneId, err := db.getZoneId(k.ZoneName)
+	if err != nil {
+		return parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return ErrUnauthorized
+	}
+	err = db.withTransaction(func(t *sql.Tx) error {
+		if err := addTSIGKey(t, userId, zoneId, k); err != nil {
+			return err
+		}
+		if _, err := addEvent(t, zoneId, AddTSIGKey, k); err != nil {
+			return err
+		}
+		return nil
+	})
+	return parseError(err)
+}
+
+func (db *DataBase) GetTSIGKeys(userId ObjectId, zoneName string) ([]TSIGKey, error) {
+	zoneId, err := db.getZoneId(zoneName)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return nil, ErrUnauthorized
+	}
+	res, err := db.getTSIGKeys(zoneId)
+	return res, parseError(err)
+}
+
+func (db *DataBase) GetTSIGKey(userId ObjectId, zoneName string, name string) (TSIGKey, error) {
+	zoneId, err := db.getZoneId(zoneName)
+	if err != nil {
+		return TSIGKey{}, parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return TSIGKey{}, ErrUnauthorized
+	}
+	res, err := db.getTSIGKey(zoneId, name)
+	return res, parseError(err)
+}
+
+// GetTSIGKeyUser returns the user that owns an enabled tsig key, updates signed with this key are applied on behalf of this user
+func (db *DataBase) GetTSIGKeyUser(zoneName string, name string) (ObjectId, error) {
+	zoneId, err := db.getZoneId(zoneName)
+	if err != nil {
+		return EmptyObjectId, parseError(err)
+	}
+	userId, err := db.getTSIGKeyUser(zoneId, name)
+	return userId, parseError(err)
+}
+
+func (db *DataBase) UpdateTSIGKey(userId ObjectId, k TSIGKeyUpdate) error {
+	zoneId, err := db.getZoneId(k.ZoneName)
+	if err != nil {
+		return parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return ErrUnauthorized
+	}
+	if _, err := db.getTSIGKey(zoneId, k.Name); err != nil {
+		return parseError(err)
+	}
+	err = db.withTransaction(func(t *sql.Tx) error {
+		if err := updateTSIGKey(t, zoneId, k); err != nil {
+			return err
+		}
+		if _, err := addEvent(t, zoneId, UpdateTSIGKey, k); err != nil {
+			return err
+		}
+		return nil
+	})
+	return parseError(err)
+}
+
+func (db *DataBase) DeleteTSIGKey(userId ObjectId, k TSIGKeyDelete) error {
+	zoneId, err := db.getZoneId(k.ZoneName)
+	if err != nil {
+		return parseError(err)
+	}
+	if !db.isAuthorized(userId, zoneId) {
+		return ErrUnauthorized
+	}
+	if _, err := db.getTSIGKey(zoneId, k.Name); err != nil {
+		return parseError(err)
+	}
+	err = db.withTransaction(func(t *sql.Tx) error {
+		if err := deleteTSIGKey(t, zoneId, k.Name); err != nil {
+			return err
+		}
+		if _, err := addEvent(t, zoneId, DeleteTSIGKey, k); err != nil {
+			return err
+		}
+		return nil
+	})
+	return parseError(err)
+}
+
 func (db *DataBase) GetVerification(userId ObjectId, verificationType VerificationType) (string, error) {
 	code, err := db.getVerification(userId, verificationType)
 	if err != nil {
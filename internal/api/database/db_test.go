@@ -835,6 +835,65 @@ func TestDeleteRecordSet(t *testing.T) {
 	Expect(err).To(Equal(ErrNotFound))
 }
 
+func TestApplyRecordSetChanges(t *testing.T) {
+	RegisterTestingT(t)
+	err := db.Clear(true)
+	Expect(err).To(BeNil())
+	user1Id, _, err := db.AddUser(NewUser{Email: "dbUser1", Password: "dbUser1", Status: UserStatusActive})
+	Expect(err).To(BeNil())
+	zone1Name := "example.com."
+	_, err = db.AddZone(user1Id, NewZone{Name: zone1Name, Dnssec: false, CNameFlattening: false, Enabled: true, SOA: soa, NS: ns})
+	Expect(err).To(BeNil())
+	_, err = db.AddLocation(user1Id, NewLocation{ZoneName: zone1Name, Location: "www", Enabled: true})
+	Expect(err).To(BeNil())
+	r1 := &types.IP_RRSet{
+		GenericRRSet: types.GenericRRSet{TtlValue: 300},
+		Data:         []types.IP_RR{{Ip: net.ParseIP("1.2.3.4")}},
+	}
+	r1Id, err := db.AddRecordSet(user1Id, NewRecordSet{ZoneName: zone1Name, Location: "www", Type: "a", Value: r1, Enabled: true})
+	Expect(err).To(BeNil())
+	r2 := &types.IP_RRSet{
+		GenericRRSet: types.GenericRRSet{TtlValue: 400},
+		Data:         []types.IP_RR{{Ip: net.ParseIP("2.3.4.5")}},
+	}
+
+	// failed change rolls back the others
+	err = db.ApplyRecordSetChanges(user1Id, zone1Name, []RecordSetChange{
+		{Location: "www", Type: "a", Value: r2},
+		{Location: "new", Type: "a", Value: r2},
+		{Location: "www", Type: "invalid-type", Value: r2},
+	})
+	Expect(err).NotTo(BeNil())
+	r, err := db.GetRecordSet(user1Id, zone1Name, "www", "a")
+	Expect(err).To(BeNil())
+	Expect(r.Value).To(Equal(r1))
+	_, err = db.GetLocation(user1Id, zone1Name, "new")
+	Expect(err).To(Equal(ErrNotFound))
+
+	err = db.ApplyRecordSetChanges(user1Id, zone1Name, []RecordSetChange{
+		{Location: "www", Type: "a", Value: r2},
+		{Location: "new", Type: "a", Value: r1},
+		{Location: "www", Type: "aaaa"},
+	})
+	Expect(err).To(BeNil())
+	r, err = db.GetRecordSet(user1Id, zone1Name, "www", "a")
+	Expect(err).To(BeNil())
+	Expect(r).To(Equal(RecordSet{Id: r1Id, Type: "a", Value: r2, Enabled: true}))
+	r, err = db.GetRecordSet(user1Id, zone1Name, "new", "a")
+	Expect(err).To(BeNil())
+	Expect(r.Value).To(Equal(r1))
+
+	err = db.ApplyRecordSetChanges(user1Id, zone1Name, []RecordSetChange{{Location: "www", Type: "a"}})
+	Expect(err).To(BeNil())
+	exists, err := db.resourceExists(r1Id)
+	Expect(err).To(BeNil())
+	Expect(exists).To(BeFalse())
+
+	// non-existing zone
+	err = db.ApplyRecordSetChanges(user1Id, "zone2.com.", []RecordSetChange{{Location: "www", Type: "a", Value: r1}})
+	Expect(err).To(Equal(ErrNotFound))
+}
+
 func TestCascadeDelete(t *testing.T) {
 	RegisterTestingT(t)
 	err := db.Clear(true)
@@ -938,7 +997,7 @@ func TestEvent(t *testing.T) {
 			Revision: 3,
 			ZoneId:   string(zoneId),
 			Type:     AddRecord,
-			Value:    `{"type": "a", "value": {"ttl": 300, "filter": {}, "records": [{"ip": "1.2.3.4"}], "health_check": {}}, "enabled": true, "location": "www", "zone_name": "example.com."}`,
+			Value:    `{"type": "a", "value": {"ttl": 300, "filter": {}, "records": [{"ip": "1.2.3.4"}], "failover": {}, "health_check": {}}, "enabled": true, "location": "www", "zone_name": "example.com."}`,
 		},
 	}))
 }
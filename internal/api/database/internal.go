@@ -92,7 +92,35 @@ func deleteResources(t *sql.Tx) error {
 }
 
 func addZone(t *sql.Tx, resourceId ObjectId, z NewZone) error {
-	if _, err := t.Exec("INSERT INTO Zone(Resource_Id, Name, CNameFlattening, Dnssec, Enabled) VALUES (?, ?, ?, ?, ?)", resourceId, z.Name, z.CNameFlattening, z.Dnssec, z.Enabled); err != nil {
+	allowTransfer, err := jsoniter.Marshal(z.AllowTransfer)
+	if err != nil {
+		return err
+	}
+	primaries, err := jsoniter.Marshal(z.Primaries)
+	if err != nil {
+		return err
+	}
+	alsoNotify, err := jsoniter.Marshal(z.AlsoNotify)
+	if err != nil {
+		return err
+	}
+	nsec3, err := jsoniter.Marshal(z.NSEC3)
+	if err != nil {
+		return err
+	}
+	keyAlgorithm, err := jsoniter.Marshal(z.KeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	signature, err := jsoniter.Marshal(z.Signature)
+	if err != nil {
+		return err
+	}
+	views, err := jsoniter.Marshal(z.Views)
+	if err != nil {
+		return err
+	}
+	if _, err := t.Exec("INSERT INTO Zone(Resource_Id, Name, CNameFlattening, Dnssec, Enabled, AllowTransfer, Primaries, AlsoNotify, NSEC3, KeyAlgorithm, Signature, IgnoreClientSubnet, Views) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", resourceId, z.Name, z.CNameFlattening, z.Dnssec, z.Enabled, allowTransfer, primaries, alsoNotify, nsec3, keyAlgorithm, signature, z.IgnoreClientSubnet, views); err != nil {
 		return err
 	}
 	return nil
@@ -113,7 +141,35 @@ func deleteUserZone(t *sql.Tx, userId ObjectId, zoneId ObjectId) error {
 }
 
 func updateZone(t *sql.Tx, zoneId ObjectId, z ZoneUpdate) error {
-	_, err := t.Exec("UPDATE Zone SET Name = ?, Dnssec = ?, CNameFlattening = ?, Enabled = ? WHERE Resource_Id = ?", z.Name, z.Dnssec, z.CNameFlattening, z.Enabled, zoneId)
+	allowTransfer, err := jsoniter.Marshal(z.AllowTransfer)
+	if err != nil {
+		return err
+	}
+	primaries, err := jsoniter.Marshal(z.Primaries)
+	if err != nil {
+		return err
+	}
+	alsoNotify, err := jsoniter.Marshal(z.AlsoNotify)
+	if err != nil {
+		return err
+	}
+	nsec3, err := jsoniter.Marshal(z.NSEC3)
+	if err != nil {
+		return err
+	}
+	keyAlgorithm, err := jsoniter.Marshal(z.KeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	signature, err := jsoniter.Marshal(z.Signature)
+	if err != nil {
+		return err
+	}
+	views, err := jsoniter.Marshal(z.Views)
+	if err != nil {
+		return err
+	}
+	_, err = t.Exec("UPDATE Zone SET Name = ?, Dnssec = ?, CNameFlattening = ?, Enabled = ?, AllowTransfer = ?, Primaries = ?, AlsoNotify = ?, NSEC3 = ?, CDSDelete = ?, KeyAlgorithm = ?, Signature = ?, IgnoreClientSubnet = ?, Views = ? WHERE Resource_Id = ?", z.Name, z.Dnssec, z.CNameFlattening, z.Enabled, allowTransfer, primaries, alsoNotify, nsec3, z.CDSDelete, keyAlgorithm, signature, z.IgnoreClientSubnet, views, zoneId)
 	return err
 }
 
@@ -179,6 +235,72 @@ func deleteRecordSet(t *sql.Tx, recordId ObjectId) error {
 	return err
 }
 
+func findLocationId(t *sql.Tx, zoneId ObjectId, location string) (ObjectId, error) {
+	var locationId ObjectId
+	err := t.QueryRow("SELECT Resource_Id FROM Location WHERE Zone_Id = ? AND Name = ?", zoneId, location).Scan(&locationId)
+	return locationId, err
+}
+
+func findRecordId(t *sql.Tx, locationId ObjectId, recordType string) (ObjectId, error) {
+	var recordId ObjectId
+	err := t.QueryRow("SELECT Resource_Id FROM RecordSet WHERE Location_Id = ? AND Type = ?", locationId, recordType).Scan(&recordId)
+	return recordId, err
+}
+
+func applyRecordSetChange(t *sql.Tx, zoneId ObjectId, zoneName string, c RecordSetChange) error {
+	locationId, err := findLocationId(t, zoneId, c.Location)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	locationExists := err == nil
+	recordId := EmptyObjectId
+	if locationExists {
+		if recordId, err = findRecordId(t, locationId, c.Type); err == sql.ErrNoRows {
+			recordId = EmptyObjectId
+		} else if err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.Value == nil || c.Value.Empty():
+		if recordId == EmptyObjectId {
+			return nil
+		}
+		if err := deleteRecordSet(t, recordId); err != nil {
+			return err
+		}
+		_, err = addEvent(t, zoneId, DeleteRecord, RecordSetDelete{ZoneName: zoneName, Location: c.Location, Type: c.Type})
+	case recordId != EmptyObjectId:
+		r := RecordSetUpdate{ZoneName: zoneName, Location: c.Location, Type: c.Type, Value: c.Value, Enabled: true}
+		if err := updateRecordSet(t, recordId, r); err != nil {
+			return err
+		}
+		_, err = addEvent(t, zoneId, UpdateRecord, r)
+	default:
+		if !locationExists {
+			l := NewLocation{ZoneName: zoneName, Location: c.Location, Enabled: true}
+			if locationId, err = addResource(t, EmptyObjectId); err != nil {
+				return err
+			}
+			if err := addLocation(t, zoneId, locationId, l); err != nil {
+				return err
+			}
+			if _, err := addEvent(t, zoneId, AddLocation, l); err != nil {
+				return err
+			}
+		}
+		r := NewRecordSet{ZoneName: zoneName, Location: c.Location, Type: c.Type, Value: c.Value, Enabled: true}
+		if recordId, err = addResource(t, EmptyObjectId); err != nil {
+			return err
+		}
+		if err := addRecordSet(t, locationId, recordId, r); err != nil {
+			return err
+		}
+		_, err = addEvent(t, zoneId, AddRecord, r)
+	}
+	return err
+}
+
 func setZoneKeys(t *sql.Tx, zoneId ObjectId, zoneKeys types.ZoneKeys) error {
 	_, err := t.Exec("INSERT INTO `Keys`(KSK_Private, KSK_Public, ZSK_Private, ZSK_Public, DS, Zone_Id) VALUES (?, ?, ?, ?, ?, ?)", zoneKeys.KSKPrivate, zoneKeys.KSKPublic, zoneKeys.ZSKPrivate, zoneKeys.ZSKPublic, zoneKeys.DS, zoneId)
 	return err
@@ -255,11 +377,54 @@ func (db *DataBase) getZones(userId ObjectId, start int, count int, q string, as
 }
 
 func (db *DataBase) getZone(zoneId ObjectId) (Zone, error) {
-	res := db.db.QueryRow("SELECT Resource_Id, Name, CNameFlattening, Dnssec, Enabled, TTL, NS, MBox, Refresh, Retry, Expire, MinTTL, Serial, DS FROM Zone LEFT JOIN SOA ON Zone.Resource_Id = SOA.Zone_Id  LEFT JOIN `Keys` K ON Zone.Resource_Id = K.Zone_Id WHERE Zone.Resource_Id = ?", zoneId)
+	res := db.db.QueryRow("SELECT Resource_Id, Name, CNameFlattening, Dnssec, Enabled, AllowTransfer, Primaries, AlsoNotify, NSEC3, CDSDelete, KeyAlgorithm, Signature, IgnoreClientSubnet, Views, TTL, NS, MBox, Refresh, Retry, Expire, MinTTL, Serial, DS FROM Zone LEFT JOIN SOA ON Zone.Resource_Id = SOA.Zone_Id  LEFT JOIN `Keys` K ON Zone.Resource_Id = K.Zone_Id WHERE Zone.Resource_Id = ?", zoneId)
 	var (
-		z Zone
+		z             Zone
+		allowTransfer sql.NullString
+		primaries     sql.NullString
+		alsoNotify    sql.NullString
+		nsec3         sql.NullString
+		keyAlgorithm  sql.NullString
+		signature     sql.NullString
+		views         sql.NullString
 	)
-	err := res.Scan(&z.Id, &z.Name, &z.CNameFlattening, &z.Dnssec, &z.Enabled, &z.SOA.TtlValue, &z.SOA.Ns, &z.SOA.MBox, &z.SOA.Refresh, &z.SOA.Retry, &z.SOA.Expire, &z.SOA.MinTtl, &z.SOA.Serial, &z.DS)
+	err := res.Scan(&z.Id, &z.Name, &z.CNameFlattening, &z.Dnssec, &z.Enabled, &allowTransfer, &primaries, &alsoNotify, &nsec3, &z.CDSDelete, &keyAlgorithm, &signature, &z.IgnoreClientSubnet, &views, &z.SOA.TtlValue, &z.SOA.Ns, &z.SOA.MBox, &z.SOA.Refresh, &z.SOA.Retry, &z.SOA.Expire, &z.SOA.MinTtl, &z.SOA.Serial, &z.DS)
+	if err != nil {
+		return z, err
+	}
+	if allowTransfer.Valid {
+		if err = jsoniter.Unmarshal([]byte(allowTransfer.String), &z.AllowTransfer); err != nil {
+			return z, err
+		}
+	}
+	if primaries.Valid {
+		if err = jsoniter.Unmarshal([]byte(primaries.String), &z.Primaries); err != nil {
+			return z, err
+		}
+	}
+	if alsoNotify.Valid {
+		if err = jsoniter.Unmarshal([]byte(alsoNotify.String), &z.AlsoNotify); err != nil {
+			return z, err
+		}
+	}
+	if nsec3.Valid {
+		if err = jsoniter.Unmarshal([]byte(nsec3.String), &z.NSEC3); err != nil {
+			return z, err
+		}
+	}
+	if keyAlgorithm.Valid {
+		if err = jsoniter.Unmarshal([]byte(keyAlgorithm.String), &z.KeyAlgorithm); err != nil {
+			return z, err
+		}
+	}
+	if signature.Valid {
+		if err = jsoniter.Unmarshal([]byte(signature.String), &z.Signature); err != nil {
+			return z, err
+		}
+	}
+	if views.Valid {
+		err = jsoniter.Unmarshal([]byte(views.String), &z.Views)
+	}
 	return z, err
 }
 
@@ -490,6 +655,62 @@ func (db *DataBase) deleteAPIKey(userId ObjectId, name string) error {
 	return err
 }
 
+func addTSIGKey(t *sql.Tx, userId ObjectId, zoneId ObjectId, key NewTSIGKey) error {
+	_, err := t.Exec("INSERT INTO TSIGKeys(Name, Algorithm, Secret, Enabled, User_Id, Zone_Id) VALUES (?, ?, ?, ?, ?, ?)", key.Name, key.Algorithm, key.Secret, key.Enabled, userId, zoneId)
+	return err
+}
+
+func (db *DataBase) getTSIGKeys(zoneId ObjectId) ([]TSIGKey, error) {
+	rows, err := db.db.Query("SELECT Name, Algorithm, Secret, Enabled FROM TSIGKeys WHERE Zone_Id = ? ORDER BY Name", zoneId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []TSIGKey{}, nil
+		}
+		return []TSIGKey{}, err
+	}
+	defer func() { _ = rows.Close() }()
+	res := []TSIGKey{}
+	for rows.Next() {
+		var item TSIGKey
+		err := rows.Scan(&item.Name, &item.Algorithm, &item.Secret, &item.Enabled)
+		if err != nil {
+			return []TSIGKey{}, err
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+func (db *DataBase) getTSIGKey(zoneId ObjectId, name string) (TSIGKey, error) {
+	row := db.db.QueryRow("SELECT Name, Algorithm, Secret, Enabled FROM TSIGKeys WHERE Zone_Id = ? AND Name = ?", zoneId, name)
+	var res TSIGKey
+	err := row.Scan(&res.Name, &res.Algorithm, &res.Secret, &res.Enabled)
+	if err != nil {
+		return TSIGKey{}, err
+	}
+	return res, nil
+}
+
+func (db *DataBase) getTSIGKeyUser(zoneId ObjectId, name string) (ObjectId, error) {
+	row := db.db.QueryRow("SELECT User_Id FROM TSIGKeys WHERE Zone_Id = ? AND Name = ? AND Enabled = TRUE", zoneId, name)
+	var userId ObjectId
+	err := row.Scan(&userId)
+	if err != nil {
+		return EmptyObjectId, err
+	}
+	return userId, nil
+}
+
+func updateTSIGKey(t *sql.Tx, zoneId ObjectId, key TSIGKeyUpdate) error {
+	_, err := t.Exec("UPDATE TSIGKeys SET Enabled = ? WHERE Zone_Id = ? AND Name = ?", key.Enabled, zoneId, key.Name)
+	return err
+}
+
+func deleteTSIGKey(t *sql.Tx, zoneId ObjectId, name string) error {
+	_, err := t.Exec("DELETE FROM TSIGKeys WHERE Zone_Id = ? AND Name = ?", zoneId, name)
+	return err
+}
+
 func (db *DataBase) resourceExists(Id ObjectId) (bool, error) {
 	row := db.db.QueryRow("SELECT COUNT(*) FROM Resource WHERE Id = ?", Id)
 	var count int
@@ -59,31 +59,57 @@ type Verification struct {
 }
 
 type Zone struct {
-	Id              ObjectId
-	Name            string
-	Enabled         bool
-	Dnssec          bool
-	CNameFlattening bool
-	SOA             types.SOA_RRSet
-	DS              string
+	Id                 ObjectId
+	Name               string
+	Enabled            bool
+	Dnssec             bool
+	CNameFlattening    bool
+	SOA                types.SOA_RRSet
+	DS                 string
+	AllowTransfer      []string
+	Primaries          []string
+	AlsoNotify         []string
+	NSEC3              *types.NSEC3Config
+	CDSDelete          bool
+	KeyAlgorithm       *types.KeyAlgorithmConfig
+	Signature          *types.SignatureConfig
+	IgnoreClientSubnet bool
+	Views              []View
 }
 
 type NewZone struct {
-	Name            string          `json:"name"`
-	Enabled         bool            `json:"enabled"`
-	Dnssec          bool            `json:"dnssec"`
-	CNameFlattening bool            `json:"cname_flattening"`
-	SOA             types.SOA_RRSet `json:"soa"`
-	Keys            types.ZoneKeys  `json:"keys"`
-	NS              types.NS_RRSet  `json:"ns"`
+	Name               string                    `json:"name"`
+	Enabled            bool                      `json:"enabled"`
+	Dnssec             bool                      `json:"dnssec"`
+	CNameFlattening    bool                      `json:"cname_flattening"`
+	SOA                types.SOA_RRSet           `json:"soa"`
+	Keys               types.ZoneKeys            `json:"keys"`
+	NS                 types.NS_RRSet            `json:"ns"`
+	AllowTransfer      []string                  `json:"allow_transfer"`
+	Primaries          []string                  `json:"primaries"`
+	AlsoNotify         []string                  `json:"also_notify"`
+	NSEC3              *types.NSEC3Config        `json:"nsec3"`
+	KeyAlgorithm       *types.KeyAlgorithmConfig `json:"key_algorithm"`
+	Signature          *types.SignatureConfig    `json:"signature"`
+	IgnoreClientSubnet bool                      `json:"ignore_client_subnet"`
+	Views              []View                    `json:"views"`
 }
 
 type ZoneUpdate struct {
-	Name            string          `json:"name"`
-	Enabled         bool            `json:"enabled"`
-	Dnssec          bool            `json:"dnssec"`
-	CNameFlattening bool            `json:"cname_flattening"`
-	SOA             types.SOA_RRSet `json:"soa"`
+	Name               string                    `json:"name"`
+	Enabled            bool                      `json:"enabled"`
+	Dnssec             bool                      `json:"dnssec"`
+	CNameFlattening    bool                      `json:"cname_flattening"`
+	SOA                types.SOA_RRSet           `json:"soa"`
+	AllowTransfer      []string                  `json:"allow_transfer"`
+	Primaries          []string                  `json:"primaries"`
+	AlsoNotify         []string                  `json:"also_notify"`
+	NSEC3              *types.NSEC3Config        `json:"nsec3"`
+	CDSDelete          bool                      `json:"cds_delete"`
+	KeyAlgorithm       *types.KeyAlgorithmConfig `json:"key_algorithm"`
+	Signature          *types.SignatureConfig    `json:"signature"`
+	IgnoreClientSubnet bool                      `json:"ignore_client_subnet"`
+	Views              []View                    `json:"views"`
 }
 
 type ZoneDelete struct {
@@ -119,6 +145,39 @@ func (zi *ZoneImport) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// View is a split horizon view of a zone, records override zone rrsets by label and type for clients of view
+type View struct {
+	types.ViewConfig
+	Records map[string]map[string]types.RRSet `json:"records,omitempty"`
+}
+
+func (v *View) UnmarshalJSON(data []byte) error {
+	if err := jsoniter.Unmarshal(data, &v.ViewConfig); err != nil {
+		return err
+	}
+	var _v struct {
+		Records map[string]map[string]json.RawMessage `json:"records"`
+	}
+	if err := jsoniter.Unmarshal(data, &_v); err != nil {
+		return err
+	}
+	v.Records = make(map[string]map[string]types.RRSet)
+	for label, location := range _v.Records {
+		v.Records[label] = make(map[string]types.RRSet)
+		for rtype, rvalue := range location {
+			rrset := types.TypeStrToRRSet(rtype)
+			if rrset == nil {
+				return errors.New("invalid record type: " + rtype)
+			}
+			if err := jsoniter.Unmarshal(rvalue, rrset); err != nil {
+				return err
+			}
+			v.Records[label][rtype] = rrset
+		}
+	}
+	return nil
+}
+
 type Location struct {
 	Id      ObjectId
 	Name    string
@@ -231,6 +290,13 @@ type RecordSetDelete struct {
 	Type     string `json:"type"`
 }
 
+// RecordSetChange replaces value of a rrset, an empty value removes it
+type RecordSetChange struct {
+	Location string
+	Type     string
+	Value    types.RRSet
+}
+
 type ListItem struct {
 	Id      string `json:"id"`
 	Enabled bool   `json:"enabled"`
@@ -268,6 +334,9 @@ const (
 	AddRecord      EventType = "add_record"
 	UpdateRecord   EventType = "update_record"
 	DeleteRecord   EventType = "delete_record"
+	AddTSIGKey     EventType = "add_tsig_key"
+	UpdateTSIGKey  EventType = "update_tsig_key"
+	DeleteTSIGKey  EventType = "delete_tsig_key"
 )
 
 type APIKey struct {
@@ -297,3 +366,29 @@ type APIKeyUpdate struct {
 	Scope   string `json:"scope"`
 	Enabled bool   `json:"enabled"`
 }
+
+type TSIGKey struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Secret    string `json:"secret"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type NewTSIGKey struct {
+	ZoneName  string `json:"zone_name"`
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Secret    string `json:"secret"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type TSIGKeyUpdate struct {
+	ZoneName string `json:"zone_name"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+}
+
+type TSIGKeyDelete struct {
+	ZoneName string `json:"zone_name"`
+	Name     string `json:"name"`
+}
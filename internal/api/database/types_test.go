@@ -54,3 +54,30 @@ func TestZoneImport_UnmarshalJSON(t *testing.T) {
 		},
 	}))
 }
+
+func TestView_UnmarshalJSON(t *testing.T) {
+	RegisterTestingT(t)
+	var views []View
+	err := jsoniter.Unmarshal([]byte(`[{"name":"internal", "sources":["10.0.0.0/8"], "records":{"www":{"a":{"ttl":300, "records":[{"ip":"10.0.0.1"}]}}}}]`), &views)
+	Expect(err).To(BeNil())
+	expected := View{
+		ViewConfig: types.ViewConfig{Name: "internal", Sources: []string{"10.0.0.0/8"}},
+		Records: map[string]map[string]types.RRSet{
+			"www": {
+				"a": &types.IP_RRSet{
+					GenericRRSet: types.GenericRRSet{TtlValue: 300},
+					Data:         []types.IP_RR{{Ip: net.ParseIP("10.0.0.1")}},
+				},
+			},
+		},
+	}
+	Expect(views).To(Equal([]View{expected}))
+
+	data, err := jsoniter.Marshal(views)
+	Expect(err).To(BeNil())
+	var decoded []View
+	Expect(jsoniter.Unmarshal(data, &decoded)).To(BeNil())
+	Expect(decoded).To(Equal(views))
+
+	Expect(jsoniter.Unmarshal([]byte(`{"name":"internal", "records":{"www":{"afsdb":{}}}}`), &View{})).NotTo(BeNil())
+}
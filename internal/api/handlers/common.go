@@ -9,6 +9,9 @@ import (
 
 const IdentityKey = "identity"
 
+// APIKeyKey holds *database.APIKey of request, it is only set after key is checked against stored hash
+const APIKeyKey = "api_key"
+
 type IdentityData struct {
 	Id    database.ObjectId
 	Email string
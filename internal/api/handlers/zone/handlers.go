@@ -1,6 +1,9 @@
 package zone
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -11,7 +14,9 @@ import (
 	"z42-core/internal/upstream"
 	"github.com/miekg/dns"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -33,6 +38,11 @@ type storage interface {
 	GetRecordSet(userId database.ObjectId, zoneName string, location string, recordType string) (database.RecordSet, error)
 	UpdateRecordSet(userId database.ObjectId, r database.RecordSetUpdate) error
 	DeleteRecordSet(userId database.ObjectId, r database.RecordSetDelete) error
+	AddTSIGKey(userId database.ObjectId, k database.NewTSIGKey) error
+	GetTSIGKeys(userId database.ObjectId, zoneName string) ([]database.TSIGKey, error)
+	GetTSIGKey(userId database.ObjectId, zoneName string, name string) (database.TSIGKey, error)
+	UpdateTSIGKey(userId database.ObjectId, k database.TSIGKeyUpdate) error
+	DeleteTSIGKey(userId database.ObjectId, k database.TSIGKeyDelete) error
 }
 
 type Handler struct {
@@ -50,9 +60,10 @@ func New(db storage, u *upstream.Upstream, nameServer string) *Handler {
 }
 
 const (
-	zoneNameKey   = "zone_name"
-	locationKey   = "location"
-	recordTypeKey = "record_type"
+	zoneNameKey    = "zone_name"
+	locationKey    = "location"
+	recordTypeKey  = "record_type"
+	tsigKeyNameKey = "key_name"
 )
 
 func (h *Handler) RegisterHandlers(group *gin.RouterGroup) {
@@ -64,6 +75,7 @@ func (h *Handler) RegisterHandlers(group *gin.RouterGroup) {
 	group.DELETE("/:zone_name", h.deleteZone)
 
 	group.GET("/:zone_name/active_ns", h.getActiveNS)
+	group.GET("/:zone_name/ds_status", h.getDSStatus)
 
 	group.POST("/:zone_name/import", h.importZone)
 	group.GET("/:zone_name/export", h.exportZone)
@@ -81,6 +93,13 @@ func (h *Handler) RegisterHandlers(group *gin.RouterGroup) {
 	group.GET("/:zone_name/locations/:location/rrsets/:record_type", h.getRecordSet)
 	group.PUT("/:zone_name/locations/:location/rrsets/:record_type", h.updateRecordSet)
 	group.DELETE("/:zone_name/locations/:location/rrsets/:record_type", h.deleteRecordSet)
+
+	group.GET("/:zone_name/tsig_keys", h.getTSIGKeys)
+	group.POST("/:zone_name/tsig_keys", h.addTSIGKey)
+
+	group.GET("/:zone_name/tsig_keys/:key_name", h.getTSIGKey)
+	group.PUT("/:zone_name/tsig_keys/:key_name", h.updateTSIGKey)
+	group.DELETE("/:zone_name/tsig_keys/:key_name", h.deleteTSIGKey)
 }
 
 func (h *Handler) getZones(c *gin.Context) {
@@ -117,15 +136,51 @@ func (h *Handler) addZone(c *gin.Context) {
 		handlers.ErrorResponse(c, http.StatusBadRequest, "binding request failed", err)
 		return
 	}
+	if !addressListValid(z.AllowTransfer) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid allow_transfer", nil)
+		return
+	}
+	if !serverListValid(z.Primaries) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid primaries", nil)
+		return
+	}
+	if !serverListValid(z.AlsoNotify) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid also_notify", nil)
+		return
+	}
+	if !nsec3Valid(z.NSEC3) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid nsec3", nil)
+		return
+	}
+	if _, _, err := dnssec.KeyAlgorithm(z.KeyAlgorithm); err != nil {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid key_algorithm", err)
+		return
+	}
+	if !dnssec.SignatureConfigValid(z.Signature) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid signature", nil)
+		return
+	}
+	if !viewsValid(z.Views) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid views", nil)
+		return
+	}
 	model := database.NewZone{
-		Name:            z.Name,
-		Enabled:         z.Enabled,
-		Dnssec:          z.Dnssec,
-		CNameFlattening: z.CNameFlattening,
-		SOA:             *types.DefaultSOA(z.Name),
-		NS:              *types.GenerateNS(h.nameServer),
-	}
-	model.Keys, err = dnssec.GenerateKeys(z.Name)
+		Name:               z.Name,
+		Enabled:            z.Enabled,
+		Dnssec:             z.Dnssec,
+		CNameFlattening:    z.CNameFlattening,
+		SOA:                *types.DefaultSOA(z.Name),
+		NS:                 *types.GenerateNS(h.nameServer),
+		AllowTransfer:      z.AllowTransfer,
+		Primaries:          z.Primaries,
+		AlsoNotify:         z.AlsoNotify,
+		NSEC3:              z.NSEC3,
+		KeyAlgorithm:       z.KeyAlgorithm,
+		Signature:          z.Signature,
+		IgnoreClientSubnet: z.IgnoreClientSubnet,
+		Views:              z.Views,
+	}
+	model.Keys, err = dnssec.GenerateKeys(z.Name, z.KeyAlgorithm)
 	if err != nil {
 		handlers.ErrorResponse(c, http.StatusInternalServerError, "cannot create zone keys", err)
 		return
@@ -160,12 +215,21 @@ func (h *Handler) getZone(c *gin.Context) {
 	}
 
 	resp := GetZoneResponse{
-		Name:            z.Name,
-		Enabled:         z.Enabled,
-		Dnssec:          z.Dnssec,
-		CNameFlattening: z.CNameFlattening,
-		SOA:             z.SOA,
-		DS:              z.DS,
+		Name:               z.Name,
+		Enabled:            z.Enabled,
+		Dnssec:             z.Dnssec,
+		CNameFlattening:    z.CNameFlattening,
+		SOA:                z.SOA,
+		DS:                 z.DS,
+		AllowTransfer:      z.AllowTransfer,
+		Primaries:          z.Primaries,
+		AlsoNotify:         z.AlsoNotify,
+		NSEC3:              z.NSEC3,
+		CDSDelete:          z.CDSDelete,
+		KeyAlgorithm:       z.KeyAlgorithm,
+		Signature:          z.Signature,
+		IgnoreClientSubnet: z.IgnoreClientSubnet,
+		Views:              z.Views,
 	}
 
 	handlers.SuccessResponse(c, http.StatusOK, "successful", resp)
@@ -189,6 +253,38 @@ func (h *Handler) updateZone(c *gin.Context) {
 		handlers.ErrorResponse(c, http.StatusBadRequest, "binding request failed", err)
 		return
 	}
+	if !addressListValid(req.AllowTransfer) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid allow_transfer", nil)
+		return
+	}
+	if !serverListValid(req.Primaries) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid primaries", nil)
+		return
+	}
+	if !serverListValid(req.AlsoNotify) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid also_notify", nil)
+		return
+	}
+	if !nsec3Valid(req.NSEC3) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid nsec3", nil)
+		return
+	}
+	if _, _, err := dnssec.KeyAlgorithm(req.KeyAlgorithm); err != nil {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid key_algorithm", err)
+		return
+	}
+	if !dnssec.SignatureConfigValid(req.Signature) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid signature", nil)
+		return
+	}
+	if !viewsValid(req.Views) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid views", nil)
+		return
+	}
+	if req.CDSDelete && req.Dnssec {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "cds_delete requires dnssec to be disabled", nil)
+		return
+	}
 
 	z, err := h.db.GetZone(userId, zoneName)
 	if err != nil {
@@ -198,11 +294,20 @@ func (h *Handler) updateZone(c *gin.Context) {
 	req.SOA.Serial = z.SOA.Serial + 1
 
 	zoneUpdate := database.ZoneUpdate{
-		Name:            zoneName,
-		Enabled:         req.Enabled,
-		Dnssec:          req.Dnssec,
-		CNameFlattening: req.CNameFlattening,
-		SOA:             req.SOA,
+		Name:               zoneName,
+		Enabled:            req.Enabled,
+		Dnssec:             req.Dnssec,
+		CNameFlattening:    req.CNameFlattening,
+		SOA:                req.SOA,
+		AllowTransfer:      req.AllowTransfer,
+		Primaries:          req.Primaries,
+		AlsoNotify:         req.AlsoNotify,
+		NSEC3:              req.NSEC3,
+		CDSDelete:          req.CDSDelete,
+		KeyAlgorithm:       req.KeyAlgorithm,
+		Signature:          req.Signature,
+		IgnoreClientSubnet: req.IgnoreClientSubnet,
+		Views:              req.Views,
 	}
 	if err := h.db.UpdateZone(userId, zoneUpdate); err != nil {
 		handlers.ErrorResponse(handlers.StatusFromError(c, err))
@@ -439,6 +544,10 @@ func (h *Handler) addRecordSet(c *gin.Context) {
 		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid record type", nil)
 		return
 	}
+	if !healthCheckValid(req.Value) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid health_check", nil)
+		return
+	}
 	_, err = h.db.AddRecordSet(userId, model)
 	if err != nil {
 		handlers.ErrorResponse(handlers.StatusFromError(c, err))
@@ -511,6 +620,10 @@ func (h *Handler) updateRecordSet(c *gin.Context) {
 		handlers.ErrorResponse(c, http.StatusBadRequest, "binding request failed", err)
 		return
 	}
+	if !healthCheckValid(req.Value) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid health_check", nil)
+		return
+	}
 	model := database.RecordSetUpdate{
 		ZoneName: zoneName,
 		Location: location,
@@ -556,6 +669,169 @@ func (h *Handler) deleteRecordSet(c *gin.Context) {
 	handlers.SuccessfulOperationResponse(c, http.StatusOK, "successful", recordType)
 }
 
+func (h *Handler) getTSIGKeys(c *gin.Context) {
+	userId := handlers.ExtractUser(c)
+	if userId == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "user missing", nil)
+		return
+	}
+
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone missing", nil)
+		return
+	}
+
+	keys, err := h.db.GetTSIGKeys(userId, zoneName)
+	if err != nil {
+		handlers.ErrorResponse(handlers.StatusFromError(c, err))
+		return
+	}
+	handlers.SuccessResponse(c, http.StatusOK, "successful", keys)
+}
+
+func (h *Handler) addTSIGKey(c *gin.Context) {
+	userId := handlers.ExtractUser(c)
+	if userId == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "user missing", nil)
+		return
+	}
+
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone missing", nil)
+		return
+	}
+
+	var req NewTSIGKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "binding request failed", err)
+		return
+	}
+	if _, ok := dns.IsDomainName(req.Name); !ok {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid key name", nil)
+		return
+	}
+	if req.Algorithm == "" {
+		req.Algorithm = dns.HmacSHA256
+	}
+	req.Algorithm = dns.CanonicalName(req.Algorithm)
+	if !tsigAlgorithmValid(req.Algorithm) {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "invalid algorithm", nil)
+		return
+	}
+	secret, err := generateTSIGSecret()
+	if err != nil {
+		handlers.ErrorResponse(c, http.StatusInternalServerError, "cannot generate secret", err)
+		return
+	}
+	model := database.NewTSIGKey{
+		ZoneName:  zoneName,
+		Name:      dns.CanonicalName(req.Name),
+		Algorithm: req.Algorithm,
+		Secret:    secret,
+		Enabled:   req.Enabled,
+	}
+	if err := h.db.AddTSIGKey(userId, model); err != nil {
+		handlers.ErrorResponse(handlers.StatusFromError(c, err))
+		return
+	}
+	resp := database.TSIGKey{
+		Name:      model.Name,
+		Algorithm: model.Algorithm,
+		Secret:    model.Secret,
+		Enabled:   model.Enabled,
+	}
+	handlers.SuccessResponse(c, http.StatusCreated, "successful", resp)
+}
+
+func (h *Handler) getTSIGKey(c *gin.Context) {
+	userId := handlers.ExtractUser(c)
+	if userId == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "user missing", nil)
+		return
+	}
+
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone missing", nil)
+		return
+	}
+	name := c.Param(tsigKeyNameKey)
+	if name == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "key name missing", nil)
+		return
+	}
+
+	key, err := h.db.GetTSIGKey(userId, zoneName, dns.CanonicalName(name))
+	if err != nil {
+		handlers.ErrorResponse(handlers.StatusFromError(c, err))
+		return
+	}
+	handlers.SuccessResponse(c, http.StatusOK, "successful", key)
+}
+
+func (h *Handler) updateTSIGKey(c *gin.Context) {
+	userId := handlers.ExtractUser(c)
+	if userId == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "user missing", nil)
+		return
+	}
+
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone missing", nil)
+		return
+	}
+	name := c.Param(tsigKeyNameKey)
+	if name == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "key name missing", nil)
+		return
+	}
+
+	var req UpdateTSIGKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "binding request failed", err)
+		return
+	}
+	model := database.TSIGKeyUpdate{
+		ZoneName: zoneName,
+		Name:     dns.CanonicalName(name),
+		Enabled:  req.Enabled,
+	}
+	if err := h.db.UpdateTSIGKey(userId, model); err != nil {
+		handlers.ErrorResponse(handlers.StatusFromError(c, err))
+		return
+	}
+	handlers.SuccessfulOperationResponse(c, http.StatusOK, "successful", model.Name)
+}
+
+func (h *Handler) deleteTSIGKey(c *gin.Context) {
+	userId := handlers.ExtractUser(c)
+	if userId == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "user missing", nil)
+		return
+	}
+
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone missing", nil)
+		return
+	}
+	name := c.Param(tsigKeyNameKey)
+	if name == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "key name missing", nil)
+		return
+	}
+
+	err := h.db.DeleteTSIGKey(userId, database.TSIGKeyDelete{ZoneName: zoneName, Name: dns.CanonicalName(name)})
+	if err != nil {
+		handlers.ErrorResponse(handlers.StatusFromError(c, err))
+		return
+	}
+	handlers.SuccessfulOperationResponse(c, http.StatusOK, "successful", name)
+}
+
 func (h *Handler) importZone(c *gin.Context) {
 	userId := handlers.ExtractUser(c)
 	if userId == "" {
@@ -732,6 +1008,149 @@ func (h *Handler) getActiveNS(c *gin.Context) {
 	handlers.SuccessResponse(c, http.StatusOK, "successful", resp)
 }
 
+// getDSStatus compares ds records at parent with cds records published by zone to follow key rollovers
+func (h *Handler) getDSStatus(c *gin.Context) {
+	zoneName := c.Param(zoneNameKey)
+	if zoneName == "" {
+		handlers.ErrorResponse(c, http.StatusBadRequest, "zone name missing", nil)
+		return
+	}
+
+	ds, rcode := h.upstream.Query(zoneName, dns.TypeDS)
+	if rcode == dns.RcodeServerFailure {
+		handlers.ErrorResponse(c, http.StatusBadGateway, "query failed", nil)
+		return
+	}
+	cds, cdsRcode := h.upstream.Query(zoneName, dns.TypeCDS)
+	if cdsRcode == dns.RcodeServerFailure {
+		handlers.ErrorResponse(c, http.StatusBadGateway, "query failed", nil)
+		return
+	}
+	resp := DSStatus{
+		RCode: rcode,
+		DS:    []string{},
+		CDS:   []string{},
+	}
+	dsSet := make(map[string]bool)
+	for _, rr := range ds {
+		if d, ok := rr.(*dns.DS); ok {
+			resp.DS = append(resp.DS, dnssec.DSString(d))
+			dsSet[dnssec.DSString(d)] = true
+		}
+	}
+	cdsSet := make(map[string]bool)
+	for _, rr := range cds {
+		if d, ok := rr.(*dns.CDS); ok {
+			resp.CDS = append(resp.CDS, dnssec.DSString(&d.DS))
+			// delete cds (rfc8078) asks for an empty ds set
+			if d.Algorithm != 0 {
+				cdsSet[dnssec.DSString(&d.DS)] = true
+			}
+		}
+	}
+	resp.Published = len(resp.CDS) > 0 && len(dsSet) == len(cdsSet)
+	for key := range cdsSet {
+		if !dsSet[key] {
+			resp.Published = false
+		}
+	}
+	handlers.SuccessResponse(c, http.StatusOK, "successful", resp)
+}
+
 func rtypeValid(rtype string) bool {
 	return types.IsSupported(types.StringToType(rtype))
 }
+
+func addressListValid(addresses []string) bool {
+	for _, address := range addresses {
+		if _, err := types.ParseNetwork(address); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func serverListValid(servers []string) bool {
+	for _, server := range servers {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// viewsValid checks view names are unique and usable in storage keys and view lists are valid addresses
+func viewsValid(views []database.View) bool {
+	names := make(map[string]bool)
+	for _, view := range views {
+		if view.Name == "" || strings.Contains(view.Name, ":") || names[view.Name] {
+			return false
+		}
+		names[view.Name] = true
+		if !addressListValid(view.Sources) || !addressListValid(view.ClientSubnets) {
+			return false
+		}
+		for _, listener := range view.Listeners {
+			if listener == "" {
+				return false
+			}
+			host, port, err := net.SplitHostPort(listener)
+			if err != nil {
+				host, port = listener, ""
+			}
+			if host != "" && net.ParseIP(host) == nil {
+				return false
+			}
+			if _, err := strconv.ParseUint(port, 10, 16); port != "" && err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// healthCheckValid checks health check of ip rrsets, tcp checks have no default port
+func healthCheckValid(value types.RRSet) bool {
+	rrset, ok := value.(*types.IP_RRSet)
+	if !ok {
+		return true
+	}
+	config := rrset.HealthCheckConfig
+	if config.Port < 0 || config.Port > 65535 {
+		return false
+	}
+	return config.Protocol != "tcp" || config.Port != 0
+}
+
+// nsec3Valid checks nsec3 parameters, iterations are capped as recommended by rfc9276
+func nsec3Valid(config *types.NSEC3Config) bool {
+	if config == nil {
+		return true
+	}
+	if config.Algorithm != dns.SHA1 || config.Iterations > 100 {
+		return false
+	}
+	salt, err := hex.DecodeString(config.Salt)
+	return err == nil && len(salt) <= 255
+}
+
+func tsigAlgorithmValid(algorithm string) bool {
+	switch algorithm {
+	case dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512:
+		return true
+	default:
+		return false
+	}
+}
+
+func generateTSIGSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(secret), nil
+}
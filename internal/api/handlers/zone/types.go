@@ -2,6 +2,7 @@ package zone
 
 import (
 	"errors"
+	"z42-core/internal/api/database"
 	"z42-core/internal/types"
 	jsoniter "github.com/json-iterator/go"
 )
@@ -20,26 +21,52 @@ type ListResponseItem struct {
 type ListResponse []ListResponseItem
 
 type NewZoneRequest struct {
-	Name            string `json:"name" binding:"required"`
-	Enabled         bool   `json:"enabled"`
-	Dnssec          bool   `json:"dnssec"`
-	CNameFlattening bool   `json:"cname_flattening"`
+	Name               string                    `json:"name" binding:"required"`
+	Enabled            bool                      `json:"enabled"`
+	Dnssec             bool                      `json:"dnssec"`
+	CNameFlattening    bool                      `json:"cname_flattening"`
+	AllowTransfer      []string                  `json:"allow_transfer"`
+	Primaries          []string                  `json:"primaries"`
+	AlsoNotify         []string                  `json:"also_notify"`
+	NSEC3              *types.NSEC3Config        `json:"nsec3"`
+	KeyAlgorithm       *types.KeyAlgorithmConfig `json:"key_algorithm"`
+	Signature          *types.SignatureConfig    `json:"signature"`
+	IgnoreClientSubnet bool                      `json:"ignore_client_subnet"`
+	Views              []database.View           `json:"views"`
 }
 
 type GetZoneResponse struct {
-	Name            string          `json:"name"`
-	Enabled         bool            `json:"enabled"`
-	Dnssec          bool            `json:"dnssec"`
-	CNameFlattening bool            `json:"cname_flattening"`
-	SOA             types.SOA_RRSet `json:"soa"`
-	DS              string          `json:"ds"`
+	Name               string                    `json:"name"`
+	Enabled            bool                      `json:"enabled"`
+	Dnssec             bool                      `json:"dnssec"`
+	CNameFlattening    bool                      `json:"cname_flattening"`
+	SOA                types.SOA_RRSet           `json:"soa"`
+	DS                 string                    `json:"ds"`
+	AllowTransfer      []string                  `json:"allow_transfer,omitempty"`
+	Primaries          []string                  `json:"primaries,omitempty"`
+	AlsoNotify         []string                  `json:"also_notify,omitempty"`
+	NSEC3              *types.NSEC3Config        `json:"nsec3,omitempty"`
+	CDSDelete          bool                      `json:"cds_delete,omitempty"`
+	KeyAlgorithm       *types.KeyAlgorithmConfig `json:"key_algorithm,omitempty"`
+	Signature          *types.SignatureConfig    `json:"signature,omitempty"`
+	IgnoreClientSubnet bool                      `json:"ignore_client_subnet,omitempty"`
+	Views              []database.View           `json:"views,omitempty"`
 }
 
 type UpdateZoneRequest struct {
-	Enabled         bool            `json:"enabled"`
-	Dnssec          bool            `json:"dnssec"`
-	CNameFlattening bool            `json:"cname_flattening"`
-	SOA             types.SOA_RRSet `json:"soa"`
+	Enabled            bool                      `json:"enabled"`
+	Dnssec             bool                      `json:"dnssec"`
+	CNameFlattening    bool                      `json:"cname_flattening"`
+	SOA                types.SOA_RRSet           `json:"soa"`
+	AllowTransfer      []string                  `json:"allow_transfer"`
+	Primaries          []string                  `json:"primaries"`
+	AlsoNotify         []string                  `json:"also_notify"`
+	NSEC3              *types.NSEC3Config        `json:"nsec3"`
+	CDSDelete          bool                      `json:"cds_delete"`
+	KeyAlgorithm       *types.KeyAlgorithmConfig `json:"key_algorithm"`
+	Signature          *types.SignatureConfig    `json:"signature"`
+	IgnoreClientSubnet bool                      `json:"ignore_client_subnet"`
+	Views              []database.View           `json:"views"`
 }
 
 type NewLocationRequest struct {
@@ -98,7 +125,24 @@ type UpdateRecordSetRequest struct {
 	Enabled bool        `json:"enabled"`
 }
 
+type NewTSIGKeyRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Algorithm string `json:"algorithm"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type UpdateTSIGKeyRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
 type ActiveNS struct {
 	RCode int      `json:"rcode"`
 	Hosts []string `json:"hosts"`
 }
+
+type DSStatus struct {
+	RCode     int      `json:"rcode"`
+	DS        []string `json:"ds"`
+	CDS       []string `json:"cds"`
+	Published bool     `json:"published"`
+}
@@ -689,6 +689,13 @@ func TestAddRecordSet(t *testing.T) {
 	Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
 	err = resp.Body.Close()
 	Expect(err).To(BeNil())
+
+	// tcp health check without port
+	body = `{"type": "aaaa", "enabled": true, "value": {"ttl": 300, "health_check": {"protocol": "tcp", "enable": true}, "records": [{"ip": "::1"}]}}`
+	resp = execRequest(users[0].Id, http.MethodPost, path, body)
+	Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	err = resp.Body.Close()
+	Expect(err).To(BeNil())
 }
 
 func TestAddLongText(t *testing.T) {
@@ -866,7 +873,7 @@ func TestGetRecordSet(t *testing.T) {
 	body, err := ioutil.ReadAll(resp.Body)
 	Expect(err).To(BeNil())
 	Expect(string(body)).To(MatchJSON(
-		`{"code":200,"message":"successful","data":{"value":{"ttl":300,"filter":{},"health_check":{},"records":[{"ip":"1.2.3.4"}]},"enabled":true}}`,
+		`{"code":200,"message":"successful","data":{"value":{"ttl":300,"filter":{},"health_check":{},"failover":{},"records":[{"ip":"1.2.3.4"}]},"enabled":true}}`,
 	))
 	err = resp.Body.Close()
 	Expect(err).To(BeNil())
@@ -908,8 +915,8 @@ func TestGetRecordSetWithEmptyRecords(t *testing.T) {
 		Type     string
 		Expected string
 	}{
-		{"a", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"filter":{},"health_check":{},"records":[]},"enabled":true}}`},
-		{"aaaa", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"filter":{},"health_check":{},"records":[]},"enabled":true}}`},
+		{"a", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"filter":{},"health_check":{},"failover":{},"records":[]},"enabled":true}}`},
+		{"aaaa", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"filter":{},"health_check":{},"failover":{},"records":[]},"enabled":true}}`},
 		{"txt", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"records":[]},"enabled":true}}`},
 		{"ns", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"records":[]},"enabled":true}}`},
 		{"mx", `{"code":200,"message":"successful","data":{"value":{"ttl":0,"records":[]},"enabled":true}}`},
@@ -970,7 +977,7 @@ func TestUpdateRecordSet(t *testing.T) {
 	respBody, err := ioutil.ReadAll(resp.Body)
 	Expect(err).To(BeNil())
 	Expect(string(respBody)).To(Equal(
-		`{"code":200,"message":"successful","data":{"value":{"ttl":400,"filter":{},"health_check":{},"records":[{"ip":"1.2.3.5"}]},"enabled":true}}`,
+		`{"code":200,"message":"successful","data":{"value":{"ttl":400,"filter":{},"health_check":{},"failover":{},"records":[{"ip":"1.2.3.5"}]},"enabled":true}}`,
 	))
 	err = resp.Body.Close()
 	Expect(err).To(BeNil())
@@ -1629,7 +1636,7 @@ func initialize(t *testing.T) {
 }
 
 func addZone(userId database.ObjectId, zone string) (database.ObjectId, error) {
-	Keys, err := dnssec.GenerateKeys(zone)
+	Keys, err := dnssec.GenerateKeys(zone, nil)
 	Expect(err).To(BeNil())
 	return db.AddZone(userId, database.NewZone{
 		Name:    zone,
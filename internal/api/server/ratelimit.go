@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"z42-core/internal/api/database"
+	"z42-core/internal/api/handlers"
+	"z42-core/pkg/ratelimit"
+)
+
+// rateLimitKey returns who is charged for a request, checked api keys and users are throttled on their own
+// wherever they connect from and anonymous requests are throttled per client address. unchecked key headers
+// are ignored, otherwise clients could get a fresh bucket with every made up key
+func rateLimitKey(c *gin.Context) string {
+	if value, found := c.Get(handlers.APIKeyKey); found {
+		if key, ok := value.(*database.APIKey); ok {
+			return "key:" + string(key.UserId) + ":" + key.Name
+		}
+	}
+	if identity, found := c.Get(handlers.IdentityKey); found {
+		if data, ok := identity.(*handlers.IdentityData); ok {
+			return "user:" + string(data.Id)
+		}
+	}
+	// forwarded addresses are only used from trusted proxies
+	return c.ClientIP()
+}
+
+func rateLimitMiddleware(rl *ratelimit.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rl.CanHandle(rateLimitKey(c)) {
+			handlers.ErrorResponse(c, http.StatusTooManyRequests, "rate limit exceeded", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/gomega"
+	"z42-core/internal/api/database"
+	"z42-core/internal/api/handlers"
+	"z42-core/pkg/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	RegisterTestingT(t)
+	gin.SetMode(gin.TestMode)
+	cfg := ratelimit.DefaultConfig()
+	cfg.Enable = true
+	cfg.Burst = 1
+	cfg.WhiteList = []string{"10.0.0.0/8", "user:u2"}
+	rl := ratelimit.NewRateLimiter(&cfg)
+
+	router := gin.New()
+	Expect(router.SetTrustedProxies([]string{"172.16.0.1"})).To(BeNil())
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set(handlers.IdentityKey, &handlers.IdentityData{Id: database.ObjectId(user)})
+		}
+		// stands in for authentication of api keys
+		if name := c.GetHeader("X-Checked-Key"); name != "" {
+			c.Set(handlers.APIKeyKey, &database.APIKey{Name: name, UserId: "u3"})
+		}
+		c.Next()
+	})
+	router.Use(rateLimitMiddleware(rl))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(remote string, header string, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// anonymous requests are limited per address
+	Expect(request("192.168.1.1:1234", "", "")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.1:1235", "", "")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.1:1236", "", "")).To(Equal(http.StatusTooManyRequests))
+	Expect(request("192.168.1.2:1234", "", "")).To(Equal(http.StatusOK))
+	for i := 0; i < 10; i++ {
+		Expect(request("10.1.2.3:1234", "", "")).To(Equal(http.StatusOK))
+	}
+
+	// users and api keys have their own limiters regardless of address
+	Expect(request("192.168.1.1:1234", "X-User", "u1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.1:1234", "X-User", "u1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.3:1234", "X-User", "u1")).To(Equal(http.StatusTooManyRequests))
+	for i := 0; i < 10; i++ {
+		Expect(request("192.168.1.1:1234", "X-User", "u2")).To(Equal(http.StatusOK))
+	}
+	Expect(request("192.168.1.1:1234", "X-Checked-Key", "k1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.3:1234", "X-Checked-Key", "k1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.1:1234", "X-Checked-Key", "k1")).To(Equal(http.StatusTooManyRequests))
+	Expect(request("192.168.1.1:1234", "X-Checked-Key", "k2")).To(Equal(http.StatusOK))
+
+	// unchecked api keys do not get buckets of their own
+	Expect(request("192.168.1.4:1234", "X-API-Key", "random1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.4:1234", "X-API-Key", "random2")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.4:1234", "X-API-Key", "random3")).To(Equal(http.StatusTooManyRequests))
+	Expect(request("192.168.1.4:1234", "X-API-Key", "random4")).To(Equal(http.StatusTooManyRequests))
+
+	// forwarded addresses are ignored unless peer is a trusted proxy
+	Expect(request("192.168.1.5:1234", "X-Forwarded-For", "192.168.2.1")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.5:1234", "X-Forwarded-For", "192.168.2.2")).To(Equal(http.StatusOK))
+	Expect(request("192.168.1.5:1234", "X-Forwarded-For", "192.168.2.3")).To(Equal(http.StatusTooManyRequests))
+	Expect(request("172.16.0.1:1234", "X-Forwarded-For", "192.168.2.1")).To(Equal(http.StatusOK))
+	Expect(request("172.16.0.1:1234", "X-Forwarded-For", "192.168.2.2")).To(Equal(http.StatusOK))
+	Expect(request("172.16.0.1:1234", "X-Forwarded-For", "192.168.2.3")).To(Equal(http.StatusOK))
+}
@@ -14,19 +14,22 @@ import (
 	"z42-core/internal/logger"
 	"z42-core/internal/mailer"
 	"z42-core/internal/upstream"
+	"z42-core/pkg/ratelimit"
 )
 
 type Config struct {
-	BindAddress        string `json:"bind_address"`
-	ReadTimeout        int    `json:"read_timeout"`
-	WriteTimeout       int    `json:"write_timeout"`
-	MaxBodyBytes       int64  `json:"max_body_size"`
-	WebServer          string `json:"web_server"`
-	ApiServer          string `json:"api_server"`
-	NameServer         string `json:"name_server"`
-	HtmlTemplates      string `json:"html_templates"`
-	RecaptchaSecretKey string `json:"recaptcha_secret_key"`
-	RecaptchaServer    string `json:"recaptcha_server"`
+	BindAddress        string           `json:"bind_address"`
+	ReadTimeout        int              `json:"read_timeout"`
+	WriteTimeout       int              `json:"write_timeout"`
+	MaxBodyBytes       int64            `json:"max_body_size"`
+	WebServer          string           `json:"web_server"`
+	ApiServer          string           `json:"api_server"`
+	NameServer         string           `json:"name_server"`
+	HtmlTemplates      string           `json:"html_templates"`
+	RecaptchaSecretKey string           `json:"recaptcha_secret_key"`
+	RecaptchaServer    string           `json:"recaptcha_server"`
+	RateLimit          ratelimit.Config `json:"ratelimit"`
+	TrustedProxies     []string         `json:"trusted_proxies"`
 }
 
 func DefaultConfig() Config {
@@ -41,6 +44,8 @@ func DefaultConfig() Config {
 		HtmlTemplates:      "./templates/*.tmpl",
 		RecaptchaSecretKey: "RECAPTCHA_SECRET_KEY",
 		RecaptchaServer:    "https://www.google.com/recaptcha/api/siteverify",
+		RateLimit:          ratelimit.DefaultConfig(),
+		TrustedProxies:     []string{},
 	}
 }
 
@@ -53,6 +58,11 @@ type Server struct {
 func NewServer(config *Config, db *database.DataBase, mailer mailer.Mailer, u *upstream.Upstream, accessLogger *zap.Logger) *Server {
 	router := gin.New()
 	router.LoadHTMLGlob(config.HtmlTemplates)
+	// client addresses of rate limiter are taken from forwarded headers only if peer is a trusted proxy
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		zap.L().Error("invalid trusted proxies, forwarded headers are ignored", zap.Error(err))
+		_ = router.SetTrustedProxies(nil)
+	}
 	handleRecovery := func(c *gin.Context, err interface{}) {
 		handlers.ErrorResponse(c, http.StatusInternalServerError, err.(string), nil)
 		c.Abort()
@@ -87,13 +97,17 @@ func NewServer(config *Config, db *database.DataBase, mailer mailer.Mailer, u *u
 		MaxHeaderBytes: 1 << 20,
 	}
 
+	rateLimiter := ratelimit.NewRateLimiter(&config.RateLimit)
+
 	authGroup := router.Group("/auth")
+	authGroup.Use(rateLimitMiddleware(rateLimiter))
 	recaptchaHandler := recaptcha.New(config.RecaptchaServer, config.RecaptchaSecretKey)
 	authHandler := auth.New(db, mailer, recaptchaHandler, config.WebServer)
 	authHandler.RegisterHandlers(authGroup)
 
 	zoneGroup := router.Group("/zones")
 	zoneGroup.Use(authHandler.MiddlewareFunc())
+	zoneGroup.Use(rateLimitMiddleware(rateLimiter))
 	zoneHandler := zone.New(db, u, config.NameServer)
 	zoneHandler.RegisterHandlers(zoneGroup)
 
@@ -2,8 +2,13 @@ package dnssec
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 	"z42-core/internal/types"
 	"go.uber.org/zap"
 
@@ -11,35 +16,77 @@ import (
 )
 
 var (
-	NsecBitmapZone          = []uint16{dns.TypeA, dns.TypeCNAME, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeCAA}
-	NsecBitmapAppex         = []uint16{dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeCAA}
+	NsecBitmapZone          = withGenericTypes(dns.TypeA, dns.TypeCNAME, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeCAA)
+	NsecBitmapAppex         = withGenericTypes(dns.TypeA, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeMX, dns.TypeTXT, dns.TypeAAAA, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeTLSA, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeCAA)
 	NsecBitmapSubDelegation = []uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG, dns.TypeNSEC}
 	NsecBitmapNameError     = []uint16{dns.TypeRRSIG, dns.TypeNSEC}
 )
 
-func GenerateKeys(zoneName string) (types.ZoneKeys, error) {
-	zsk := new(dns.DNSKEY)
-	zsk.Hdr.Rrtype = dns.TypeDNSKEY
-	zsk.Hdr.Name = zoneName
-	zsk.Hdr.Class = dns.ClassINET
-	zsk.Hdr.Ttl = 14400
-	zsk.Flags = 256
-	zsk.Protocol = 3
-	zsk.Algorithm = dns.ECDSAP256SHA256
-	zskPrivateKey, err := zsk.Generate(256)
+const (
+	ZSKFlags uint16 = 256
+	KSKFlags uint16 = 257
+
+	DefaultAlgorithm = dns.ECDSAP256SHA256
+	DefaultRSABits   = 2048
+
+	DefaultSignatureValidity = 8 * 24 * 3600
+	DefaultSignatureRefresh  = 24 * 3600
+	// signatures are valid a bit before they are made to tolerate clock skew of validators
+	inceptionOffset = 3 * time.Hour
+)
+
+// Signer signs a rrset with a zone key, it lets callers cache signatures
+type Signer func(set []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.RRSIG
+
+// SignatureWindow returns inception and expiration of signatures made at now, windows are aligned to
+// refresh interval so signatures stay the same across zone reloads and servers
+func SignatureWindow(now time.Time, config *types.SignatureConfig) (uint32, uint32) {
+	validity, refresh := DefaultSignatureValidity, DefaultSignatureRefresh
+	if config != nil && SignatureConfigValid(config) {
+		validity, refresh = config.Validity, config.Refresh
+	}
+	start := now.Unix() - now.Unix()%int64(refresh)
+	inception := time.Unix(start, 0).Add(-inceptionOffset)
+	return uint32(inception.Unix()), uint32(start + int64(validity))
+}
+
+// SignatureConfigValid checks signatures stay valid for at least one refresh interval after they are replaced
+func SignatureConfigValid(config *types.SignatureConfig) bool {
+	if config == nil {
+		return true
+	}
+	return config.Refresh >= 3600 && config.Validity >= 2*config.Refresh && config.Validity <= 90*24*3600
+}
+
+// KeyAlgorithm returns algorithm number and key size of a zone key algorithm config, nil selects default algorithm
+func KeyAlgorithm(config *types.KeyAlgorithmConfig) (uint8, int, error) {
+	if config == nil {
+		return DefaultAlgorithm, 256, nil
+	}
+	switch algorithm := dns.StringToAlgorithm[config.Algorithm]; algorithm {
+	case dns.ECDSAP256SHA256, dns.ED25519:
+		return algorithm, 256, nil
+	case dns.ECDSAP384SHA384:
+		return algorithm, 384, nil
+	case dns.RSASHA256:
+		switch {
+		case config.Bits == 0:
+			return algorithm, DefaultRSABits, nil
+		case config.Bits >= 1024 && config.Bits <= 4096:
+			return algorithm, config.Bits, nil
+		}
+		return 0, 0, errors.New("invalid key size")
+	}
+	return 0, 0, errors.New("unsupported algorithm")
+}
+
+func GenerateKeys(zoneName string, config *types.KeyAlgorithmConfig) (types.ZoneKeys, error) {
+	zsk, zskPrivateKey, err := generateKey(zoneName, ZSKFlags, config)
 	if err != nil {
 		return types.ZoneKeys{}, err
 	}
 
-	ksk := new(dns.DNSKEY)
-	ksk.Hdr.Rrtype = dns.TypeDNSKEY
-	ksk.Hdr.Name = zoneName
-	ksk.Hdr.Class = dns.ClassINET
-	ksk.Hdr.Ttl = 14400
-	ksk.Flags = 257
-	ksk.Protocol = 3
-	ksk.Algorithm = dns.ECDSAP256SHA256
-	kskPrivateKey, err := ksk.Generate(256)
+	ksk, kskPrivateKey, err := generateKey(zoneName, KSKFlags, config)
 	if err != nil {
 		return types.ZoneKeys{}, err
 	}
@@ -50,14 +97,112 @@ func GenerateKeys(zoneName string) (types.ZoneKeys, error) {
 	}
 
 	return types.ZoneKeys{
-		KSKPrivate: ksk.PrivateKeyString(kskPrivateKey),
+		KSKPrivate: kskPrivateKey,
 		KSKPublic:  ksk.String(),
-		ZSKPrivate: zsk.PrivateKeyString(zskPrivateKey),
+		ZSKPrivate: zskPrivateKey,
 		ZSKPublic:  zsk.String(),
 		DS:         ds.String(),
 	}, nil
 }
 
+// GenerateKey creates a single key pair with given flags for key rollovers
+func GenerateKey(zoneName string, flags uint16, config *types.KeyAlgorithmConfig) (string, string, error) {
+	key, privateKey, err := generateKey(zoneName, flags, config)
+	if err != nil {
+		return "", "", err
+	}
+	return key.String(), privateKey, nil
+}
+
+func generateKey(zoneName string, flags uint16, config *types.KeyAlgorithmConfig) (*dns.DNSKEY, string, error) {
+	algorithm, bits, err := KeyAlgorithm(config)
+	if err != nil {
+		return nil, "", err
+	}
+	key := new(dns.DNSKEY)
+	key.Hdr.Rrtype = dns.TypeDNSKEY
+	key.Hdr.Name = zoneName
+	key.Hdr.Class = dns.ClassINET
+	key.Hdr.Ttl = 14400
+	key.Flags = flags
+	key.Protocol = 3
+	key.Algorithm = algorithm
+	privateKey, err := key.Generate(bits)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, key.PrivateKeyString(privateKey), nil
+}
+
+// ActiveKey returns the most recently activated key with given flags
+func ActiveKey(keys []*types.ZoneKey, flags uint16) *types.ZoneKey {
+	var active *types.ZoneKey
+	for _, key := range keys {
+		if key.State != types.KeyStateActive || key.DnsKey.Flags != flags {
+			continue
+		}
+		if active == nil || key.Since > active.Since {
+			active = key
+		}
+	}
+	return active
+}
+
+// ChildKeys returns cds or cdnskey records of active ksk, or delete records (rfc8078) when zone asks for ds removal
+func ChildKeys(z *types.Zone, qtype uint16) []dns.RR {
+	if z.KSK == nil {
+		return nil
+	}
+	ttl := z.KSK.DnsKey.Hdr.Ttl
+	if z.Config.CDSDelete {
+		if qtype == dns.TypeCDS {
+			return []dns.RR{&dns.CDS{DS: dns.DS{
+				Hdr:    dns.RR_Header{Name: z.Name, Rrtype: dns.TypeCDS, Class: dns.ClassINET, Ttl: ttl},
+				Digest: "00",
+			}}}
+		}
+		return []dns.RR{&dns.CDNSKEY{DNSKEY: dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: z.Name, Rrtype: dns.TypeCDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+			Protocol:  3,
+			PublicKey: "AA==",
+		}}}
+	}
+	if qtype == dns.TypeCDS {
+		ds := z.KSK.DnsKey.ToDS(dns.SHA256)
+		if ds == nil {
+			return nil
+		}
+		return []dns.RR{ds.ToCDS()}
+	}
+	return []dns.RR{z.KSK.DnsKey.ToCDNSKEY()}
+}
+
+// withGenericTypes adds types.GenericTypes to bitmap, types must be in ascending order on the wire
+func withGenericTypes(bitmap ...uint16) []uint16 {
+	bitmap = append(bitmap, types.GenericTypes...)
+	sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+	return bitmap
+}
+
+// DSString formats digest fields of ds so records from parent and child keys compare equal
+func DSString(ds *dns.DS) string {
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(ds.Digest))
+}
+
+// HasDS reports whether ds records published at parent include one for key
+func HasDS(ds []dns.RR, key *dns.DNSKEY) bool {
+	for _, rr := range ds {
+		d, ok := rr.(*dns.DS)
+		if !ok {
+			continue
+		}
+		if keyDS := key.ToDS(d.DigestType); keyDS != nil && DSString(keyDS) == DSString(d) {
+			return true
+		}
+	}
+	return false
+}
+
 func FilterNsecBitmap(qtype uint16, bitmap []uint16) []uint16 {
 	res := make([]uint16, 0, len(bitmap))
 	for i := range bitmap {
@@ -68,7 +213,8 @@ func FilterNsecBitmap(qtype uint16, bitmap []uint16) []uint16 {
 	return res
 }
 
-func SignResponse(rrs []dns.RR, qname string, z *types.Zone) []dns.RR {
+// SignResponse adds signatures to authoritative rrsets of rrs, ns rrsets below apex are delegations and stay unsigned
+func SignResponse(rrs []dns.RR, z *types.Zone, sign Signer) []dns.RR {
 	var res []dns.RR
 	sets := types.SplitSets(rrs)
 	for _, set := range sets {
@@ -77,13 +223,30 @@ func SignResponse(rrs []dns.RR, qname string, z *types.Zone) []dns.RR {
 		case dns.TypeRRSIG, dns.TypeOPT:
 			continue
 		case dns.TypeDNSKEY:
-			res = append(res, z.DnsKeySig)
+			res = append(res, z.DnsKeySigs...)
+		case dns.TypeCDS, dns.TypeCDNSKEY:
+			// parent validates child keys against current ds so they are signed by ksks
+			res = append(res, signWithActiveKeys(set, z, KSKFlags, sign)...)
 		case dns.TypeNS:
-			if qname == z.Name {
-				res = append(res, SignRRSet(set, set[0].Header().Name, z.ZSK, set[0].Header().Ttl))
+			if set[0].Header().Name == z.Name {
+				res = append(res, signWithActiveKeys(set, z, ZSKFlags, sign)...)
 			}
 		default:
-			res = append(res, SignRRSet(set, set[0].Header().Name, z.ZSK, set[0].Header().Ttl))
+			res = append(res, signWithActiveKeys(set, z, ZSKFlags, sign)...)
+		}
+	}
+	return res
+}
+
+// signWithActiveKeys signs set with every signing key, there is more than one during algorithm rollovers
+func signWithActiveKeys(set []dns.RR, z *types.Zone, flags uint16, sign Signer) []dns.RR {
+	var res []dns.RR
+	for _, key := range z.Keys {
+		if !types.KeySigns(key.State) || key.DnsKey.Flags != flags {
+			continue
+		}
+		if rrsig := sign(set, set[0].Header().Name, key, set[0].Header().Ttl); rrsig != nil {
+			res = append(res, rrsig)
 		}
 	}
 	return res
@@ -109,6 +272,11 @@ func SignRRSet(rrs []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.R
 			zap.L().Error("sign failed", zap.Error(err))
 			return nil
 		}
+	case dns.ED25519:
+		if err := rrsig.Sign(key.PrivateKey.(ed25519.PrivateKey), rrs); err != nil {
+			zap.L().Error("sign failed", zap.Error(err))
+			return nil
+		}
 	case dns.DSA, dns.DSANSEC3SHA1:
 		//rrsig.Sign(zone.PrivateKey.(*dsa.PrivateKey), rrs)
 		fallthrough
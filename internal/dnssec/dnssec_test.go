@@ -0,0 +1,121 @@
+package dnssec
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"strings"
+	"testing"
+	"time"
+	"z42-core/internal/types"
+)
+
+func newTestKey(config *types.KeyAlgorithmConfig) *types.ZoneKey {
+	pub, priv, err := GenerateKey("example.com.", ZSKFlags, config)
+	Expect(err).To(BeNil())
+	rr, err := dns.NewRR(pub)
+	Expect(err).To(BeNil())
+	key := &types.ZoneKey{
+		DnsKey:        rr.(*dns.DNSKEY),
+		KeyInception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyExpiration: uint32(time.Now().Add(time.Hour).Unix()),
+		State:         types.KeyStateActive,
+	}
+	key.PrivateKey, err = key.DnsKey.NewPrivateKey(priv)
+	Expect(err).To(BeNil())
+	return key
+}
+
+func TestSignRRSetAlgorithms(t *testing.T) {
+	RegisterTestingT(t)
+	a, _ := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	for _, config := range []*types.KeyAlgorithmConfig{
+		nil,
+		{Algorithm: "ECDSAP384SHA384"},
+		{Algorithm: "ED25519"},
+		{Algorithm: "RSASHA256", Bits: 1024},
+	} {
+		key := newTestKey(config)
+		rrsig := SignRRSet([]dns.RR{a}, "www.example.com.", key, 300)
+		Expect(rrsig).NotTo(BeNil())
+		Expect(rrsig.Verify(key.DnsKey, []dns.RR{a})).To(BeNil())
+	}
+}
+
+func TestKeyAlgorithm(t *testing.T) {
+	RegisterTestingT(t)
+	algorithm, bits, err := KeyAlgorithm(nil)
+	Expect(err).To(BeNil())
+	Expect(algorithm).To(Equal(dns.ECDSAP256SHA256))
+	Expect(bits).To(Equal(256))
+
+	_, bits, err = KeyAlgorithm(&types.KeyAlgorithmConfig{Algorithm: "RSASHA256"})
+	Expect(err).To(BeNil())
+	Expect(bits).To(Equal(DefaultRSABits))
+
+	_, _, err = KeyAlgorithm(&types.KeyAlgorithmConfig{Algorithm: "RSASHA256", Bits: 8192})
+	Expect(err).NotTo(BeNil())
+	_, _, err = KeyAlgorithm(&types.KeyAlgorithmConfig{Algorithm: "RSASHA1"})
+	Expect(err).NotTo(BeNil())
+	_, _, err = KeyAlgorithm(&types.KeyAlgorithmConfig{Algorithm: "ed25519"})
+	Expect(err).NotTo(BeNil())
+}
+
+func TestSignResponseAlgorithmRollover(t *testing.T) {
+	RegisterTestingT(t)
+	a, _ := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	retired := newTestKey(nil)
+	retired.State = types.KeyStateRetired
+	// unpublished keys of other algorithm sign until their signatures expire from caches
+	signing := newTestKey(&types.KeyAlgorithmConfig{Algorithm: "ECDSAP384SHA384"})
+	signing.State = types.KeyStateSigning
+	z := &types.Zone{
+		Name: "example.com.",
+		Keys: []*types.ZoneKey{newTestKey(nil), newTestKey(&types.KeyAlgorithmConfig{Algorithm: "ED25519"}), retired, signing},
+	}
+	res := SignResponse([]dns.RR{a}, z, SignRRSet)
+	Expect(res).To(HaveLen(4))
+	Expect(res[1].(*dns.RRSIG).Verify(z.Keys[0].DnsKey, []dns.RR{a})).To(BeNil())
+	Expect(res[2].(*dns.RRSIG).Verify(z.Keys[1].DnsKey, []dns.RR{a})).To(BeNil())
+	Expect(res[3].(*dns.RRSIG).Verify(signing.DnsKey, []dns.RR{a})).To(BeNil())
+}
+
+func TestSignatureWindow(t *testing.T) {
+	RegisterTestingT(t)
+	now := time.Unix(1700000000, 0)
+	inception, expiration := SignatureWindow(now, nil)
+	later, _ := SignatureWindow(now.Add(time.Hour), nil)
+	Expect(later).To(Equal(inception))
+	Expect(inception).To(BeNumerically("<", now.Unix()))
+	Expect(expiration - inception).To(Equal(uint32(DefaultSignatureValidity + 3*3600)))
+
+	config := &types.SignatureConfig{Validity: 4 * 3600, Refresh: 2 * 3600}
+	Expect(SignatureConfigValid(config)).To(BeTrue())
+	_, expiration = SignatureWindow(now, config)
+	Expect(int64(expiration)).To(BeNumerically(">", now.Add(2*time.Hour).Unix()))
+	Expect(int64(expiration)).To(BeNumerically("<=", now.Add(4*time.Hour).Unix()))
+
+	Expect(SignatureConfigValid(&types.SignatureConfig{Validity: 3600, Refresh: 3600})).To(BeFalse())
+	Expect(SignatureConfigValid(&types.SignatureConfig{})).To(BeFalse())
+}
+
+func TestSignResponseDelegation(t *testing.T) {
+	RegisterTestingT(t)
+	apexNS, _ := dns.NewRR("example.com. 300 IN NS ns1.example.com.")
+	cutNS, _ := dns.NewRR("sub.example.com. 300 IN NS ns1.example.net.")
+	z := &types.Zone{Name: "example.com.", Keys: []*types.ZoneKey{newTestKey(nil)}}
+	Expect(SignResponse([]dns.RR{apexNS}, z, SignRRSet)).To(HaveLen(2))
+	Expect(SignResponse([]dns.RR{cutNS}, z, SignRRSet)).To(Equal([]dns.RR{cutNS}))
+}
+
+func TestHasDS(t *testing.T) {
+	RegisterTestingT(t)
+	key := newTestKey(nil).DnsKey
+	other := newTestKey(nil).DnsKey
+	ds := key.ToDS(dns.SHA256)
+	// digests are compared regardless of case
+	ds.Digest = strings.ToLower(ds.Digest)
+	Expect(HasDS([]dns.RR{other.ToDS(dns.SHA256), ds}, key)).To(BeTrue())
+	Expect(HasDS([]dns.RR{key.ToDS(dns.SHA1)}, key)).To(BeTrue())
+	Expect(HasDS([]dns.RR{other.ToDS(dns.SHA256)}, key)).To(BeFalse())
+	Expect(HasDS(nil, key)).To(BeFalse())
+}
@@ -0,0 +1,84 @@
+package dnssec
+
+import (
+	"encoding/base32"
+	"github.com/miekg/dns"
+	"strings"
+	"z42-core/internal/types"
+)
+
+const nsec3HashLength = 20
+
+var base32HexNoPad = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Nsec3Bitmap converts an nsec type bitmap for use in nsec3 records
+func Nsec3Bitmap(bitmap []uint16, apex bool) []uint16 {
+	res := make([]uint16, 0, len(bitmap))
+	for _, t := range bitmap {
+		if t == dns.TypeNSEC {
+			if apex {
+				res = append(res, dns.TypeNSEC3PARAM)
+			}
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// NSEC3 returns an nsec3 record matching name, next hashed owner is hash of name plus one
+func NSEC3(name string, zone string, config *types.NSEC3Config, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	hash := dns.HashName(name, config.Algorithm, config.Iterations, config.Salt)
+	return newNSEC3(hash, nextHash(hash, 1), zone, config, ttl, bitmap)
+}
+
+// CoveringNSEC3 returns an nsec3 record covering hash of name with no types set
+func CoveringNSEC3(name string, zone string, config *types.NSEC3Config, ttl uint32) *dns.NSEC3 {
+	hash := dns.HashName(name, config.Algorithm, config.Iterations, config.Salt)
+	return newNSEC3(nextHash(hash, -1), nextHash(hash, 1), zone, config, ttl, []uint16{})
+}
+
+func NSEC3Param(zone string, config *types.NSEC3Config, ttl uint32) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: zone, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: ttl},
+		Hash:       config.Algorithm,
+		Flags:      0,
+		Iterations: config.Iterations,
+		SaltLength: uint8(len(config.Salt) / 2),
+		Salt:       strings.ToUpper(config.Salt),
+	}
+}
+
+func newNSEC3(owner string, next string, zone string, config *types.NSEC3Config, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	var flags uint8
+	if config.OptOut {
+		flags = 1
+	}
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(owner) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+		Hash:       config.Algorithm,
+		Flags:      flags,
+		Iterations: config.Iterations,
+		SaltLength: uint8(len(config.Salt) / 2),
+		Salt:       strings.ToUpper(config.Salt),
+		HashLength: nsec3HashLength,
+		NextDomain: next,
+		TypeBitMap: bitmap,
+	}
+}
+
+// nextHash adds delta to a base32hex encoded hash treating it as a big endian number
+func nextHash(hash string, delta int) string {
+	b, err := base32HexNoPad.DecodeString(strings.ToUpper(hash))
+	if err != nil {
+		return hash
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		v := int(b[i]) + delta
+		b[i] = byte(v)
+		if v >= 0 && v <= 0xff {
+			break
+		}
+	}
+	return base32HexNoPad.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+package dnssec
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"z42-core/internal/types"
+)
+
+func TestNSEC3(t *testing.T) {
+	RegisterTestingT(t)
+	// rfc5155 appendix A
+	config := &types.NSEC3Config{Algorithm: dns.SHA1, Iterations: 12, Salt: "aabbccdd"}
+	nsec3 := NSEC3("example.", "example.", config, 300, Nsec3Bitmap(NsecBitmapAppex, true))
+	Expect(nsec3.Hdr.Name).To(Equal("0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example."))
+	Expect(nsec3.NextDomain).To(Equal("0P9MHAVEQVM6T7VBL5LOP2U3T2RP3TON"))
+	Expect(nsec3.Match("example.")).To(BeTrue())
+	Expect(nsec3.TypeBitMap).To(ContainElement(dns.TypeNSEC3PARAM))
+	Expect(nsec3.TypeBitMap).NotTo(ContainElement(dns.TypeNSEC))
+	Expect(nsec3.Flags).To(Equal(uint8(0)))
+	_, err := dns.PackRR(nsec3, make([]byte, 512), 0, nil, false)
+	Expect(err).To(BeNil())
+
+	config.OptOut = true
+	covering := CoveringNSEC3("a.example.", "example.", config, 300)
+	Expect(covering.Cover("a.example.")).To(BeTrue())
+	Expect(covering.Match("a.example.")).To(BeFalse())
+	Expect(covering.Flags).To(Equal(uint8(1)))
+	Expect(covering.TypeBitMap).To(BeEmpty())
+
+	param := NSEC3Param("example.", config, 300)
+	Expect(param.String()).To(Equal("example.\t300\tIN\tNSEC3PARAM\t1 0 12 AABBCCDD"))
+}
+
+func TestNextHash(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(nextHash("00000000000000000000000000000000", 1)).To(Equal("00000000000000000000000000000001"))
+	Expect(nextHash("00000000000000000000000000000001", -1)).To(Equal("00000000000000000000000000000000"))
+	Expect(nextHash("VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV", 1)).To(Equal("00000000000000000000000000000000"))
+	Expect(nextHash("00000000000000000000000000000000", -1)).To(Equal("VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV"))
+}
@@ -2,17 +2,20 @@ package healthcheck
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"fmt"
 	"z42-core/internal/storage"
 	"z42-core/internal/types"
 	"z42-core/pkg/workerpool"
+	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -43,6 +46,21 @@ func HandleHealthCheck(h *Healthcheck) workerpool.JobHandler {
 			timeout := time.Duration(item.Timeout) * time.Millisecond
 			url := item.Protocol + "://" + item.Ip + item.Uri
 			err = httpCheck(url, item.Host, timeout)
+		case "tcp":
+			if item.Port == 0 {
+				err = errors.New("port is missing")
+			} else {
+				err = tcpCheck(checkAddress(item), time.Duration(item.Timeout)*time.Millisecond)
+			}
+		case "dns":
+			query := item.Query
+			if query == "" {
+				query = item.Host
+			}
+			err = dnsCheck(checkAddress(item), query, item.QueryType, item.Rcode, item.Answer, time.Duration(item.Timeout)*time.Millisecond)
+		case "tls":
+			expiry := time.Duration(item.ExpiryDays) * 24 * time.Hour
+			err = tlsCheck(checkAddress(item), item.Host, expiry, item.SkipVerify, time.Duration(item.Timeout)*time.Millisecond)
 		case "ping", "icmp":
 			err = pingCheck(item.Ip, time.Duration(item.Timeout)*time.Millisecond)
 			zap.L().Error("icmp ping", zap.String("ip", item.Ip), zap.Error(err))
@@ -111,6 +129,101 @@ func httpCheck(url string, host string, timeout time.Duration) error {
 	}
 }
 
+var defaultPorts = map[string]int{
+	"dns": 53,
+	"tls": 443,
+}
+
+func checkAddress(item *types.HealthCheckItem) string {
+	port := item.Port
+	if port == 0 {
+		port = defaultPorts[item.Protocol]
+	}
+	return net.JoinHostPort(item.Ip, strconv.Itoa(port))
+}
+
+func tcpCheck(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// dnsCheck queries address for qname and expects rcode (default NOERROR), if answer is set one of
+// answers of qtype (default A) should have it as rdata
+func dnsCheck(address string, qname string, qtype string, rcode string, answer string, timeout time.Duration) error {
+	t := dns.TypeA
+	if qtype != "" {
+		var ok bool
+		if t, ok = dns.StringToType[strings.ToUpper(qtype)]; !ok {
+			return errors.New("invalid query type : " + qtype)
+		}
+	}
+	expected := dns.RcodeSuccess
+	if rcode != "" {
+		var ok bool
+		if expected, ok = dns.StringToRcode[strings.ToUpper(rcode)]; !ok {
+			return errors.New("invalid rcode : " + rcode)
+		}
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(qname), t)
+	client := &dns.Client{Timeout: timeout}
+	r, _, err := client.Exchange(m, address)
+	if err == nil && r.Truncated {
+		client.Net = "tcp"
+		r, _, err = client.Exchange(m, address)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Rcode != expected {
+		return errors.New(fmt.Sprintf("invalid rcode : %s", dns.RcodeToString[r.Rcode]))
+	}
+	if answer == "" {
+		return nil
+	}
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype != t {
+			continue
+		}
+		if strings.EqualFold(strings.TrimPrefix(rr.String(), rr.Header().String()), answer) {
+			return nil
+		}
+	}
+	return errors.New("expected answer not found : " + answer)
+}
+
+// tlsRootCAs is the pool tls checks verify chains against, nil means system roots
+var tlsRootCAs *x509.CertPool
+
+// tlsCheck completes a handshake with address and fails if certificate is not valid for at least expiry,
+// chain and host name are verified unless skipVerify is set
+func tlsCheck(address string, host string, expiry time.Duration, skipVerify bool, timeout time.Duration) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, &tls.Config{
+		InsecureSkipVerify: skipVerify,
+		ServerName:         strings.TrimRight(host, "."),
+		RootCAs:            tlsRootCAs,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("no certificate")
+	}
+	now := time.Now()
+	if now.Before(certs[0].NotBefore) {
+		return errors.New(fmt.Sprintf("certificate is not valid before %s", certs[0].NotBefore))
+	}
+	if now.Add(expiry).After(certs[0].NotAfter) {
+		return errors.New(fmt.Sprintf("certificate expires at %s", certs[0].NotAfter))
+	}
+	return nil
+}
+
 // FIXME: ping check is not working properly
 func pingCheck(ip string, timeout time.Duration) error {
 	c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
@@ -284,31 +397,7 @@ func (h *Healthcheck) FilterHealthcheck(qname string, rrset *types.IP_RRSet, mas
 	if !h.Enable {
 		return mask
 	}
-	min := rrset.HealthCheckConfig.DownCount
-	for i, x := range mask {
-		if x == types.IpMaskWhite {
-			status := h.redisStat.GetHealthStatus(qname, rrset.Data[i].Ip.String())
-			if status > min {
-				min = status
-			}
-		}
-	}
-	// zap.L().Debug("min", zap.Int(min))
-	if min < rrset.HealthCheckConfig.UpCount-1 && min > rrset.HealthCheckConfig.DownCount {
-		min = rrset.HealthCheckConfig.DownCount + 1
-	}
-	// zap.L().Debug("min", zap.Int(min))
-	for i, x := range mask {
-		if x == types.IpMaskWhite {
-			// zap.L().Debug("white", zap.String("qname", rrset.Data[i].Ip.String()), zap.String("status", h.getStatus(qname, rrset.Data[i].Ip)))
-			if h.redisStat.GetHealthStatus(qname, rrset.Data[i].Ip.String()) < min {
-				mask[i] = types.IpMaskBlack
-			}
-		} else {
-			mask[i] = types.IpMaskBlack
-		}
-	}
-	return mask
+	return h.redisStat.FilterHealthcheck(qname, rrset, mask)
 }
 
 func (h *Healthcheck) Transfer() {
@@ -318,7 +407,9 @@ func (h *Healthcheck) Transfer() {
 		}
 		if item1.Ip != item2.Ip || item1.Uri != item2.Uri || item1.Port != item2.Port ||
 			item1.Protocol != item2.Protocol || item1.Enable != item2.Enable ||
-			item1.UpCount != item2.UpCount || item1.DownCount != item2.DownCount || item1.Timeout != item2.Timeout {
+			item1.UpCount != item2.UpCount || item1.DownCount != item2.DownCount || item1.Timeout != item2.Timeout ||
+			item1.Query != item2.Query || item1.QueryType != item2.QueryType || item1.Rcode != item2.Rcode ||
+			item1.Answer != item2.Answer || item1.ExpiryDays != item2.ExpiryDays || item1.SkipVerify != item2.SkipVerify {
 			return false
 		}
 		return true
@@ -353,19 +444,25 @@ func (h *Healthcheck) Transfer() {
 							continue
 						}
 						for i := range rrset.Data {
-							fqdn := subdomain + "." + domain
+							fqdn := storage.HealthcheckHost(domain, subdomain)
 							key := fqdn + ":" + rrset.Data[i].Ip.String()
 							newItem := &types.HealthCheckItem{
-								Ip:        rrset.Data[i].Ip.String(),
-								Port:      rrset.HealthCheckConfig.Port,
-								Host:      fqdn,
-								Enable:    rrset.HealthCheckConfig.Enable,
-								DownCount: rrset.HealthCheckConfig.DownCount,
-								UpCount:   rrset.HealthCheckConfig.UpCount,
-								Timeout:   rrset.HealthCheckConfig.Timeout,
-								Uri:       rrset.HealthCheckConfig.Uri,
-								Protocol:  rrset.HealthCheckConfig.Protocol,
-								DomainId:  domainId,
+								Ip:         rrset.Data[i].Ip.String(),
+								Port:       rrset.HealthCheckConfig.Port,
+								Host:       fqdn,
+								Enable:     rrset.HealthCheckConfig.Enable,
+								DownCount:  rrset.HealthCheckConfig.DownCount,
+								UpCount:    rrset.HealthCheckConfig.UpCount,
+								Timeout:    rrset.HealthCheckConfig.Timeout,
+								Uri:        rrset.HealthCheckConfig.Uri,
+								Protocol:   rrset.HealthCheckConfig.Protocol,
+								Query:      rrset.HealthCheckConfig.Query,
+								QueryType:  rrset.HealthCheckConfig.QueryType,
+								Rcode:      rrset.HealthCheckConfig.Rcode,
+								Answer:     rrset.HealthCheckConfig.Answer,
+								ExpiryDays: rrset.HealthCheckConfig.ExpiryDays,
+								SkipVerify: rrset.HealthCheckConfig.SkipVerify,
+								DomainId:   domainId,
 							}
 							oldItem, err := h.redisStat.GetHealthcheckItem(key)
 							if err != nil || !itemsEqual(oldItem, newItem) {
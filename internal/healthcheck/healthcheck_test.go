@@ -1,11 +1,20 @@
 package healthcheck
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	redisCon "github.com/gomodule/redigo/redis"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/miekg/dns"
 	. "github.com/onsi/gomega"
 	"go.uber.org/zap"
 	"log"
+	"math/big"
 	"net"
 	"strconv"
 	"testing"
@@ -75,6 +84,7 @@ var healthcheckRedisDataConfig = storage.DataHandlerConfig{
 	ZoneReload:         60,
 	RecordCacheSize:    10000000,
 	RecordCacheTimeout: 1,
+	SignatureCacheSize: 100000,
 	MinTTL:             5,
 	MaxTTL:             300,
 	Redis: hiredis.Config{
@@ -124,6 +134,12 @@ func TestGet(t *testing.T) {
 		log.Println("[DEBUG]", stat, " ", stats[i])
 		Expect(stat).To(Equal(stats[i]))
 	}
+
+	// items not checked yet are a normal miss
+	_, err := h.redisStat.GetHealthcheckItem("missing.healthcheck.com.:1.2.3.4")
+	Expect(err).To(Equal(redisCon.ErrNil))
+	Expect(h.redisStat.GetHealthStatus("missing.healthcheck.com.", "1.2.3.4")).To(Equal(0))
+	Expect(h.redisStat.GetHealthStatus("missing.healthcheck.com.", "1.2.3.4")).To(Equal(0))
 	// h.Stop()
 	h.redisStat.Clear()
 }
@@ -475,3 +491,133 @@ func TestExpire(t *testing.T) {
 	status = hc.redisStat.GetHealthStatus("w0.healthcheck.exp.", "1.2.3.4")
 	Expect(status).To(Equal(0))
 }
+
+func TestTcpCheck(t *testing.T) {
+	RegisterTestingT(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	address := ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	Expect(tcpCheck(address, time.Second)).To(BeNil())
+	ln.Close()
+	Expect(tcpCheck(address, time.Second)).NotTo(BeNil())
+
+	_, port, _ := net.SplitHostPort(address)
+	item := &types.HealthCheckItem{Ip: "127.0.0.1", Protocol: "tcp"}
+	item.Port, _ = strconv.Atoi(port)
+	Expect(checkAddress(item)).To(Equal(address))
+	Expect(checkAddress(&types.HealthCheckItem{Ip: "::1", Protocol: "dns"})).To(Equal("[::1]:53"))
+}
+
+func TestDnsCheck(t *testing.T) {
+	RegisterTestingT(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name != "www.healthcheck.com." {
+			m.Rcode = dns.RcodeNameError
+		} else if r.Question[0].Qtype == dns.TypeA {
+			rr, _ := dns.NewRR("www.healthcheck.com. 300 IN A 1.2.3.4")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	address := pc.LocalAddr().String()
+
+	Expect(dnsCheck(address, "www.healthcheck.com.", "", "", "", time.Second)).To(BeNil())
+	Expect(dnsCheck(address, "www.healthcheck.com", "a", "noerror", "1.2.3.4", time.Second)).To(BeNil())
+	Expect(dnsCheck(address, "www.healthcheck.com.", "A", "", "4.3.2.1", time.Second)).NotTo(BeNil())
+	Expect(dnsCheck(address, "www.healthcheck.com.", "AAAA", "", "1.2.3.4", time.Second)).NotTo(BeNil())
+	Expect(dnsCheck(address, "nx.healthcheck.com.", "A", "", "", time.Second)).NotTo(BeNil())
+	Expect(dnsCheck(address, "nx.healthcheck.com.", "A", "NXDOMAIN", "", time.Second)).To(BeNil())
+	Expect(dnsCheck(address, "www.healthcheck.com.", "XYZ", "", "", time.Second)).NotTo(BeNil())
+	Expect(dnsCheck(address, "www.healthcheck.com.", "A", "XYZ", "", time.Second)).NotTo(BeNil())
+}
+
+func TestTlsCheck(t *testing.T) {
+	RegisterTestingT(t)
+	roots := x509.NewCertPool()
+	listen := func(notAfter time.Time) net.Listener {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "www.healthcheck.com"},
+			DNSNames:     []string{"www.healthcheck.com", "healthcheck.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).To(BeNil())
+		cert, err := x509.ParseCertificate(der)
+		Expect(err).To(BeNil())
+		roots.AddCert(cert)
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		})
+		Expect(err).To(BeNil())
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		return ln
+	}
+
+	valid := listen(time.Now().Add(30 * 24 * time.Hour))
+	defer valid.Close()
+	expired := listen(time.Now().Add(-time.Minute))
+	defer expired.Close()
+
+	// self-signed certificates are not trusted by system roots
+	Expect(tlsCheck(valid.Addr().String(), "www.healthcheck.com.", 0, false, time.Second)).NotTo(BeNil())
+	Expect(tlsCheck(valid.Addr().String(), "www.healthcheck.com.", 0, true, time.Second)).To(BeNil())
+
+	tlsRootCAs = roots
+	defer func() { tlsRootCAs = nil }()
+	Expect(tlsCheck(valid.Addr().String(), "www.healthcheck.com.", 0, false, time.Second)).To(BeNil())
+	Expect(tlsCheck(valid.Addr().String(), "www.healthcheck.com.", 7*24*time.Hour, false, time.Second)).To(BeNil())
+	Expect(tlsCheck(valid.Addr().String(), "www.healthcheck.com.", 60*24*time.Hour, false, time.Second)).NotTo(BeNil())
+	Expect(tlsCheck(valid.Addr().String(), "mail.healthcheck.com.", 0, false, time.Second)).NotTo(BeNil())
+	Expect(tlsCheck(valid.Addr().String(), "mail.healthcheck.com.", 0, true, time.Second)).To(BeNil())
+
+	// apex records are checked with zone name
+	apex := storage.HealthcheckHost("healthcheck.com.", "@")
+	Expect(apex).To(Equal("healthcheck.com."))
+	Expect(tlsCheck(valid.Addr().String(), apex, 0, false, time.Second)).To(BeNil())
+
+	Expect(tlsCheck(expired.Addr().String(), "www.healthcheck.com.", 0, false, time.Second)).NotTo(BeNil())
+	Expect(tlsCheck(expired.Addr().String(), "www.healthcheck.com.", 0, true, time.Second)).NotTo(BeNil())
+
+	// plain tcp listeners fail handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	Expect(tlsCheck(ln.Addr().String(), "www.healthcheck.com.", 0, true, time.Second)).NotTo(BeNil())
+}
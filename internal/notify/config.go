@@ -0,0 +1,20 @@
+package notify
+
+type Config struct {
+	Enable     bool `json:"enable"`
+	Timeout    int  `json:"timeout"`
+	Retries    int  `json:"retries"`
+	RetryDelay int  `json:"retry_delay"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enable:     false,
+		Timeout:    2000,
+		Retries:    5,
+		RetryDelay: 1000,
+	}
+}
+
+func (_ Config) Verify() {
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"errors"
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+	"time"
+	"z42-core/internal/api/database"
+	"z42-core/internal/storage"
+	"z42-core/internal/types"
+)
+
+// zoneConfigReader is the part of storage notifier reads zone serials and targets from
+type zoneConfigReader interface {
+	ReadZoneConfig(zone string) (*types.ZoneConfig, error)
+}
+
+type target struct {
+	zone    string
+	address string
+}
+
+// Notifier sends NOTIFY messages to zone also_notify targets after zone changes
+type Notifier struct {
+	Enable     bool
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	redisData  zoneConfigReader
+	// in-flight targets, value is true if another notify is requested while sending
+	inflight map[target]bool
+	lock     sync.Mutex
+	quit     chan struct{}
+	quitWG   sync.WaitGroup
+}
+
+func NewNotifier(config *Config, redisData *storage.DataHandler) *Notifier {
+	n := &Notifier{
+		Enable:     config.Enable,
+		timeout:    time.Duration(config.Timeout) * time.Millisecond,
+		retries:    config.Retries,
+		retryDelay: time.Duration(config.RetryDelay) * time.Millisecond,
+		redisData:  redisData,
+		inflight:   make(map[target]bool),
+		quit:       make(chan struct{}),
+	}
+	return n
+}
+
+func (n *Notifier) ShutDown() {
+	if !n.Enable {
+		return
+	}
+	close(n.quit)
+	n.quitWG.Wait()
+}
+
+// EventApplied notifies also_notify targets of the zone changed by event
+func (n *Notifier) EventApplied(event database.Event) {
+	if !n.Enable {
+		return
+	}
+	switch event.Type {
+	case database.DeleteZone, database.AddTSIGKey, database.UpdateTSIGKey, database.DeleteTSIGKey:
+		return
+	}
+	zone, err := eventZone(event)
+	if err != nil {
+		zap.L().Error("cannot get event zone", zap.Int("revision", event.Revision), zap.Error(err))
+		return
+	}
+	config, err := n.redisData.ReadZoneConfig(zone)
+	if err != nil {
+		zap.L().Error("cannot load zone config", zap.String("zone", zone), zap.Error(err))
+		return
+	}
+	for _, address := range config.AlsoNotify {
+		n.notify(target{zone: zone, address: serverAddress(address)})
+	}
+}
+
+func (n *Notifier) notify(t target) {
+	n.lock.Lock()
+	if _, ok := n.inflight[t]; ok {
+		n.inflight[t] = true
+		n.lock.Unlock()
+		return
+	}
+	n.inflight[t] = false
+	n.lock.Unlock()
+
+	n.quitWG.Add(1)
+	go func() {
+		defer n.quitWG.Done()
+		for {
+			n.send(t)
+			n.lock.Lock()
+			if !n.inflight[t] {
+				delete(n.inflight, t)
+				n.lock.Unlock()
+				return
+			}
+			n.inflight[t] = false
+			n.lock.Unlock()
+		}
+	}()
+}
+
+// send sends a NOTIFY with current zone serial, retrying with exponential backoff until target acknowledges it
+func (n *Notifier) send(t target) {
+	config, err := n.redisData.ReadZoneConfig(t.zone)
+	if err != nil {
+		zap.L().Error("cannot load zone config", zap.String("zone", t.zone), zap.Error(err))
+		return
+	}
+	m := new(dns.Msg)
+	m.SetNotify(t.zone)
+	m.Answer = []dns.RR{config.SOA.Data}
+	client := &dns.Client{
+		Net:     "udp",
+		Timeout: n.timeout,
+	}
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		resp, _, err := client.Exchange(m, t.address)
+		if err == nil && resp.Rcode != dns.RcodeSuccess {
+			err = errors.New("target returned " + dns.RcodeToString[resp.Rcode])
+		}
+		if err == nil {
+			zap.L().Info(
+				"notify acknowledged",
+				zap.String("zone", t.zone),
+				zap.String("target", t.address),
+				zap.Uint32("serial", config.SOA.Serial),
+				zap.Int("attempts", attempt),
+			)
+			return
+		}
+		if attempt > n.retries {
+			zap.L().Error(
+				"notify not acknowledged",
+				zap.String("zone", t.zone),
+				zap.String("target", t.address),
+				zap.Uint32("serial", config.SOA.Serial),
+				zap.Int("attempts", attempt),
+				zap.Error(err),
+			)
+			return
+		}
+		select {
+		case <-n.quit:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func serverAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(server, "53")
+}
+
+func eventZone(event database.Event) (string, error) {
+	var value struct {
+		Name     string `json:"name"`
+		ZoneName string `json:"zone_name"`
+	}
+	if err := jsoniter.Unmarshal([]byte(event.Value), &value); err != nil {
+		return "", err
+	}
+	switch event.Type {
+	case database.AddZone, database.UpdateZone, database.DeleteZone, database.ImportZone:
+		return value.Name, nil
+	case database.AddLocation, database.UpdateLocation, database.DeleteLocation,
+		database.AddRecord, database.UpdateRecord, database.DeleteRecord,
+		database.AddTSIGKey, database.UpdateTSIGKey, database.DeleteTSIGKey:
+		return value.ZoneName, nil
+	default:
+		return "", errors.New("invalid event type: " + string(event.Type))
+	}
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"z42-core/internal/api/database"
+	"z42-core/internal/types"
+)
+
+func TestEventZone(t *testing.T) {
+	RegisterTestingT(t)
+	zone, err := eventZone(database.Event{Type: database.UpdateZone, Value: `{"name":"example.com.","enabled":true}`})
+	Expect(err).To(BeNil())
+	Expect(zone).To(Equal("example.com."))
+
+	zone, err = eventZone(database.Event{Type: database.AddRecord, Value: `{"zone_name":"example.com.","location":"www","type":"a"}`})
+	Expect(err).To(BeNil())
+	Expect(zone).To(Equal("example.com."))
+
+	zone, err = eventZone(database.Event{Type: database.DeleteLocation, Value: `{"zone_name":"example.com.","location":"www"}`})
+	Expect(err).To(BeNil())
+	Expect(zone).To(Equal("example.com."))
+
+	_, err = eventZone(database.Event{Type: "foo", Value: `{}`})
+	Expect(err).NotTo(BeNil())
+
+	_, err = eventZone(database.Event{Type: database.AddZone, Value: `invalid`})
+	Expect(err).NotTo(BeNil())
+}
+
+func TestServerAddress(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(serverAddress("192.0.2.1")).To(Equal("192.0.2.1:53"))
+	Expect(serverAddress("192.0.2.1:5353")).To(Equal("192.0.2.1:5353"))
+	Expect(serverAddress("2001:db8::1")).To(Equal("[2001:db8::1]:53"))
+	Expect(serverAddress("[2001:db8::1]:5353")).To(Equal("[2001:db8::1]:5353"))
+}
+
+type testZoneConfigs map[string]string
+
+func (c testZoneConfigs) ReadZoneConfig(zone string) (*types.ZoneConfig, error) {
+	return types.ZoneConfigFromJson(zone, c[zone]), nil
+}
+
+func TestNotify(t *testing.T) {
+	RegisterTestingT(t)
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	// secondary drops first two notifies
+	var (
+		lock     sync.Mutex
+		received []time.Time
+	)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Opcode != dns.OpcodeNotify {
+			return
+		}
+		lock.Lock()
+		received = append(received, time.Now())
+		count := len(received)
+		lock.Unlock()
+		if count <= 2 {
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Timeout = 100
+	config.RetryDelay = 20
+	n := NewNotifier(&config, nil)
+	n.redisData = testZoneConfigs{
+		"example.com.": `{"soa":{"ttl":300,"minttl":100,"mbox":"hostmaster.example.com.","ns":"ns1.example.com.","refresh":44,"retry":55,"expire":66,"serial":10},"also_notify":["` + pc.LocalAddr().String() + `"]}`,
+	}
+	defer n.ShutDown()
+
+	// events while a notify is in flight are sent once after it, by the same sender
+	event := database.Event{Type: database.UpdateZone, Value: `{"name":"example.com."}`}
+	n.EventApplied(event)
+	n.EventApplied(event)
+	n.EventApplied(event)
+	Eventually(func() int {
+		n.lock.Lock()
+		defer n.lock.Unlock()
+		return len(n.inflight)
+	}, 3*time.Second, 10*time.Millisecond).Should(BeZero())
+
+	lock.Lock()
+	defer lock.Unlock()
+	Expect(received).To(HaveLen(4))
+	// retries wait for timeout and a doubling delay
+	Expect(received[1].Sub(received[0])).To(BeNumerically(">=", 120*time.Millisecond))
+	Expect(received[2].Sub(received[1])).To(BeNumerically(">=", 140*time.Millisecond))
+
+	acks := logs.FilterMessage("notify acknowledged").All()
+	Expect(acks).To(HaveLen(2))
+	Expect(acks[0].ContextMap()["attempts"]).To(Equal(int64(3)))
+	Expect(acks[0].ContextMap()["serial"]).To(Equal(uint32(10)))
+	Expect(acks[1].ContextMap()["attempts"]).To(Equal(int64(1)))
+	Expect(logs.FilterMessage("notify not acknowledged").All()).To(BeEmpty())
+}
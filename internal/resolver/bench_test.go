@@ -34,7 +34,7 @@ func TestMain(m *testing.M) {
 	r := storage.NewDataHandler(&DefaultRedisDataTestConfig)
 	r.Start()
 	l, _ := zap.NewProduction()
-	benchTestHandler = NewHandler(&DefaultHandlerTestConfig, r, l)
+	benchTestHandler = NewHandler(&DefaultHandlerTestConfig, r, nil, l)
 	err := r.Clear()
 	log.Println(err)
 	err = r.EnableZone(benchZone)
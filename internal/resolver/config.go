@@ -7,13 +7,28 @@ import (
 	"z42-core/configs"
 	"z42-core/internal/upstream"
 	"z42-core/pkg/geoip"
+	"z42-core/pkg/ratelimit"
 )
 
 type Config struct {
-	Upstream          []upstream.Config `json:"upstream"`
-	GeoIp             geoip.Config      `json:"geoip"`
-	CookieSecret      string            `json:"cookie_secret"`
-	LogSourceLocation bool              `json:"log_source_location"`
+	Upstream          []upstream.Config                 `json:"upstream"`
+	GeoIp             geoip.Config                      `json:"geoip"`
+	CookieSecret      string                            `json:"cookie_secret"`
+	LogSourceLocation bool                              `json:"log_source_location"`
+	DynamicUpdate     UpdateConfig                      `json:"dynamic_update"`
+	ResponseRateLimit ratelimit.ResponseRateLimitConfig `json:"response_ratelimit"`
+	ClientSubnet      ClientSubnetConfig                `json:"client_subnet"`
+}
+
+// ClientSubnetConfig limits how much of edns client subnet address is used, longer source prefixes are truncated
+type ClientSubnetConfig struct {
+	IPv4SourcePrefix int `json:"ipv4_source_prefix"`
+	IPv6SourcePrefix int `json:"ipv6_source_prefix"`
+}
+
+type UpdateConfig struct {
+	Enable             bool   `json:"enable"`
+	DBConnectionString string `json:"db_connection_string"`
 }
 
 func DefaultDnsRequestHandlerConfig() Config {
@@ -22,6 +37,15 @@ func DefaultDnsRequestHandlerConfig() Config {
 		GeoIp:             geoip.DefaultConfig(),
 		LogSourceLocation: false,
 		CookieSecret:      "000102030405060708090a0b0c0d0e0f",
+		DynamicUpdate: UpdateConfig{
+			Enable:             false,
+			DBConnectionString: "root:root@tcp(127.0.0.1:3306)/z42",
+		},
+		ResponseRateLimit: ratelimit.DefaultResponseRateLimitConfig(),
+		ClientSubnet: ClientSubnetConfig{
+			IPv4SourcePrefix: 24,
+			IPv6SourcePrefix: 56,
+		},
 	}
 }
 
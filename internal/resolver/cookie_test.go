@@ -14,7 +14,7 @@ func TestCookie(t *testing.T) {
 	r := storage.NewDataHandler(&DefaultRedisDataTestConfig)
 	r.Start()
 	l, _ := zap.NewProduction()
-	h := NewHandler(&DefaultHandlerTestConfig, r, l)
+	h := NewHandler(&DefaultHandlerTestConfig, r, nil, l)
 	err := h.RedisData.Clear()
 	Expect(err).To(BeNil())
 	err = r.EnableZone("example.com.")
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 	"z42-core/internal/dnssec"
 	"z42-core/internal/storage"
 	"z42-core/internal/test"
@@ -20,7 +21,7 @@ func DefaultDnssecInitialize() func(testCase *TestCase) (requestHandler *DnsRequ
 		r := storage.NewDataHandler(&DefaultRedisDataTestConfig)
 		r.Start()
 		l, _ := zap.NewProduction()
-		h := NewHandler(&testCase.HandlerConfig, r, l)
+		h := NewHandler(&testCase.HandlerConfig, r, nil, l)
 		if err := h.RedisData.Clear(); err != nil {
 			return nil, err
 		}
@@ -37,7 +38,7 @@ func DefaultDnssecInitialize() func(testCase *TestCase) (requestHandler *DnsRequ
 			if err := r.SetZoneConfigFromJson(zone, testCase.ZoneConfigs[i]); err != nil {
 				return nil, err
 			}
-			keys, _ := dnssec.GenerateKeys(zone)
+			keys, _ := dnssec.GenerateKeys(zone, nil)
 			if err := h.RedisData.SetZoneKey(zone, "zsk", keys.ZSKPublic, keys.ZSKPrivate); err != nil {
 				zap.L().Error("cannot set zsk", zap.Error(err))
 			}
@@ -108,11 +109,15 @@ func DefaultDnssecApplyAndVerify(testCase *TestCase, requestHandler *DnsRequestH
 		state := NewRequestContext(w, r)
 		requestHandler.HandleRequest(state)
 		resp := w.Msg
+		if tc.Do {
+			Expect(validateResponse(resp, testCase.Zones[0], []*dns.DNSKEY{zsk.(*dns.DNSKEY), ksk.(*dns.DNSKEY)})).To(BeNil(), tc.Desc)
+		}
 		for _, section := range []struct {
 			rrs       []dns.RR
 			tcSection string
 		}{
-			{rrs: tc0.Answer}, {rrs: tc0.Ns}, {rrs: resp.Answer, tcSection: "answer"}, {rrs: resp.Ns, tcSection: "ns"},
+			{rrs: tc0.Answer}, {rrs: tc0.Ns}, {rrs: tc0.Extra},
+			{rrs: resp.Answer, tcSection: "answer"}, {rrs: resp.Ns, tcSection: "ns"}, {rrs: resp.Extra, tcSection: "extra"},
 		} {
 			sets := types.SplitSets(section.rrs)
 			rrsigs := make(map[types.RRSetKey]*dns.RRSIG)
@@ -139,6 +144,8 @@ func DefaultDnssecApplyAndVerify(testCase *TestCase, requestHandler *DnsRequestH
 					tc.Answer = append(tc.Answer, rrsig)
 				case "ns":
 					tc.Ns = append(tc.Ns, rrsig)
+				case "extra":
+					tc.Extra = append(tc.Extra, rrsig)
 				}
 			}
 		}
@@ -152,6 +159,99 @@ func DefaultDnssecApplyAndVerify(testCase *TestCase, requestHandler *DnsRequestH
 	}
 }
 
+// validateResponse checks resp the way a validating resolver would: authoritative rrsets carry valid signatures of zone keys,
+// delegation ns and glue below zone cuts are unsigned and insecure delegations come with a proof of missing ds
+// insecureBitmap reports whether bitmap of a delegation has ns and no ds
+func insecureBitmap(bitmap []uint16) bool {
+	hasNS, hasDS := false, false
+	for _, t := range bitmap {
+		hasNS = hasNS || t == dns.TypeNS
+		hasDS = hasDS || t == dns.TypeDS
+	}
+	return hasNS && !hasDS
+}
+
+func validateResponse(resp *dns.Msg, zone string, keys []*dns.DNSKEY) error {
+	var cuts []string
+	for _, rr := range resp.Ns {
+		if rr.Header().Rrtype == dns.TypeNS && rr.Header().Name != zone {
+			cuts = append(cuts, rr.Header().Name)
+		}
+	}
+	delegated := func(name string, qtype uint16) bool {
+		for _, cut := range cuts {
+			if name == cut {
+				return qtype == dns.TypeNS
+			}
+			if dns.IsSubDomain(cut, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	now := time.Now()
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		rrsigs := make(map[types.RRSetKey][]*dns.RRSIG)
+		for _, rr := range section {
+			if rrsig, ok := rr.(*dns.RRSIG); ok {
+				key := types.RRSetKey{QName: rrsig.Hdr.Name, QType: rrsig.TypeCovered}
+				rrsigs[key] = append(rrsigs[key], rrsig)
+			}
+		}
+		for key, set := range types.SplitSets(section) {
+			if delegated(key.QName, key.QType) {
+				if len(rrsigs[key]) != 0 {
+					return fmt.Errorf("unexpected signature for %s %s", key.QName, dns.TypeToString[key.QType])
+				}
+				continue
+			}
+			if len(rrsigs[key]) == 0 {
+				return fmt.Errorf("missing signature for %s %s", key.QName, dns.TypeToString[key.QType])
+			}
+			for _, rrsig := range rrsigs[key] {
+				if !rrsig.ValidityPeriod(now) {
+					return fmt.Errorf("signature for %s %s is not in validity period", key.QName, dns.TypeToString[key.QType])
+				}
+				verified := false
+				for _, dnskey := range keys {
+					if dnskey.KeyTag() == rrsig.KeyTag && dnskey.Algorithm == rrsig.Algorithm && rrsig.Verify(dnskey, set) == nil {
+						verified = true
+					}
+				}
+				if !verified {
+					return fmt.Errorf("bad signature for %s %s", key.QName, dns.TypeToString[key.QType])
+				}
+			}
+		}
+	}
+
+	for _, cut := range cuts {
+		secure, proved := false, false
+		for _, rr := range resp.Ns {
+			switch rr := rr.(type) {
+			case *dns.DS:
+				secure = secure || rr.Hdr.Name == cut
+			case *dns.NSEC:
+				if rr.Hdr.Name == cut {
+					proved = proved || insecureBitmap(rr.TypeBitMap)
+				}
+			case *dns.NSEC3:
+				if rr.Match(cut) {
+					proved = proved || insecureBitmap(rr.TypeBitMap)
+				} else if rr.Cover(cut) {
+					// opt-out span covering next closer name (rfc5155 section 8.9)
+					proved = proved || rr.Flags&1 == 1
+				}
+			}
+		}
+		if !secure && !proved {
+			return fmt.Errorf("missing proof of insecure delegation %s", cut)
+		}
+	}
+	return nil
+}
+
 var dnssecTestCases = []*TestCase{
 	{
 		Name:           "dnssec test",
@@ -409,6 +509,14 @@ var dnssecTestCases = []*TestCase{
 				{"ns1.b",
 					`{"a":{"ttl":3600, "records":[{"ip":"192.0.2.7"}]}}`,
 				},
+				{"c",
+					`{
+						"ns":{"ttl":3600, "records":[{"host":"ns1.example."},{"host":"ns1.c.example."}]}
+					}`,
+				},
+				{"ns1.c",
+					`{"a":{"ttl":3600, "records":[{"ip":"192.0.2.11"}]}}`,
+				},
 				{"ns2.b",
 					`{"a":{"ttl":3600, "records":[{"ip":"192.0.2.8"}]}}`,
 				},
@@ -468,7 +576,7 @@ var dnssecTestCases = []*TestCase{
 				Qtype: dns.TypeMX,
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
-					test.NSEC("ns1.example. 3600 IN NSEC \\000.ns1.example. A CNAME PTR TXT AAAA SRV RRSIG NSEC TLSA CAA"),
+					test.NSEC("ns1.example. 3600 IN NSEC \\000.ns1.example. A CNAME PTR HINFO TXT AAAA LOC SRV NAPTR CERT SSHFP RRSIG NSEC TLSA OPENPGPKEY SVCB HTTPS URI CAA"),
 				},
 				Do: true,
 				Extra: []dns.RR{
@@ -507,6 +615,35 @@ var dnssecTestCases = []*TestCase{
 				},
 				Do: true,
 			},
+			{
+				Desc:  "Referral with in-zone and occluded name servers",
+				Qname: "mc.c.example.",
+				Qtype: dns.TypeMX,
+				Ns: []dns.RR{
+					test.NS("c.example. 3600 IN NS ns1.example."),
+					test.NS("c.example. 3600 IN NS ns1.c.example."),
+					test.NSEC("c.example. 3600 NSEC \\000.c.example. NS RRSIG NSEC"),
+				},
+				Extra: []dns.RR{
+					test.A("ns1.example. 3600 IN A   192.0.2.1"),
+					test.A("ns1.c.example. 3600 IN A   192.0.2.11"),
+					test.OPT(4096, true),
+				},
+				Do: true,
+			},
+			{
+				Desc:  "QTYPE=DS query for an unsigned delegation",
+				Qname: "b.example.",
+				Qtype: dns.TypeDS,
+				Ns: []dns.RR{
+					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
+					test.NSEC("b.example. 3600 IN NSEC \\000.b.example. NS RRSIG NSEC"),
+				},
+				Extra: []dns.RR{
+					test.OPT(4096, true),
+				},
+				Do: true,
+			},
 			{
 				Desc:  "A successful query that was answered via wildcard expansion",
 				Qname: "a.z.w.example.",
@@ -525,7 +662,7 @@ var dnssecTestCases = []*TestCase{
 				Qtype: dns.TypeAAAA,
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
-					test.NSEC("a.z.w.example. 3600 IN NSEC \\000.a.z.w.example. A CNAME PTR MX TXT SRV RRSIG NSEC TLSA CAA"),
+					test.NSEC("a.z.w.example. 3600 IN NSEC \\000.a.z.w.example. A CNAME PTR HINFO MX TXT LOC SRV NAPTR CERT SSHFP RRSIG NSEC TLSA OPENPGPKEY SVCB HTTPS URI CAA"),
 				},
 				Extra: []dns.RR{
 					test.OPT(4096, true),
@@ -538,7 +675,7 @@ var dnssecTestCases = []*TestCase{
 				Qtype: dns.TypeDS,
 				Ns: []dns.RR{
 					test.SOA("example. 3600 IN SOA ns1.example. bugs.x.w.example. 1081539377 3600 300 3600000 3600"),
-					test.NSEC("example.	3600	IN	NSEC	\\000.example. A NS SOA PTR MX TXT AAAA SRV RRSIG NSEC TLSA CAA"),
+					test.NSEC("example.	3600	IN	NSEC	\\000.example. A NS SOA PTR HINFO MX TXT AAAA LOC SRV NAPTR CERT SSHFP RRSIG NSEC TLSA OPENPGPKEY SVCB HTTPS URI CAA"),
 				},
 				Extra: []dns.RR{
 					test.OPT(4096, true),
@@ -549,9 +686,99 @@ var dnssecTestCases = []*TestCase{
 	},
 }
 
+var nsec3TestCase = &TestCase{
+	Name:           "nsec3 test",
+	Description:    "test nsec3 denial of existence",
+	Enabled:        true,
+	HandlerConfig:  DefaultHandlerTestConfig,
+	Initialize:     DefaultDnssecInitialize(),
+	ApplyAndVerify: DefaultDnssecApplyAndVerify,
+	Zones:          []string{"nsec3_test.com."},
+	ZoneConfigs:    []string{`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.nsec3_test.com.","ns":"ns1.nsec3_test.com.","refresh":44,"retry":55,"expire":66},"dnssec": true, "nsec3":{"algorithm":1, "iterations":1, "salt":"abcd", "opt_out":true}}`},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300,"records":[{"host":"ns1.nsec3_test.com."},{"host":"ns2.nsec3_test.com."}]}}`,
+			},
+			{"x",
+				`{"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]}}`,
+			},
+			{"y",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.example.net."}]}}`,
+			},
+			{"d.e.f",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.example.net."}]}}`,
+			},
+		},
+	},
+	TestCases: []test.Case{
+		{
+			Desc:  "NXDOMAIN",
+			Qname: "nxdomain.nsec3_test.com.", Qtype: dns.TypeA,
+			Ns: []dns.RR{
+				test.SOA("nsec3_test.com.	300	IN	SOA	ns1.nsec3_test.com. hostmaster.nsec3_test.com. 1533107621 44 55 66 100"),
+				test.NSEC3("c93otamq82gcfu0gq48sg0q5per2pmg7.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD C93OTAMQ82GCFU0GQ48SG0Q5PER2PMG8 RRSIG"),
+			},
+			Do: true,
+			Extra: []dns.RR{
+				test.OPT(4096, true),
+			},
+		},
+		{
+			Desc:  "NODATA",
+			Qname: "x.nsec3_test.com.", Qtype: dns.TypeAAAA,
+			Ns: []dns.RR{
+				test.SOA("nsec3_test.com.	300	IN	SOA	ns1.nsec3_test.com. hostmaster.nsec3_test.com. 1533107621 44 55 66 100"),
+				test.NSEC3("qop7bg1ipbkklnebieev8bk5j5ug01oe.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD QOP7BG1IPBKKLNEBIEEV8BK5J5UG01OF A CNAME PTR HINFO MX TXT LOC SRV NAPTR CERT SSHFP RRSIG TLSA OPENPGPKEY SVCB HTTPS URI CAA"),
+			},
+			Do: true,
+			Extra: []dns.RR{
+				test.OPT(4096, true),
+			},
+		},
+		{
+			Desc:  "opt-out insecure delegation",
+			Qname: "a.y.nsec3_test.com.", Qtype: dns.TypeA,
+			Ns: []dns.RR{
+				test.NS("y.nsec3_test.com. 300 IN NS ns1.example.net."),
+				test.NSEC3("er50apdm0n9q7jqkead3lblj4q1ong49.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD ER50APDM0N9Q7JQKEAD3LBLJ4Q1ONG4A A NS SOA PTR HINFO MX TXT AAAA LOC SRV NAPTR CERT SSHFP RRSIG NSEC3PARAM TLSA OPENPGPKEY SVCB HTTPS URI CAA"),
+				test.NSEC3("dthd5c9ppndqlqq876bsauo2okdrt839.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD DTHD5C9PPNDQLQQ876BSAUO2OKDRT83B"),
+			},
+			Do: true,
+			Extra: []dns.RR{
+				test.OPT(4096, true),
+			},
+		},
+		{
+			Desc:  "opt-out insecure delegation below empty non-terminals",
+			Qname: "a.d.e.f.nsec3_test.com.", Qtype: dns.TypeA,
+			Ns: []dns.RR{
+				test.NS("d.e.f.nsec3_test.com. 300 IN NS ns1.example.net."),
+				test.NSEC3("upuaoq75oeng8strufip32j7qps30hpr.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD UPUAOQ75OENG8STRUFIP32J7QPS30HPS"),
+				test.NSEC3("12hheqv670joos5tnnijg2fqg219vg9g.nsec3_test.com. 100 IN NSEC3 1 1 1 ABCD 12HHEQV670JOOS5TNNIJG2FQG219VG9I"),
+			},
+			Do: true,
+			Extra: []dns.RR{
+				test.OPT(4096, true),
+			},
+		},
+		{
+			Desc:  "NSEC3PARAM",
+			Qname: "nsec3_test.com.", Qtype: dns.TypeNSEC3PARAM,
+			Answer: []dns.RR{
+				test.NSEC3PARAM("nsec3_test.com. 100 IN NSEC3PARAM 1 0 1 ABCD"),
+			},
+			Do: true,
+			Extra: []dns.RR{
+				test.OPT(4096, true),
+			},
+		},
+	},
+}
+
 func TestAllDnssec(t *testing.T) {
 	RegisterTestingT(t)
-	for _, testCase := range dnssecTestCases {
+	for _, testCase := range append(dnssecTestCases, nsec3TestCase) {
 		if !testCase.Enabled {
 			continue
 		}
@@ -564,3 +791,52 @@ func TestAllDnssec(t *testing.T) {
 		fmt.Println(strings.Repeat("-", 80))
 	}
 }
+
+func TestChildKeys(t *testing.T) {
+	RegisterTestingT(t)
+	testCase := &TestCase{
+		HandlerConfig: DefaultHandlerTestConfig,
+		Zones:         []string{"cds_test.com.", "cds_delete_test.com."},
+		ZoneConfigs: []string{
+			`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.cds_test.com.","ns":"ns1.cds_test.com.","refresh":44,"retry":55,"expire":66},"dnssec": true}`,
+			`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.cds_delete_test.com.","ns":"ns1.cds_delete_test.com.","refresh":44,"retry":55,"expire":66},"dnssec": true, "cds_delete": true}`,
+		},
+		Entries: [][][]string{{}, {}},
+	}
+	h, err := DefaultDnssecInitialize()(testCase)
+	Expect(err).To(BeNil())
+	query := func(qname string, qtype uint16) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: qtype, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+
+	var ksk *dns.DNSKEY
+	for _, rr := range query("cds_test.com.", dns.TypeDNSKEY).Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok && key.Flags == dnssec.KSKFlags {
+			ksk = key
+		}
+	}
+	Expect(ksk).NotTo(BeNil())
+
+	for _, qtype := range []uint16{dns.TypeCDS, dns.TypeCDNSKEY} {
+		resp := query("cds_test.com.", qtype)
+		Expect(resp.Answer).To(HaveLen(2))
+		switch qtype {
+		case dns.TypeCDS:
+			Expect(resp.Answer[0].(*dns.CDS).Digest).To(Equal(ksk.ToDS(dns.SHA256).Digest))
+		case dns.TypeCDNSKEY:
+			Expect(resp.Answer[0].(*dns.CDNSKEY).PublicKey).To(Equal(ksk.PublicKey))
+		}
+		Expect(resp.Answer[1].(*dns.RRSIG).Verify(ksk, resp.Answer[:1])).To(BeNil())
+	}
+
+	resp := query("cds_delete_test.com.", dns.TypeCDS)
+	Expect(resp.Answer).To(HaveLen(2))
+	Expect(resp.Answer[0].String()).To(HaveSuffix("CDS\t0 0 0 00"))
+	resp = query("cds_delete_test.com.", dns.TypeCDNSKEY)
+	Expect(resp.Answer[0].String()).To(HaveSuffix("CDNSKEY\t0 3 0 AA=="))
+
+	Expect(query("www.cds_test.com.", dns.TypeCDS).Answer).To(BeEmpty())
+}
@@ -7,9 +7,11 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"z42-core/internal/api/database"
 	"z42-core/internal/geotools"
 	"z42-core/internal/storage"
 	"z42-core/pkg/geoip"
+	"z42-core/pkg/ratelimit"
 
 	"z42-core/internal/dnssec"
 	"z42-core/internal/types"
@@ -18,32 +20,67 @@ import (
 	"github.com/miekg/dns"
 )
 
+// rejectedQTypes maps query types that are never answered to their response code, meta types only
+// appear in other sections of a message and obsolete types are not implemented
+var rejectedQTypes = map[uint16]int{
+	dns.TypeNone:  dns.RcodeFormatError,
+	dns.TypeOPT:   dns.RcodeFormatError,
+	dns.TypeTSIG:  dns.RcodeFormatError,
+	dns.TypeTKEY:  dns.RcodeNotImplemented,
+	dns.TypeMD:    dns.RcodeNotImplemented,
+	dns.TypeMF:    dns.RcodeNotImplemented,
+	dns.TypeNXT:   dns.RcodeNotImplemented,
+	dns.TypeMAILA: dns.RcodeNotImplemented,
+	dns.TypeMAILB: dns.RcodeNotImplemented,
+}
+
+// anyRRSetTypes is the order in which rrsets are considered for answering ANY queries
+var anyRRSetTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT, dns.TypeSRV, dns.TypePTR, dns.TypeTLSA}
+
 type DnsRequestHandler struct {
 	Config        *Config
 	RedisData     *storage.DataHandler
+	RedisStat     *storage.StatHandler
 	requestLogger *zap.Logger
 	geoip         *geoip.GeoIp
 	upstream      *upstream.Upstream
+	rrl           *ratelimit.ResponseRateLimiter
 	cookieSecret  []byte
+	db            updateStorage
 	quit          chan struct{}
 	quitWG        sync.WaitGroup
 }
 
-func NewHandler(config *Config, redisData *storage.DataHandler, requestLogger *zap.Logger) *DnsRequestHandler {
+func NewHandler(config *Config, redisData *storage.DataHandler, redisStat *storage.StatHandler, requestLogger *zap.Logger) *DnsRequestHandler {
 	h := &DnsRequestHandler{
 		Config:        config,
 		RedisData:     redisData,
+		RedisStat:     redisStat,
 		requestLogger: requestLogger,
 	}
 
 	h.geoip = geoip.NewGeoIp(&config.GeoIp)
 	h.upstream = upstream.NewUpstream(config.Upstream)
+	h.rrl = ratelimit.NewResponseRateLimiter(&config.ResponseRateLimit)
 	h.quit = make(chan struct{})
 	h.cookieSecret, _ = hex.DecodeString(config.CookieSecret)
+	if config.DynamicUpdate.Enable {
+		db, err := database.Connect(config.DynamicUpdate.DBConnectionString)
+		if err != nil {
+			zap.L().Error("cannot connect to database, dynamic updates disabled", zap.Error(err))
+		} else {
+			h.db = db
+		}
+	}
 
 	return h
 }
 
+// TsigProvider returns a provider for dns servers to verify and sign messages with zone tsig keys
+func (h *DnsRequestHandler) TsigProvider() dns.TsigProvider {
+	return &tsigProvider{redisData: h.RedisData}
+}
+
 func (h *DnsRequestHandler) ShutDown() {
 	zap.L().Debug("handler : stopping")
 	close(h.quit)
@@ -51,11 +88,46 @@ func (h *DnsRequestHandler) ShutDown() {
 	zap.L().Debug("handler : stopped")
 }
 
+// ResponseRateLimitStats returns counters of response rate limiter
+func (h *DnsRequestHandler) ResponseRateLimitStats() ratelimit.ResponseRateLimitStats {
+	return h.rrl.Stats()
+}
+
 func (h *DnsRequestHandler) response(context *RequestContext) {
+	context.limit = h.responseLimit(context)
 	h.logRequest(context)
+	switch context.limit {
+	case ratelimit.ResponseDrop:
+		return
+	case ratelimit.ResponseSlip:
+		// truncated responses make real clients retry over tcp which spoofed sources cannot do
+		context.clearSections()
+		context.truncated = true
+	}
 	context.Response()
 }
 
+// responseLimit applies response rate limiting to udp responses, tcp and clients with a valid server cookie
+// have proven their address and are never limited
+func (h *DnsRequestHandler) responseLimit(context *RequestContext) ratelimit.ResponseAction {
+	if context.Proto() != "udp" || context.validCookie {
+		return ratelimit.ResponseSend
+	}
+	class := ratelimit.ResponseAnswer
+	switch context.Res {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		class = ratelimit.ResponseNxDomain
+	default:
+		class = ratelimit.ResponseError
+	}
+	zone := ""
+	if context.zone != nil {
+		zone = context.zone.Name
+	}
+	return h.rrl.Check(net.ParseIP(context.IP()), context.RawName(), context.QType(), zone, class)
+}
+
 func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 	zap.L().Debug(
 		"start handle request",
@@ -63,6 +135,11 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 		zap.String("query", context.RawName()),
 		zap.String("type", context.Type()),
 	)
+	if !h.clientSubnet(context) {
+		context.Res = dns.RcodeFormatError
+		h.response(context)
+		return
+	}
 	if h.Config.LogSourceLocation {
 		sourceIP := context.SourceIp
 		context.SourceCountry, _ = h.geoip.GetCountry(sourceIP)
@@ -79,6 +156,7 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 	case sCookie != nil:
 		if CheckCookie(context, cCookie, sCookie, h.cookieSecret) {
 			CopyCookie(context, cCookie, sCookie, h.cookieSecret)
+			context.validCookie = true
 			break
 		}
 		fallthrough
@@ -89,13 +167,35 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 		return
 	}
 
+	if context.Req.IsTsig() != nil && context.W.TsigStatus() != nil {
+		zap.L().Debug(
+			"tsig verification failed",
+			zap.Uint16("id", context.Req.Id),
+			zap.Error(context.W.TsigStatus()),
+		)
+		context.Res = dns.RcodeNotAuth
+		h.response(context)
+		return
+	}
+
+	if rcode, found := rejectedQTypes[context.QType()]; found {
+		zap.L().Debug(
+			"query type rejected",
+			zap.Uint16("id", context.Req.Id),
+			zap.String("type", context.Type()),
+		)
+		context.SetError(rcode, dns.ExtendedErrorCodeNotSupported, "query type is not supported")
+		h.response(context)
+		return
+	}
+
 	zoneName := h.RedisData.FindZone(context.RawName())
 	if zoneName == "" {
 		zap.L().Debug(
 			"zone not found",
 			zap.Uint16("id", context.Req.Id),
 		)
-		context.Res = dns.RcodeNotAuth
+		context.SetError(dns.RcodeNotAuth, dns.ExtendedErrorCodeNotAuthoritative, "")
 		h.response(context)
 		return
 	}
@@ -107,11 +207,29 @@ func (h *DnsRequestHandler) HandleRequest(context *RequestContext) {
 
 	context.zone = h.RedisData.GetZone(zoneName)
 	if context.zone == nil {
-		context.Res = dns.RcodeServerFailure
+		context.storageFailure()
 		h.response(context)
 		return
 	}
 	context.DomainUid = context.zone.Config.DomainId
+	if context.zone.Config.IgnoreClientSubnet && context.clientSubnet != nil {
+		context.SourceIp = net.ParseIP(context.IP())
+		context.subnetSource = 0
+	}
+	h.selectView(context)
+
+	if context.Req.Opcode == dns.OpcodeNotify {
+		h.notify(context)
+		return
+	}
+	if context.Req.Opcode == dns.OpcodeUpdate {
+		h.update(context)
+		return
+	}
+	if context.QType() == dns.TypeAXFR || context.QType() == dns.TypeIXFR {
+		h.transfer(context)
+		return
+	}
 
 	context.dnssec = context.Do() && context.Auth && context.zone.Config.DnsSec
 	cnameFlattening := context.dnssec || context.zone.Config.CnameFlattening
@@ -127,7 +245,7 @@ loop:
 				zap.String("type", context.Type()),
 			)
 			context.Answer = []dns.RR{}
-			context.Res = dns.RcodeServerFailure
+			context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeInvalidData, "cname loop")
 			break loop
 		}
 		loopCount++
@@ -153,6 +271,21 @@ loop:
 				zap.Uint16("id", context.Req.Id),
 				zap.String("qname", currentQName),
 			)
+			if currentQName != context.zone.Name {
+				target, found, err := h.substituteDNAME(context, "@", currentQName)
+				if err != nil {
+					context.storageFailure()
+					break loop
+				}
+				if found {
+					if target == "" {
+						break loop
+					}
+					currentQName = target
+					cnameFlattening = false
+					continue
+				}
+			}
 			context.Authority = []dns.RR{context.zone.Config.SOA.Data}
 			context.Res = dns.RcodeNameError
 			addNSec(context, currentQName, dns.TypeNone)
@@ -177,9 +310,9 @@ loop:
 				zap.String("qname", currentQName),
 				zap.String("location", location),
 			)
-			ns, err := h.RedisData.NS(context.zone.Name, location)
+			ns, err := context.data.NS(context.zone.Name, location)
 			if err != nil {
-				context.Res = dns.RcodeServerFailure
+				context.storageFailure()
 				break loop
 			}
 			if !ns.Empty() {
@@ -190,14 +323,14 @@ loop:
 					zap.String("location", location),
 				)
 				if len(ns.Data) == 0 {
-					context.Res = dns.RcodeServerFailure
+					context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeInvalidData, "empty delegation")
 					break loop
 				}
 				cutPoint := location + "." + zoneName
 				context.Authority = append(context.Authority, ns.Value(cutPoint)...)
-				ds, err := h.RedisData.DS(context.zone.Name, location)
+				ds, err := context.data.DS(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				if ds.Empty() {
@@ -207,15 +340,15 @@ loop:
 				for _, ns := range ns.Data {
 					glueLocation, match := context.zone.FindLocation(ns.Host)
 					if match != types.NoMatch {
-						glueA, err := h.RedisData.A(context.zone.Name, glueLocation)
+						glueA, err := context.data.A(context.zone.Name, glueLocation)
 						// XXX : should we return with RcodeServerFailure?
 						if err == nil {
-							ips := h.filter(context.SourceIp, glueA)
+							ips := h.filter(context, glueLocation, glueA)
 							context.Additional = append(context.Additional, generateA(ns.Host, glueA.Ttl(), ips)...)
 						}
-						glueAAAA, err := h.RedisData.AAAA(context.zone.Name, glueLocation)
+						glueAAAA, err := context.data.AAAA(context.zone.Name, glueLocation)
 						if err == nil {
-							ips := h.filter(context.SourceIp, glueAAAA)
+							ips := h.filter(context, glueLocation, glueAAAA)
 							context.Additional = append(context.Additional, generateAAAA(ns.Host, glueAAAA.Ttl(), ips)...)
 						}
 					}
@@ -223,6 +356,19 @@ loop:
 				context.Res = dns.RcodeSuccess
 				break loop
 			} else {
+				target, found, err := h.substituteDNAME(context, location, currentQName)
+				if err != nil {
+					context.storageFailure()
+					break loop
+				}
+				if found {
+					if target == "" {
+						break loop
+					}
+					currentQName = target
+					cnameFlattening = false
+					continue
+				}
 				context.Authority = []dns.RR{context.zone.Config.SOA.Data}
 				context.Res = dns.RcodeNameError
 				addNSec(context, currentQName, context.QType())
@@ -239,12 +385,12 @@ loop:
 				zap.String("qname", currentQName),
 				zap.String("location", location),
 			)
-			cname, err := h.RedisData.CNAME(context.zone.Name, location)
+			cname, err := context.data.CNAME(context.zone.Name, location)
 			if err != nil {
-				context.Res = dns.RcodeServerFailure
+				context.storageFailure()
 				break loop
 			}
-			if !cname.Empty() && context.QType() != dns.TypeCNAME {
+			if !cname.Empty() && context.QType() != dns.TypeCNAME && context.QType() != dns.TypeANY {
 				zap.L().Debug(
 					"cname chain",
 					zap.Uint16("id", context.Req.Id),
@@ -262,9 +408,9 @@ loop:
 				continue
 			}
 			if currentQName != context.zone.Name {
-				ns, err := h.RedisData.NS(context.zone.Name, location)
+				ns, err := context.data.NS(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				if !ns.Empty() {
@@ -272,12 +418,19 @@ loop:
 						"delegation",
 						zap.Uint16("id", context.Req.Id),
 					)
-					ds, err := h.RedisData.DS(context.zone.Name, location)
+					ds, err := context.data.DS(context.zone.Name, location)
 					if err != nil {
-						context.Res = dns.RcodeServerFailure
+						context.storageFailure()
 						break loop
 					}
 					if ds.Empty() {
+						if context.QType() == dns.TypeDS {
+							// parent side of the cut is authoritative for ds, answer with nodata instead of a referral
+							addNSec(context, currentQName, dns.TypeDS)
+							context.Authority = append(context.Authority, context.zone.Config.SOA.Data)
+							context.Res = dns.RcodeSuccess
+							break loop
+						}
 						addNSec(context, currentQName, dns.TypeDS)
 					} else {
 						if context.QType() == dns.TypeDS {
@@ -291,15 +444,15 @@ loop:
 					for _, data := range ns.Data {
 						glueLocation, match := context.zone.FindLocation(data.Host)
 						if match != types.NoMatch {
-							glueA, err := h.RedisData.A(context.zone.Name, glueLocation)
+							glueA, err := context.data.A(context.zone.Name, glueLocation)
 							// XXX : should we return with RcodeServerFailure?
 							if err == nil {
-								ips := h.filter(context.SourceIp, glueA)
+								ips := h.filter(context, glueLocation, glueA)
 								context.Additional = append(context.Additional, generateA(data.Host, glueA.Ttl(), ips)...)
 							}
-							glueAAAA, err := h.RedisData.AAAA(context.zone.Name, glueLocation)
+							glueAAAA, err := context.data.AAAA(context.zone.Name, glueLocation)
 							if err == nil {
-								ips := h.filter(context.SourceIp, glueAAAA)
+								ips := h.filter(context, glueLocation, glueAAAA)
 								context.Additional = append(context.Additional, generateAAAA(data.Host, glueAAAA.Ttl(), ips)...)
 							}
 						}
@@ -322,75 +475,82 @@ loop:
 			case dns.TypeA:
 				var ips []net.IP
 				var ttl uint32
-				a, err := h.RedisData.A(context.zone.Name, location)
+				a, err := context.data.A(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
-				aname, err := h.RedisData.ANAME(context.zone.Name, location)
+				aname, err := context.data.ANAME(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				if a.Empty() && !aname.Empty() {
 					ips, context.Res, ttl = h.findANAME(context, aname.Location, dns.TypeA)
 				} else {
 					ttl = a.Ttl()
-					ips = h.filter(context.SourceIp, a)
+					ips = h.filter(context, location, a)
 				}
 				answer = generateA(currentQName, ttl, ips)
 			case dns.TypeAAAA:
 				var ips []net.IP
 				var ttl uint32
-				aaaa, err := h.RedisData.AAAA(context.zone.Name, location)
+				aaaa, err := context.data.AAAA(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
-				aname, err := h.RedisData.ANAME(context.zone.Name, location)
+				aname, err := context.data.ANAME(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				if aaaa.Empty() && !aname.Empty() {
 					ips, context.Res, ttl = h.findANAME(context, aname.Location, dns.TypeAAAA)
 				} else {
 					ttl = aaaa.Ttl()
-					ips = h.filter(context.SourceIp, aaaa)
+					ips = h.filter(context, location, aaaa)
 				}
 				answer = generateAAAA(currentQName, ttl, ips)
 			case dns.TypeCNAME:
-				cname, err := h.RedisData.CNAME(context.zone.Name, location)
+				cname, err := context.data.CNAME(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = cname.Value(currentQName)
+			case dns.TypeDNAME:
+				dname, err := context.data.DNAME(context.zone.Name, location)
+				if err != nil {
+					context.storageFailure()
+					break loop
+				}
+				answer = dname.Value(currentQName)
 			case dns.TypeTXT:
-				txt, err := h.RedisData.TXT(context.zone.Name, location)
+				txt, err := context.data.TXT(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = txt.Value(currentQName)
 			case dns.TypeNS:
-				ns, err := h.RedisData.NS(context.zone.Name, location)
+				ns, err := context.data.NS(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = ns.Value(currentQName)
 			case dns.TypeMX:
-				mx, err := h.RedisData.MX(context.zone.Name, location)
+				mx, err := context.data.MX(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = mx.Value(currentQName)
 			case dns.TypeSRV:
-				srv, err := h.RedisData.SRV(context.zone.Name, location)
+				srv, err := context.data.SRV(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = srv.Value(currentQName)
@@ -401,46 +561,80 @@ loop:
 					answer = caa.Value(currentQName)
 				}
 			case dns.TypePTR:
-				ptr, err := h.RedisData.PTR(context.zone.Name, location)
+				ptr, err := context.data.PTR(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = ptr.Value(currentQName)
 			case dns.TypeTLSA:
 
-				tlsa, err := h.RedisData.TLSA(context.zone.Name, location)
+				tlsa, err := context.data.TLSA(context.zone.Name, location)
 				if err != nil {
-					context.Res = dns.RcodeServerFailure
+					context.storageFailure()
 					break loop
 				}
 				answer = tlsa.Value(currentQName)
+			case dns.TypeSVCB, dns.TypeHTTPS:
+				svcb, err := context.data.RRSet(context.zone.Name, location, context.QType())
+				if err != nil {
+					context.storageFailure()
+					break loop
+				}
+				answer = svcb.Value(currentQName)
+				h.addServiceTargets(context, answer, true, map[string]bool{})
 			case dns.TypeSOA:
 				answer = []dns.RR{context.zone.Config.SOA.Data}
+			case dns.TypeANY:
+				if !cname.Empty() {
+					answer = cname.Value(currentQName)
+					break
+				}
+				answer, err = h.findANY(context, location, currentQName)
+				if err != nil {
+					context.storageFailure()
+					break loop
+				}
 			case dns.TypeDNSKEY:
 				if context.zone.Config.DnsSec {
-					answer = []dns.RR{context.zone.ZSK.DnsKey, context.zone.KSK.DnsKey}
+					answer = append([]dns.RR{}, context.zone.DnsKeys...)
 				}
 			case dns.TypeDS:
 				answer = []dns.RR{}
+			case dns.TypeCDS, dns.TypeCDNSKEY:
+				if context.zone.Config.DnsSec && location == "@" {
+					answer = dnssec.ChildKeys(context.zone, context.QType())
+				}
+			case dns.TypeNSEC3PARAM:
+				if context.zone.Config.DnsSec && context.zone.Config.NSEC3 != nil && location == "@" {
+					answer = []dns.RR{dnssec.NSEC3Param(context.zone.Name, context.zone.Config.NSEC3, context.zone.Config.SOA.MinTtl)}
+				}
 			default:
+				if types.IsGeneric(context.QType()) {
+					rrset, err := context.data.RRSet(context.zone.Name, location, context.QType())
+					if err != nil {
+						context.storageFailure()
+						break loop
+					}
+					answer = rrset.Value(currentQName)
+					break
+				}
 				context.Answer = []dns.RR{}
 				context.Authority = []dns.RR{context.zone.Config.SOA.Data}
 				context.Res = dns.RcodeSuccess
 				break loop
 			}
 			context.Answer = append(context.Answer, answer...)
-			if len(answer) == 0 {
+			// failed aname lookups are not denied, addNSec would turn them into nodata at apex
+			if len(answer) == 0 && context.Res == dns.RcodeSuccess {
 				addNSec(context, currentQName, context.QType())
-				if context.Res == dns.RcodeSuccess {
-					context.Authority = append(context.Authority, context.zone.Config.SOA.Data)
-				}
+				context.Authority = append(context.Authority, context.zone.Config.SOA.Data)
 			}
 			break loop
 		}
 	}
 
-	applyDnssec(context)
+	h.applyDnssec(context)
 
 	h.response(context)
 	zap.L().Debug(
@@ -451,10 +645,71 @@ loop:
 	)
 }
 
-func (h *DnsRequestHandler) filter(sourceIp net.IP, rrset *types.IP_RRSet) []net.IP {
+// clientSubnet truncates ecs source prefix to configured maximum and uses truncated address for geo decisions,
+// it returns false for options that are invalid according to rfc7871 section 7.1.1
+func (h *DnsRequestHandler) clientSubnet(context *RequestContext) bool {
+	subnet := context.subnetOption()
+	if subnet == nil {
+		return true
+	}
+	defaults := DefaultDnsRequestHandlerConfig().ClientSubnet
+	bits, max := 8*net.IPv4len, h.Config.ClientSubnet.IPv4SourcePrefix
+	if subnet.Family == 2 {
+		bits, max = 8*net.IPv6len, h.Config.ClientSubnet.IPv6SourcePrefix
+		if max < 1 || max > bits {
+			max = defaults.IPv6SourcePrefix
+		}
+	} else if max < 1 || max > bits {
+		max = defaults.IPv4SourcePrefix
+	}
+	source := int(subnet.SourceNetmask)
+	if subnet.SourceScope != 0 || source > bits || !subnet.Address.Mask(net.CIDRMask(source, bits)).Equal(subnet.Address) {
+		return false
+	}
+	if source > max {
+		source = max
+	}
+	context.clientSubnet = subnet
+	context.subnetSource = uint8(source)
+	if source == 0 {
+		// client asked not to use its address
+		context.SourceIp = net.ParseIP(context.IP())
+	} else {
+		context.SourceIp = subnet.Address.Mask(net.CIDRMask(source, bits))
+	}
+	return true
+}
+
+// selectView picks split horizon view of request, client subnet is only used if zone honors it
+func (h *DnsRequestHandler) selectView(context *RequestContext) {
+	var subnet net.IP
+	if context.clientSubnet != nil && context.subnetSource > 0 {
+		subnet = context.SourceIp
+	}
+	context.view = context.zone.Config.SelectView(net.ParseIP(context.IP()), subnet, context.W.LocalAddr())
+	context.data = h.RedisData.View(context.view)
+	if context.zone.Config.HasClientSubnets() {
+		// answer depends on views matching client subnet
+		context.subnetScope = context.subnetSource
+	}
+}
+
+func (h *DnsRequestHandler) filter(context *RequestContext, location string, rrset *types.IP_RRSet) []net.IP {
+	sourceIp := context.SourceIp
 	mask := make([]int, len(rrset.Data))
-	// TODO: filterHealthCheck in redisStat
-	//mask = h.healthcheck.FilterHealthcheck(name, rrset, mask)
+	switch rrset.FilterConfig.GeoFilter {
+	case "asn", "country", "asn+country", "location":
+		// answer depends on client location so it is only valid for client subnet
+		context.subnetScope = context.subnetSource
+	}
+	if h.RedisStat != nil && rrset.HealthCheckConfig.Enable {
+		host := storage.HealthcheckHost(context.zone.Name, location)
+		if rrset.HasTiers() {
+			mask = h.RedisStat.FilterFailover(host, rrset, mask)
+		} else {
+			mask = h.RedisStat.FilterHealthcheck(host, rrset, mask)
+		}
+	}
 	switch rrset.FilterConfig.GeoFilter {
 	case "asn":
 		mask, _ = geotools.GetSameASN(h.geoip, sourceIp, rrset.Data, mask)
@@ -476,15 +731,140 @@ func (h *DnsRequestHandler) logRequest(state *RequestContext) {
 		zap.String("domain.id", state.DomainUid),
 		zap.String("qname", state.Name()),
 		zap.String("qtype", state.Type()),
+		zap.String("transport", state.Transport()),
 		zap.String("source.ip", state.SourceIp.String()),
 		zap.String("source.subnet", state.SourceSubnet),
 		zap.String("source.country", state.SourceCountry),
 		zap.Uint("source.asn", state.SourceASN),
 		zap.Duration("process_time", time.Since(state.StartTime)),
 		zap.Int("response_code", state.Res),
+		zap.String("ratelimit", state.limit.String()),
+		zap.String("view", state.view),
+		extendedErrorField(state.extendedError),
 	)
 }
 
+func extendedErrorField(e *dns.EDNS0_EDE) zap.Field {
+	if e == nil {
+		return zap.Skip()
+	}
+	return zap.String("extended_error", e.String())
+}
+
+// findANY returns a single rrset for ANY queries as described in rfc8482, names without any of
+// anyRRSetTypes get a synthesized HINFO record so answer is never empty
+func (h *DnsRequestHandler) findANY(context *RequestContext, location string, name string) ([]dns.RR, error) {
+	for _, qtype := range anyRRSetTypes {
+		rrset, err := context.data.RRSet(context.zone.Name, location, qtype)
+		if err != nil {
+			return nil, err
+		}
+		var answer []dns.RR
+		switch qtype {
+		case dns.TypeA:
+			ipRRSet := rrset.(*types.IP_RRSet)
+			answer = generateA(name, ipRRSet.Ttl(), h.filter(context, location, ipRRSet))
+		case dns.TypeAAAA:
+			ipRRSet := rrset.(*types.IP_RRSet)
+			answer = generateAAAA(name, ipRRSet.Ttl(), h.filter(context, location, ipRRSet))
+		default:
+			answer = rrset.Value(name)
+		}
+		if len(answer) > 0 {
+			return answer, nil
+		}
+	}
+	return []dns.RR{&dns.HINFO{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: context.zone.Config.SOA.Ttl()},
+		Cpu: "RFC8482",
+	}}, nil
+}
+
+// substituteDNAME adds dname at location and a cname synthesized from it to answer if location has a dname,
+// it returns name qname is redirected to or an empty name if redirected name is too long (rfc6672 section 2.2)
+func (h *DnsRequestHandler) substituteDNAME(context *RequestContext, location string, qname string) (string, bool, error) {
+	dname, err := context.data.DNAME(context.zone.Name, location)
+	if err != nil {
+		return "", false, err
+	}
+	if dname.Empty() {
+		return "", false, nil
+	}
+	owner := context.zone.Name
+	if location != "@" {
+		owner = location + "." + context.zone.Name
+	}
+	labels := dns.SplitDomainName(qname)
+	prefix := strings.Join(labels[:len(labels)-dns.CountLabel(owner)], ".")
+	target := prefix + "." + dns.Fqdn(dname.Target)
+	zap.L().Debug(
+		"dname substitution",
+		zap.Uint16("id", context.Req.Id),
+		zap.String("source", qname),
+		zap.String("destination", target),
+	)
+	context.Answer = append(context.Answer, dname.Value(owner)...)
+	if _, ok := dns.IsDomainName(target); !ok {
+		context.Res = dns.RcodeYXDomain
+		return "", true, nil
+	}
+	cname := &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: qname, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: dname.Ttl()},
+		Target: target,
+	}
+	context.Answer = append(context.Answer, cname)
+	context.synthesized = append(context.synthesized, cname)
+	return target, true, nil
+}
+
+// addServiceTargets adds addresses of in-zone svcb and https targets to additional section the way glue
+// is added for delegations, service bindings of alias mode targets are added too if followAlias is set
+func (h *DnsRequestHandler) addServiceTargets(context *RequestContext, records []dns.RR, followAlias bool, seen map[string]bool) {
+	for _, rr := range records {
+		var svcb *dns.SVCB
+		switch r := rr.(type) {
+		case *dns.SVCB:
+			svcb = r
+		case *dns.HTTPS:
+			svcb = &r.SVCB
+		default:
+			continue
+		}
+		target := strings.ToLower(svcb.Target)
+		if target == "." {
+			// alias to root means service is not available
+			if svcb.Priority == 0 {
+				continue
+			}
+			target = strings.ToLower(svcb.Hdr.Name)
+		}
+		if seen[target] || !dns.IsSubDomain(context.zone.Name, target) {
+			continue
+		}
+		seen[target] = true
+		location, match := context.zone.FindLocation(target)
+		if match != types.ExactMatch && match != types.WildCardMatch {
+			continue
+		}
+		if svcb.Priority == 0 && followAlias {
+			aliased, err := context.data.RRSet(context.zone.Name, location, rr.Header().Rrtype)
+			if err == nil {
+				aliasedRecords := aliased.Value(target)
+				context.Additional = append(context.Additional, aliasedRecords...)
+				h.addServiceTargets(context, aliasedRecords, false, seen)
+			}
+		}
+		a, err := context.data.A(context.zone.Name, location)
+		if err == nil {
+			context.Additional = append(context.Additional, generateA(target, a.Ttl(), h.filter(context, location, a))...)
+		}
+		aaaa, err := context.data.AAAA(context.zone.Name, location)
+		if err == nil {
+			context.Additional = append(context.Additional, generateAAAA(target, aaaa.Ttl(), h.filter(context, location, aaaa))...)
+		}
+	}
+}
+
 func generateA(name string, ttl uint32, ips []net.IP) (answers []dns.RR) {
 	for _, ip := range ips {
 		if ip == nil {
@@ -514,6 +894,19 @@ func generateAAAA(name string, ttl uint32, ips []net.IP) (answers []dns.RR) {
 }
 
 func orderIps(rrset *types.IP_RRSet, mask []int) []net.IP {
+	// only lowest tier left is served, higher tiers are backups
+	tier := -1
+	for i, x := range mask {
+		if x == types.IpMaskWhite && (tier == -1 || rrset.Data[i].Tier < tier) {
+			tier = rrset.Data[i].Tier
+		}
+	}
+	for i, x := range mask {
+		if x == types.IpMaskWhite && rrset.Data[i].Tier != tier {
+			mask[i] = types.IpMaskBlack
+		}
+	}
+
 	sum := 0
 	count := 0
 	for i, x := range mask {
@@ -585,7 +978,7 @@ func orderIps(rrset *types.IP_RRSet, mask []int) []net.IP {
 func (h *DnsRequestHandler) findCAA(context *RequestContext, query string) *types.CAA_RRSet {
 	zone := context.zone
 	currentLocation, _ := zone.FindLocation(query)
-	currentCAA, err := h.RedisData.CAA(zone.Name, currentLocation)
+	currentCAA, err := context.data.CAA(zone.Name, currentLocation)
 	if err == nil && !currentCAA.Empty() {
 		return currentCAA
 	}
@@ -601,7 +994,7 @@ func (h *DnsRequestHandler) findCAA(context *RequestContext, query string) *type
 			currentLocation = splits[1]
 			continue
 		}
-		currentCAA, err := h.RedisData.CAA(zone.Name, currentLocation)
+		currentCAA, err := context.data.CAA(zone.Name, currentLocation)
 		if err != nil {
 			currentLocation = splits[1]
 			continue
@@ -610,7 +1003,7 @@ func (h *DnsRequestHandler) findCAA(context *RequestContext, query string) *type
 			return currentCAA
 		}
 	}
-	currentCAA, err = h.RedisData.CAA(zone.Name, "@")
+	currentCAA, err = context.data.CAA(zone.Name, "@")
 	if err != nil {
 		return nil
 	}
@@ -628,6 +1021,7 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 				zap.String("query", context.RawName()),
 				zap.String("type", context.Type()),
 			)
+			context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeInvalidData, "aname loop")
 			return []net.IP{}, dns.RcodeServerFailure, 0
 		}
 		loopCount++
@@ -660,6 +1054,7 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 				}
 				return ips, upstreamRes, upstreamTtl
 			} else {
+				context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNetworkError, "aname upstream query failed")
 				return []net.IP{}, dns.RcodeServerFailure, 0
 			}
 		}
@@ -670,11 +1065,13 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 				"location not found",
 				zap.String("qname", currentQName),
 			)
+			context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeInvalidData, "aname target not found")
 			return []net.IP{}, dns.RcodeServerFailure, 0
 		}
 
-		cname, err := h.RedisData.CNAME(context.zone.Name, location)
+		cname, err := context.data.CNAME(context.zone.Name, location)
 		if err != nil {
+			context.storageFailure()
 			return []net.IP{}, dns.RcodeServerFailure, 0
 		}
 		if !cname.Empty() {
@@ -684,27 +1081,30 @@ func (h *DnsRequestHandler) findANAME(context *RequestContext, aname string, qty
 		}
 
 		if qtype == dns.TypeA {
-			a, err := h.RedisData.A(context.zone.Name, location)
+			a, err := context.data.A(context.zone.Name, location)
 			if err != nil {
+				context.storageFailure()
 				return []net.IP{}, dns.RcodeServerFailure, 0
 			}
 			if !a.Empty() {
 				zap.L().Debug("found a")
-				return h.filter(context.SourceIp, a), dns.RcodeSuccess, a.TtlValue
+				return h.filter(context, location, a), dns.RcodeSuccess, a.TtlValue
 			}
 		} else if qtype == dns.TypeAAAA {
-			aaaa, err := h.RedisData.AAAA(context.zone.Name, location)
+			aaaa, err := context.data.AAAA(context.zone.Name, location)
 			if err != nil {
+				context.storageFailure()
 				return []net.IP{}, dns.RcodeServerFailure, 0
 			}
 			if !aaaa.Empty() {
 				zap.L().Debug("found aaaa")
-				return h.filter(context.SourceIp, aaaa), dns.RcodeSuccess, aaaa.TtlValue
+				return h.filter(context, location, aaaa), dns.RcodeSuccess, aaaa.TtlValue
 			}
 		}
 
-		aname, err := h.RedisData.ANAME(context.zone.Name, location)
+		aname, err := context.data.ANAME(context.zone.Name, location)
 		if err != nil {
+			context.storageFailure()
 			return []net.IP{}, dns.RcodeServerFailure, 0
 		}
 		if !aname.Empty() {
@@ -722,6 +1122,7 @@ func addNSec(context *RequestContext, name string, qtype uint16) {
 		return
 	}
 	var bitmap []uint16
+	delegation := false
 	if name == context.zone.Name {
 		context.Res = dns.RcodeSuccess
 		bitmap = dnssec.FilterNsecBitmap(qtype, dnssec.NsecBitmapAppex)
@@ -732,12 +1133,18 @@ func addNSec(context *RequestContext, name string, qtype uint16) {
 		} else {
 			if qtype == dns.TypeDS {
 				bitmap = dnssec.FilterNsecBitmap(qtype, dnssec.NsecBitmapSubDelegation)
+				delegation = true
 			} else {
 				bitmap = dnssec.FilterNsecBitmap(qtype, dnssec.NsecBitmapZone)
 			}
 		}
 	}
 
+	if context.zone.Config.NSEC3 != nil {
+		addNSec3(context, name, bitmap, delegation)
+		return
+	}
+
 	nsec := &dns.NSEC{
 		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: context.zone.Config.SOA.MinTtl},
 		NextDomain: "\\000." + name,
@@ -746,12 +1153,94 @@ func addNSec(context *RequestContext, name string, qtype uint16) {
 	context.Authority = append(context.Authority, nsec)
 }
 
-func applyDnssec(context *RequestContext) {
+func addNSec3(context *RequestContext, name string, bitmap []uint16, delegation bool) {
+	zone := context.zone
+	config := zone.Config.NSEC3
+	ttl := zone.Config.SOA.MinTtl
+	if delegation && config.OptOut {
+		// insecure delegation in opt-out zone: closest encloser proof, next closer name is covered by an opt-out nsec3
+		// closest encloser is the nearest existing ancestor, it may be an empty non-terminal or the apex
+		closestEncloser := zone.Name
+		nextCloser := name
+		ceBitmap := dnssec.Nsec3Bitmap(dnssec.NsecBitmapAppex, true)
+		labels := dns.Split(name)
+		for i := 1; i < len(labels); i++ {
+			candidate := name[labels[i]:]
+			nextCloser = name[labels[i-1]:]
+			if candidate == zone.Name {
+				break
+			}
+			_, match := zone.FindLocation(candidate)
+			if match == types.ExactMatch {
+				ceBitmap = dnssec.Nsec3Bitmap(dnssec.NsecBitmapZone, false)
+			} else if match == types.EmptyNonterminalMatch {
+				ceBitmap = []uint16{}
+			} else {
+				continue
+			}
+			closestEncloser = candidate
+			break
+		}
+		context.Authority = append(context.Authority,
+			dnssec.NSEC3(closestEncloser, zone.Name, config, ttl, ceBitmap),
+			dnssec.CoveringNSEC3(nextCloser, zone.Name, config, ttl),
+		)
+		return
+	}
+	context.Authority = append(context.Authority, dnssec.NSEC3(name, zone.Name, config, ttl, dnssec.Nsec3Bitmap(bitmap, name == zone.Name)))
+}
+
+func (h *DnsRequestHandler) applyDnssec(context *RequestContext) {
 	if !context.dnssec {
 		return
 	}
-	context.Answer = dnssec.SignResponse(context.Answer, context.RawName(), context.zone)
-	context.Authority = dnssec.SignResponse(context.Authority, context.RawName(), context.zone)
-	// context.Additional = Sign(context.Additional, context.RawName(), zone)
+	if dnssec.ActiveKey(context.zone.Keys, dnssec.ZSKFlags) == nil {
+		// unsigned answers from a signed zone are bogus for validators
+		context.clearSections()
+		context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeRRSIGsMissing, "zone signing key is not available")
+		return
+	}
+	var answer, synthesized []dns.RR
+	for _, rr := range context.Answer {
+		if context.isSynthesized(rr) {
+			synthesized = append(synthesized, rr)
+		} else {
+			answer = append(answer, rr)
+		}
+	}
+	context.Answer = append(dnssec.SignResponse(answer, context.zone, h.RedisData.SignRRSet), synthesized...)
+	context.Authority = dnssec.SignResponse(context.Authority, context.zone, h.RedisData.SignRRSet)
+	var authoritative, unsigned []dns.RR
+	for _, rr := range context.Additional {
+		if rr.Header().Rrtype == dns.TypeOPT || belowZoneCut(context, rr.Header().Name) {
+			unsigned = append(unsigned, rr)
+		} else {
+			authoritative = append(authoritative, rr)
+		}
+	}
+	context.Additional = append(dnssec.SignResponse(authoritative, context.zone, h.RedisData.SignRRSet), unsigned...)
+}
 
+// belowZoneCut reports whether name is at or below a delegation in zone, records there are glue and are not signed
+func belowZoneCut(context *RequestContext, name string) bool {
+	zone := context.zone
+	name = strings.ToLower(name)
+	if !dns.IsSubDomain(zone.Name, name) {
+		return true
+	}
+	for name != zone.Name {
+		location, match := zone.FindLocation(name)
+		if match == types.ExactMatch {
+			ns, err := context.data.NS(zone.Name, location)
+			if err != nil || !ns.Empty() {
+				return true
+			}
+		}
+		labels := dns.Split(name)
+		if len(labels) < 2 {
+			break
+		}
+		name = name[labels[1]:]
+	}
+	return false
 }
@@ -82,6 +82,33 @@ var handlerTestCases = []*TestCase{
 						"ds":{"ttl":300, "records":[{"key_tag":57855, "algorithm":5, "digest_type":1, "digest":"B6DCD485719ADCA18E5F3D48A2331627FDD3636B"}]}
 					}`,
 				},
+				{"web",
+					`{
+						"a":{"ttl":300, "records":[{"ip":"10.1.1.1"}]},
+						"https":{"ttl":300, "records":[{"priority":1, "target":".", "alpn":["h2","h3"]}]}
+					}`,
+				},
+				{"alias",
+					`{"https":{"ttl":300, "records":[{"priority":0, "target":"web.example.com."}]}}`,
+				},
+				{"_dns",
+					`{"svcb":{"ttl":300, "records":[{"priority":1, "target":"dns.example.net.", "alpn":["dot"], "port":853}]}}`,
+				},
+				{"old",
+					`{"dname":{"ttl":300, "target":"example.org."}}`,
+				},
+				{"sub",
+					`{"dname":{"ttl":300, "target":"example.com."}}`,
+				},
+				{"loop",
+					`{"dname":{"ttl":300, "target":"loop.example.com."}}`,
+				},
+				{"gen",
+					`{
+						"naptr":{"ttl":300, "records":[{"data":"100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.example.com."}]},
+						"sshfp":{"ttl":300, "records":[{"data":"\\# 4 01020304"}]}
+					}`,
+				},
 			},
 		},
 		TestCases: []test.Case{
@@ -221,6 +248,129 @@ var handlerTestCases = []*TestCase{
 					test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1460498836 44 55 66 100"),
 				},
 			},
+			// SVCB and HTTPS Test
+			{
+				Desc:  "HTTPS service mode",
+				Qname: "web.example.com.", Qtype: dns.TypeHTTPS,
+				Answer: []dns.RR{
+					test.HTTPS(`web.example.com. 300 IN HTTPS 1 . alpn="h2,h3"`),
+				},
+				Extra: []dns.RR{
+					test.A("web.example.com. 300 IN A 10.1.1.1"),
+				},
+			},
+			{
+				Desc:  "HTTPS alias mode",
+				Qname: "alias.example.com.", Qtype: dns.TypeHTTPS,
+				Answer: []dns.RR{
+					test.HTTPS("alias.example.com. 300 IN HTTPS 0 web.example.com."),
+				},
+				Extra: []dns.RR{
+					test.A("web.example.com. 300 IN A 10.1.1.1"),
+					test.HTTPS(`web.example.com. 300 IN HTTPS 1 . alpn="h2,h3"`),
+				},
+			},
+			{
+				Desc:  "SVCB with out of zone target",
+				Qname: "_dns.example.com.", Qtype: dns.TypeSVCB,
+				Answer: []dns.RR{
+					test.SVCB(`_dns.example.com. 300 IN SVCB 1 dns.example.net. alpn="dot" port="853"`),
+				},
+			},
+			// DNAME Test
+			{
+				Desc:  "DNAME to other zone",
+				Qname: "www.old.example.com.", Qtype: dns.TypeA,
+				Answer: []dns.RR{
+					test.DNAME("old.example.com. 300 IN DNAME example.org."),
+					test.CNAME("www.old.example.com. 300 IN CNAME www.example.org."),
+				},
+			},
+			{
+				Desc:  "DNAME in zone",
+				Qname: "x.sub.example.com.", Qtype: dns.TypeA,
+				Answer: []dns.RR{
+					test.DNAME("sub.example.com. 300 IN DNAME example.com."),
+					test.A("x.example.com. 300 IN A 1.2.3.4"),
+					test.A("x.example.com. 300 IN A 5.6.7.8"),
+					test.CNAME("x.sub.example.com. 300 IN CNAME x.example.com."),
+				},
+			},
+			{
+				Desc:  "DNAME query",
+				Qname: "old.example.com.", Qtype: dns.TypeDNAME,
+				Answer: []dns.RR{
+					test.DNAME("old.example.com. 300 IN DNAME example.org."),
+				},
+			},
+			{
+				Desc:  "DNAME owner is not redirected",
+				Qname: "old.example.com.", Qtype: dns.TypeA,
+				Ns: []dns.RR{
+					test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1460498836 44 55 66 100"),
+				},
+			},
+			{
+				Desc:  "DNAME loop",
+				Qname: "a.loop.example.com.", Qtype: dns.TypeA,
+				Rcode: dns.RcodeServerFailure,
+			},
+			// generic types Test
+			{
+				Desc:  "NAPTR Test",
+				Qname: "gen.example.com.", Qtype: dns.TypeNAPTR,
+				Answer: []dns.RR{
+					test.RR(`gen.example.com. 300 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`),
+				},
+			},
+			{
+				Desc:  "SSHFP from rfc3597 data Test",
+				Qname: "gen.example.com.", Qtype: dns.TypeSSHFP,
+				Answer: []dns.RR{
+					test.RR("gen.example.com. 300 IN SSHFP 1 2 0304"),
+				},
+			},
+			{
+				Desc:  "generic type nodata Test",
+				Qname: "gen.example.com.", Qtype: dns.TypeURI,
+				Ns: []dns.RR{
+					test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1460498836 44 55 66 100"),
+				},
+			},
+			// ANY Test
+			{
+				Desc:  "ANY returns a single rrset",
+				Qname: "x.example.com.", Qtype: dns.TypeANY,
+				Answer: []dns.RR{
+					test.A("x.example.com. 300 IN A 1.2.3.4"),
+					test.A("x.example.com. 300 IN A 5.6.7.8"),
+				},
+			},
+			{
+				Desc:  "ANY at cname",
+				Qname: "y.example.com.", Qtype: dns.TypeANY,
+				Answer: []dns.RR{
+					test.CNAME("y.example.com. 300 IN CNAME x.example.com."),
+				},
+			},
+			{
+				Desc:  "ANY without answerable rrset",
+				Qname: "example.com.", Qtype: dns.TypeANY,
+				Answer: []dns.RR{
+					test.HINFO("example.com. 300 IN HINFO RFC8482 \"\""),
+				},
+			},
+			// meta and obsolete types
+			{
+				Desc:  "meta type Test",
+				Qname: "x.example.com.", Qtype: dns.TypeOPT,
+				Rcode: dns.RcodeFormatError,
+			},
+			{
+				Desc:  "obsolete type Test",
+				Qname: "x.example.com.", Qtype: dns.TypeMAILA,
+				Rcode: dns.RcodeNotImplemented,
+			},
 		},
 	},
 	{
@@ -2244,7 +2394,7 @@ var handlerTestCases = []*TestCase{
 			r := storage.NewDataHandler(&testCase.RedisDataConfig)
 			r.Start()
 			l, _ := zap.NewProduction()
-			h := NewHandler(&testCase.HandlerConfig, r, l)
+			h := NewHandler(&testCase.HandlerConfig, r, nil, l)
 			if err := h.RedisData.Clear(); err != nil {
 				return nil, err
 			}
@@ -2417,7 +2567,7 @@ var handlerTestCases = []*TestCase{
 			r := storage.NewDataHandler(&testCase.RedisDataConfig)
 			r.Start()
 			l, _ := zap.NewProduction()
-			h := NewHandler(&testCase.HandlerConfig, r, l)
+			h := NewHandler(&testCase.HandlerConfig, r, nil, l)
 			if err := h.RedisData.Clear(); err != nil {
 				return nil, err
 			}
@@ -2588,3 +2738,313 @@ func TestAllHandler(t *testing.T) {
 		fmt.Println(strings.Repeat("-", 80))
 	}
 }
+
+func TestMinimalANY(t *testing.T) {
+	RegisterTestingT(t)
+	testCase := &TestCase{
+		HandlerConfig: DefaultHandlerTestConfig,
+		Zones:         []string{"any_test.com."},
+		ZoneConfigs: []string{
+			`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.any_test.com.","ns":"ns1.any_test.com.","refresh":44,"retry":55,"expire":66},"dnssec": true}`,
+		},
+		Entries: [][][]string{
+			{
+				{"www",
+					`{"txt":{"ttl":300, "records":[{"text":"foo"}]}}`,
+				},
+				{"mail",
+					`{"ptr":{"ttl":300, "domain":"mail.example.com."}}`,
+				},
+			},
+		},
+	}
+	h, err := DefaultDnssecInitialize()(testCase)
+	Expect(err).To(BeNil())
+	query := func(qname string) *dns.Msg {
+		tc := test.Case{Qname: qname, Qtype: dns.TypeANY, Do: true}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		return w.Msg
+	}
+
+	for qname, rtype := range map[string]uint16{
+		"www.any_test.com.":  dns.TypeTXT,
+		"mail.any_test.com.": dns.TypePTR,
+		"any_test.com.":      dns.TypeHINFO,
+	} {
+		resp := query(qname)
+		Expect(resp.Rcode).To(Equal(dns.RcodeSuccess))
+		Expect(resp.Answer).To(HaveLen(2))
+		Expect(resp.Answer[0].Header().Rrtype).To(Equal(rtype))
+		sig, ok := resp.Answer[1].(*dns.RRSIG)
+		Expect(ok).To(BeTrue())
+		Expect(sig.TypeCovered).To(Equal(rtype))
+	}
+}
+
+func TestDNAMESigning(t *testing.T) {
+	RegisterTestingT(t)
+	testCase := &TestCase{
+		HandlerConfig: DefaultHandlerTestConfig,
+		Zones:         []string{"dname_test.com."},
+		ZoneConfigs: []string{
+			`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.dname_test.com.","ns":"ns1.dname_test.com.","refresh":44,"retry":55,"expire":66},"dnssec": true}`,
+		},
+		Entries: [][][]string{
+			{
+				{"old",
+					`{"dname":{"ttl":300, "target":"new.dname_test.com."}}`,
+				},
+				{"www.new",
+					`{"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]}}`,
+				},
+			},
+		},
+	}
+	h, err := DefaultDnssecInitialize()(testCase)
+	Expect(err).To(BeNil())
+	tc := test.Case{Qname: "www.old.dname_test.com.", Qtype: dns.TypeA, Do: true}
+	w := test.NewRecorder(&test.ResponseWriter{})
+	h.HandleRequest(NewRequestContext(w, tc.Msg()))
+	resp := w.Msg
+	Expect(resp.Rcode).To(Equal(dns.RcodeSuccess))
+
+	covered := map[uint16]bool{}
+	var cname *dns.CNAME
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.RRSIG:
+			covered[rr.TypeCovered] = true
+		case *dns.CNAME:
+			cname = rr
+		}
+	}
+	Expect(cname).NotTo(BeNil())
+	Expect(cname.Target).To(Equal("www.new.dname_test.com."))
+	Expect(covered).To(Equal(map[uint16]bool{dns.TypeDNAME: true, dns.TypeA: true}))
+}
+
+func TestViews(t *testing.T) {
+	RegisterTestingT(t)
+	testCase := &TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"view_test.com."},
+		ZoneConfigs: []string{
+			`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.view_test.com.","ns":"ns1.view_test.com.","refresh":44,"retry":55,"expire":66},
+				"views":[
+					{"name":"internal", "sources":["10.240.0.0/16"]},
+					{"name":"partner", "client_subnets":["192.0.2.0/24"]},
+					{"name":"v6", "listeners":["[::1]:53"]}
+				]}`,
+		},
+		Entries: [][][]string{
+			{
+				{"www",
+					`{"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]},"txt":{"ttl":300, "records":[{"text":"public"}]}}`,
+				},
+			},
+		},
+	}
+	h, err := DefaultInitialize(testCase)
+	Expect(err).To(BeNil())
+	for view, ip := range map[string]string{"internal": "10.0.0.1", "partner": "192.0.2.10"} {
+		rrset := &types.IP_RRSet{GenericRRSet: types.GenericRRSet{TtlValue: 300}, Data: []types.IP_RR{{Ip: net.ParseIP(ip)}}}
+		Expect(h.RedisData.SetViewRRSet("view_test.com.", view, "www", dns.TypeA, rrset)).To(BeNil())
+	}
+
+	query := func(w dns.ResponseWriter, qtype uint16, subnet string) (*dns.Msg, string) {
+		r := test.Case{Qname: "www.view_test.com.", Qtype: qtype}.Msg()
+		if subnet != "" {
+			r.SetEdns0(1232, false)
+			opt := r.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        1,
+				SourceNetmask: 24,
+				Address:       net.ParseIP(subnet),
+			})
+		}
+		recorder := test.NewRecorder(w)
+		context := NewRequestContext(recorder, r)
+		h.HandleRequest(context)
+		return recorder.Msg, context.view
+	}
+
+	// source address selects view
+	resp, view := query(&test.ResponseWriter{}, dns.TypeA, "")
+	Expect(view).To(Equal("internal"))
+	Expect(resp.Answer).To(HaveLen(1))
+	Expect(resp.Answer[0].String()).To(Equal(test.A("www.view_test.com. 300 IN A 10.0.0.1").String()))
+	// rrsets view does not override come from default data
+	resp, _ = query(&test.ResponseWriter{}, dns.TypeTXT, "")
+	Expect(resp.Answer).To(HaveLen(1))
+	Expect(resp.Answer[0].String()).To(Equal(test.TXT("www.view_test.com. 300 IN TXT public").String()))
+
+	// ecs address selects view when source does not match
+	resp, view = query(&test.ResponseWriter6{}, dns.TypeA, "192.0.2.0")
+	Expect(view).To(Equal("partner"))
+	Expect(resp.Answer).To(HaveLen(1))
+	Expect(resp.Answer[0].String()).To(Equal(test.A("www.view_test.com. 300 IN A 192.0.2.10").String()))
+	var scope uint8
+	for _, o := range resp.IsEdns0().Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			scope = subnet.SourceScope
+		}
+	}
+	Expect(scope).To(Equal(uint8(24)))
+
+	// listener selects view, view without overrides answers default data
+	resp, view = query(&test.ResponseWriter6{}, dns.TypeA, "")
+	Expect(view).To(Equal("v6"))
+	Expect(resp.Answer).To(HaveLen(1))
+	Expect(resp.Answer[0].String()).To(Equal(test.A("www.view_test.com. 300 IN A 1.2.3.4").String()))
+}
+
+func TestHealthcheckFilter(t *testing.T) {
+	RegisterTestingT(t)
+	healthCheck := `"health_check":{"enable":true, "protocol":"http", "up_count":3, "down_count":-3, "timeout":1000}`
+	statuses := map[string]map[string]int{
+		"up":      {"1.1.1.1": 3, "1.1.1.2": 3},
+		"down":    {"2.1.1.1": 3, "2.1.1.2": -3},
+		"alldown": {"3.1.1.1": -3, "3.1.1.2": -3},
+		"flap":    {"4.1.1.1": 3, "4.1.1.2": 1, "4.1.1.3": -1},
+		"allflap": {"5.1.1.1": 1, "5.1.1.2": -1, "5.1.1.3": -3},
+	}
+	var entries [][]string
+	for label, ips := range statuses {
+		var records []string
+		for ip := range ips {
+			records = append(records, `{"ip":"`+ip+`"}`)
+		}
+		entries = append(entries, []string{label,
+			`{"a":{"ttl":300, "records":[` + strings.Join(records, ",") + `], "filter":{"count":"multi", "order":"none", "geo_filter":"none"}, ` + healthCheck + `}}`,
+		})
+	}
+	entries = append(entries, []string{"unchecked",
+		`{"a":{"ttl":300, "records":[{"ip":"6.1.1.1"},{"ip":"6.1.1.2"}], "filter":{"count":"multi", "order":"none", "geo_filter":"none"}}}`,
+	})
+	testCase := &TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"hc_test.com."},
+		ZoneConfigs:     []string{`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.hc_test.com.","ns":"ns1.hc_test.com.","refresh":44,"retry":55,"expire":66}}`},
+		Entries:         [][][]string{entries},
+	}
+	h, err := DefaultInitialize(testCase)
+	Expect(err).To(BeNil())
+	statConfig := storage.StatHandlerConfig{Redis: DefaultRedisDataTestConfig.Redis}
+	statConfig.Redis.Prefix = "test_stat_"
+	h.RedisStat = storage.NewStatHandler(&statConfig)
+	defer h.RedisStat.ShutDown()
+	Expect(h.RedisStat.Clear()).To(BeNil())
+	for label, ips := range statuses {
+		for ip, status := range ips {
+			Expect(h.RedisStat.SetHealthcheckItem(&types.HealthCheckItem{
+				Host:   storage.HealthcheckHost("hc_test.com.", label),
+				Ip:     ip,
+				Status: status,
+				Enable: true,
+			})).To(BeNil())
+		}
+	}
+	// status 6.1.1.2 is never looked up since its rrset has no health check
+	Expect(h.RedisStat.SetHealthcheckItem(&types.HealthCheckItem{
+		Host:   storage.HealthcheckHost("hc_test.com.", "unchecked"),
+		Ip:     "6.1.1.2",
+		Status: -3,
+	})).To(BeNil())
+
+	query := func(label string) []string {
+		tc := test.Case{Qname: label + ".hc_test.com.", Qtype: dns.TypeA}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+		var ips []string
+		for _, rr := range w.Msg.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	Expect(query("up")).To(ConsistOf("1.1.1.1", "1.1.1.2"))
+	Expect(query("down")).To(ConsistOf("2.1.1.1"))
+	// all ips are served when every one of them is down
+	Expect(query("alldown")).To(ConsistOf("3.1.1.1", "3.1.1.2"))
+	// ips that are recovering or just failed are not served while another one is up
+	Expect(query("flap")).To(ConsistOf("4.1.1.1"))
+	Expect(query("allflap")).To(ConsistOf("5.1.1.1", "5.1.1.2"))
+	Expect(query("unchecked")).To(ConsistOf("6.1.1.1", "6.1.1.2"))
+}
+
+func TestFailover(t *testing.T) {
+	RegisterTestingT(t)
+	healthCheck := `"health_check":{"enable":true, "protocol":"http", "up_count":3, "down_count":-3, "timeout":1000}`
+	type ip struct {
+		tier   int
+		status int
+	}
+	rrsets := map[string]struct {
+		failover string
+		ips      map[string]ip
+	}{
+		"active":    {`{}`, map[string]ip{"1.0.0.1": {0, 3}, "1.0.0.2": {0, -3}, "1.0.1.1": {1, 3}}},
+		"backup":    {`{}`, map[string]ip{"2.0.0.1": {0, -3}, "2.0.0.2": {0, -3}, "2.0.1.1": {1, 3}, "2.0.1.2": {1, -3}}},
+		"threshold": {`{"tiers":[{"min_healthy":2}]}`, map[string]ip{"3.0.0.1": {0, 3}, "3.0.0.2": {0, -3}, "3.0.1.1": {1, 1}}},
+		"open":      {`{"fail_open":true}`, map[string]ip{"4.0.0.1": {0, -3}, "4.0.1.1": {1, -3}}},
+		"closed":    {`{}`, map[string]ip{"5.0.0.1": {0, -3}, "5.0.1.1": {1, -3}}},
+	}
+	var entries [][]string
+	for label, rrset := range rrsets {
+		var records []string
+		for address, ip := range rrset.ips {
+			records = append(records, fmt.Sprintf(`{"ip":"%s", "tier":%d}`, address, ip.tier))
+		}
+		entries = append(entries, []string{label,
+			`{"a":{"ttl":300, "records":[` + strings.Join(records, ",") + `], "filter":{"count":"multi", "order":"none", "geo_filter":"none"}, "failover":` + rrset.failover + `, ` + healthCheck + `}}`,
+		})
+	}
+	testCase := &TestCase{
+		RedisDataConfig: DefaultRedisDataTestConfig,
+		HandlerConfig:   DefaultHandlerTestConfig,
+		Zones:           []string{"failover_test.com."},
+		ZoneConfigs:     []string{`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.failover_test.com.","ns":"ns1.failover_test.com.","refresh":44,"retry":55,"expire":66}}`},
+		Entries:         [][][]string{entries},
+	}
+	h, err := DefaultInitialize(testCase)
+	Expect(err).To(BeNil())
+	statConfig := storage.StatHandlerConfig{Redis: DefaultRedisDataTestConfig.Redis}
+	statConfig.Redis.Prefix = "test_stat_"
+	h.RedisStat = storage.NewStatHandler(&statConfig)
+	defer h.RedisStat.ShutDown()
+	Expect(h.RedisStat.Clear()).To(BeNil())
+	for label, rrset := range rrsets {
+		for address, ip := range rrset.ips {
+			Expect(h.RedisStat.SetHealthcheckItem(&types.HealthCheckItem{
+				Host:   storage.HealthcheckHost("failover_test.com.", label),
+				Ip:     address,
+				Status: ip.status,
+				Enable: true,
+			})).To(BeNil())
+		}
+	}
+
+	query := func(label string) []string {
+		tc := test.Case{Qname: label + ".failover_test.com.", Qtype: dns.TypeA}
+		w := test.NewRecorder(&test.ResponseWriter{})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+		var ips []string
+		for _, rr := range w.Msg.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	Expect(query("active")).To(ConsistOf("1.0.0.1"))
+	Expect(query("backup")).To(ConsistOf("2.0.1.1"))
+	// active tier needs two healthy ips
+	Expect(query("threshold")).To(ConsistOf("3.0.1.1"))
+	Expect(query("open")).To(ConsistOf("4.0.0.1"))
+	Expect(query("closed")).To(BeEmpty())
+}
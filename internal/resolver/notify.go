@@ -0,0 +1,49 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+)
+
+// notify accepts NOTIFY messages from zone primaries and queues an immediate refresh of secondary zone
+func (h *DnsRequestHandler) notify(context *RequestContext) {
+	if context.RawName() != context.zone.Name || context.QType() != dns.TypeSOA {
+		context.Res = dns.RcodeFormatError
+		h.response(context)
+		return
+	}
+	if !isPrimary(net.ParseIP(context.IP()), context.zone.Config.Primaries) {
+		zap.L().Debug(
+			"notify refused",
+			zap.String("zone", context.zone.Name),
+			zap.String("source", context.IP()),
+		)
+		context.SetError(dns.RcodeRefused, dns.ExtendedErrorCodeProhibited, "notify source is not a primary")
+		h.response(context)
+		return
+	}
+	if err := h.RedisData.AddNotify(context.zone.Name); err != nil {
+		zap.L().Error("cannot queue notify", zap.String("zone", context.zone.Name), zap.Error(err))
+		context.storageFailure()
+		h.response(context)
+		return
+	}
+	h.response(context)
+}
+
+func isPrimary(ip net.IP, primaries []string) bool {
+	if ip == nil {
+		return false
+	}
+	for _, primary := range primaries {
+		host := primary
+		if h, _, err := net.SplitHostPort(primary); err == nil {
+			host = h
+		}
+		if primaryIp := net.ParseIP(host); primaryIp != nil && primaryIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
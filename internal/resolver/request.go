@@ -2,7 +2,9 @@ package resolver
 
 import (
 	"github.com/coredns/coredns/request"
+	"z42-core/internal/storage"
 	"z42-core/internal/types"
+	"z42-core/pkg/ratelimit"
 	"github.com/miekg/dns"
 	"net"
 	"strings"
@@ -27,7 +29,18 @@ type RequestContext struct {
 
 	name string
 
-	zone *types.Zone
+	zone          *types.Zone
+	view          string
+	data          *storage.DataView
+	validCookie   bool
+	truncated     bool
+	limit         ratelimit.ResponseAction
+	clientSubnet  *dns.EDNS0_SUBNET
+	subnetSource  uint8
+	subnetScope   uint8
+	extendedError *dns.EDNS0_EDE
+	// cnames synthesized from dnames, validators synthesize them too so they are not signed
+	synthesized []dns.RR
 }
 
 func NewRequestContext(w dns.ResponseWriter, r *dns.Msg) *RequestContext {
@@ -61,6 +74,19 @@ func (context *RequestContext) sourceIp() net.IP {
 	return net.ParseIP(context.IP())
 }
 
+func (context *RequestContext) subnetOption() *dns.EDNS0_SUBNET {
+	opt := context.Req.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
+
 func (context *RequestContext) sourceSubnet() string {
 	opt := context.Req.IsEdns0()
 	if opt != nil && len(opt.Option) != 0 {
@@ -91,16 +117,89 @@ func (context *RequestContext) RawName() string {
 	return context.name
 }
 
+// Transport returns protocol request was received over, listeners that are not plain dns report their own
+func (context *RequestContext) Transport() string {
+	if t, ok := context.W.(interface{ Transport() string }); ok {
+		return t.Transport()
+	}
+	if t, ok := context.W.(dns.ConnectionStater); ok && t.ConnectionState() != nil {
+		return "tcp-tls"
+	}
+	return context.Proto()
+}
+
+// SetError sets response code and an extended dns error (rfc8914) telling client why request failed
+func (context *RequestContext) SetError(res int, code uint16, text string) {
+	context.Res = res
+	context.extendedError = &dns.EDNS0_EDE{InfoCode: code, ExtraText: text}
+}
+
+// storageFailure fails request when zone data cannot be read from storage
+func (context *RequestContext) storageFailure() {
+	context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNotReady, "zone data is not available")
+}
+
+// clearSections removes all records from response except opt records carrying edns options like cookies
+func (context *RequestContext) clearSections() {
+	var opt []dns.RR
+	for _, rr := range context.Additional {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			opt = append(opt, rr)
+		}
+	}
+	context.Answer, context.Authority, context.Additional = nil, nil, opt
+}
+
+func (context *RequestContext) isSynthesized(rr dns.RR) bool {
+	for _, s := range context.synthesized {
+		if s == rr {
+			return true
+		}
+	}
+	return false
+}
+
 func (context *RequestContext) Response() {
 	m := new(dns.Msg)
 	m.Authoritative, m.RecursionAvailable, m.Compress = context.Auth, false, true
+	m.Truncated = context.truncated
 	m.SetRcode(context.Req, context.Res)
 	m.Answer = append(m.Answer, context.Answer...)
 	m.Ns = append(m.Ns, context.Authority...)
 	m.Extra = append(m.Extra, context.Additional...)
 
 	context.SizeAndDo(m)
+	if opt := m.IsEdns0(); opt != nil && context.clientSubnet != nil {
+		// source prefix and address are echoed as received (rfc7871 section 7.2.1)
+		opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        context.clientSubnet.Family,
+			SourceNetmask: context.clientSubnet.SourceNetmask,
+			SourceScope:   context.subnetScope,
+			Address:       context.clientSubnet.Address,
+		})
+	}
+	if opt := m.IsEdns0(); opt != nil && context.extendedError != nil {
+		opt.Option = append(opt.Option, context.extendedError)
+	}
 	m = context.Scrub(m)
+	if t := context.Req.IsTsig(); t != nil {
+		status := context.W.TsigStatus()
+		m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+		m.Extra[len(m.Extra)-1].(*dns.TSIG).Error = tsigError(status)
+		// responses to requests with unknown keys or bad signatures carry an empty mac (rfc8945 section 5.3.2),
+		// writer would try to sign them
+		if status != nil && status != dns.ErrTime {
+			data, err := m.Pack()
+			if err == nil {
+				_, err = context.W.Write(data)
+			}
+			if err != nil {
+				_ = context.W.Close()
+			}
+			return
+		}
+	}
 	if err := context.W.WriteMsg(m); err != nil {
 		// zap.L().Error("write error", zap.Error(err), zap.String("msg", m.String()))
 		_ = context.W.Close()
@@ -0,0 +1,158 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"z42-core/internal/test"
+	"z42-core/internal/types"
+	"z42-core/pkg/ratelimit"
+)
+
+func TestExtendedError(t *testing.T) {
+	RegisterTestingT(t)
+	extendedError := func(m *dns.Msg) *dns.EDNS0_EDE {
+		opt := m.IsEdns0()
+		if opt == nil {
+			return nil
+		}
+		for _, o := range opt.Option {
+			if e, ok := o.(*dns.EDNS0_EDE); ok {
+				return e
+			}
+		}
+		return nil
+	}
+
+	r := test.Case{Qname: "example.com.", Qtype: dns.TypeA}.Msg()
+	r.SetEdns0(1232, true)
+	w := test.NewRecorder(&test.ResponseWriter{})
+	context := NewRequestContext(w, r)
+	context.SetError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNetworkError, "aname upstream query failed")
+	context.Response()
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeServerFailure))
+	e := extendedError(w.Msg)
+	Expect(e).NotTo(BeNil())
+	Expect(e.InfoCode).To(Equal(dns.ExtendedErrorCodeNetworkError))
+	Expect(e.ExtraText).To(Equal("aname upstream query failed"))
+
+	// extended errors need edns
+	r = test.Case{Qname: "example.com.", Qtype: dns.TypeA}.Msg()
+	w = test.NewRecorder(&test.ResponseWriter{})
+	context = NewRequestContext(w, r)
+	context.storageFailure()
+	context.Response()
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeServerFailure))
+	Expect(w.Msg.IsEdns0()).To(BeNil())
+
+	// signed zone without an active zone signing key cannot give valid answers
+	r = test.Case{Qname: "example.com.", Qtype: dns.TypeA}.Msg()
+	r.SetEdns0(1232, true)
+	w = test.NewRecorder(&test.ResponseWriter{})
+	context = NewRequestContext(w, r)
+	context.zone = &types.Zone{Name: "example.com.", Config: &types.ZoneConfig{DnsSec: true}}
+	context.dnssec = true
+	context.Answer = []dns.RR{test.A("example.com. 300 IN A 1.2.3.4")}
+	h := &DnsRequestHandler{}
+	h.applyDnssec(context)
+	context.Response()
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeServerFailure))
+	Expect(w.Msg.Answer).To(BeEmpty())
+	Expect(extendedError(w.Msg).InfoCode).To(Equal(dns.ExtendedErrorCodeRRSIGsMissing))
+}
+
+type tsigFailedWriter struct {
+	test.ResponseWriter
+	status error
+	data   []byte
+}
+
+func (w *tsigFailedWriter) TsigStatus() error { return w.status }
+
+func (w *tsigFailedWriter) WriteMsg(m *dns.Msg) error {
+	if m.IsTsig() != nil {
+		_, _, err := dns.TsigGenerate(m, "c2VjcmV0", "", false)
+		return err
+	}
+	return nil
+}
+
+func (w *tsigFailedWriter) Write(data []byte) (int, error) {
+	w.data = data
+	return len(data), nil
+}
+
+func TestTsigFailedResponse(t *testing.T) {
+	RegisterTestingT(t)
+	for status, tsigError := range map[error]uint16{dns.ErrSecret: dns.RcodeBadKey, dns.ErrSig: dns.RcodeBadSig} {
+		r := new(dns.Msg)
+		r.SetUpdate("example.com.")
+		r.SetTsig("unknown.example.com.", dns.HmacSHA256, 300, time.Now().Unix())
+		w := &tsigFailedWriter{status: status}
+		context := NewRequestContext(w, r)
+		context.Res = dns.RcodeNotAuth
+		context.Response()
+		Expect(w.data).NotTo(BeNil())
+		m := new(dns.Msg)
+		Expect(m.Unpack(w.data)).To(BeNil())
+		Expect(m.Rcode).To(Equal(dns.RcodeNotAuth))
+		tsig := m.IsTsig()
+		Expect(tsig).NotTo(BeNil())
+		Expect(tsig.Error).To(Equal(tsigError))
+		Expect(tsig.MAC).To(BeEmpty())
+	}
+}
+
+// transportWriter records responses and reports its transport like doh and doq writers of server package,
+// those use tcp addresses for all requests
+type transportWriter struct {
+	test.ResponseWriter
+	transport string
+	msgs      []*dns.Msg
+}
+
+func (w *transportWriter) Transport() string { return w.transport }
+
+func (w *transportWriter) WriteMsg(m *dns.Msg) error {
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+
+func TestResponseRateLimitTransports(t *testing.T) {
+	RegisterTestingT(t)
+	config := ratelimit.DefaultResponseRateLimitConfig()
+	config.Enable = true
+	config.ResponsesPerSecond = 1
+	config.Slip = 2
+	for _, w := range []*transportWriter{
+		{transport: "udp"},
+		{transport: "tcp", ResponseWriter: test.ResponseWriter{TCP: true}},
+		{transport: "https", ResponseWriter: test.ResponseWriter{TCP: true}},
+		{transport: "doq", ResponseWriter: test.ResponseWriter{TCP: true}},
+	} {
+		h := &DnsRequestHandler{requestLogger: zap.NewNop(), rrl: ratelimit.NewResponseRateLimiter(&config)}
+		for i := 0; i < 4; i++ {
+			context := NewRequestContext(w, test.Case{Qname: "www.example.com.", Qtype: dns.TypeA}.Msg())
+			context.Answer = []dns.RR{test.A("www.example.com. 300 IN A 1.2.3.4")}
+			h.response(context)
+		}
+		if w.transport == "udp" {
+			// send, drop, slip, drop
+			Expect(w.msgs).To(HaveLen(2), w.transport)
+			Expect(w.msgs[0].Answer).To(HaveLen(1))
+			Expect(w.msgs[1].Truncated).To(BeTrue())
+			Expect(w.msgs[1].Answer).To(BeEmpty())
+			Expect(h.ResponseRateLimitStats()).To(Equal(ratelimit.ResponseRateLimitStats{Responses: 4, Limited: 3, Slipped: 1, Dropped: 2}))
+			continue
+		}
+		Expect(w.msgs).To(HaveLen(4), w.transport)
+		for _, m := range w.msgs {
+			Expect(m.Truncated).To(BeFalse(), w.transport)
+			Expect(m.Answer).To(HaveLen(1), w.transport)
+		}
+		Expect(h.ResponseRateLimitStats().Responses).To(BeZero(), w.transport)
+	}
+}
@@ -2,6 +2,8 @@ package resolver
 
 import (
 	"z42-core/internal/test"
+	"z42-core/internal/types"
+	"z42-core/pkg/geoip"
 	"github.com/miekg/dns"
 	. "github.com/onsi/gomega"
 	"net"
@@ -38,3 +40,86 @@ func TestSubnet(t *testing.T) {
 	address := state.SourceIp
 	Expect(address.String()).To(Equal(sa))
 }
+
+func TestClientSubnetScope(t *testing.T) {
+	RegisterTestingT(t)
+	cfg := DefaultDnsRequestHandlerConfig()
+	h := &DnsRequestHandler{Config: &cfg, geoip: geoip.NewGeoIp(&geoip.Config{Enable: false})}
+	query := func(family uint16, address string, source uint8, scope uint8) (*RequestContext, *test.Recorder, bool) {
+		r := test.Case{Qname: "example.com.", Qtype: dns.TypeA}.Msg()
+		r.SetEdns0(1232, false)
+		opt := r.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        family,
+			SourceNetmask: source,
+			SourceScope:   scope,
+			Address:       net.ParseIP(address),
+		})
+		w := test.NewRecorder(&test.ResponseWriter{})
+		context := NewRequestContext(w, r)
+		return context, w, h.clientSubnet(context)
+	}
+	responseSubnet := func(w *test.Recorder) *dns.EDNS0_SUBNET {
+		for _, o := range w.Msg.IsEdns0().Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				return subnet
+			}
+		}
+		return nil
+	}
+	geoRRSet := &types.IP_RRSet{
+		FilterConfig: types.IpFilterConfig{Count: "multi", Order: "none", GeoFilter: "country"},
+		Data:         []types.IP_RR{{Ip: net.ParseIP("1.2.3.4")}},
+	}
+	plainRRSet := &types.IP_RRSet{
+		FilterConfig: types.IpFilterConfig{Count: "multi", Order: "none", GeoFilter: "none"},
+		Data:         []types.IP_RR{{Ip: net.ParseIP("1.2.3.4")}},
+	}
+
+	// long source prefixes are truncated and scope reflects truncated prefix when geo filter is used
+	context, w, ok := query(1, "192.168.1.2", 32, 0)
+	Expect(ok).To(BeTrue())
+	Expect(context.SourceIp.String()).To(Equal("192.168.1.0"))
+	h.filter(context, "@", geoRRSet)
+	context.Response()
+	subnet := responseSubnet(w)
+	Expect(subnet).NotTo(BeNil())
+	Expect(subnet.SourceNetmask).To(Equal(uint8(32)))
+	Expect(subnet.SourceScope).To(Equal(uint8(24)))
+	Expect(subnet.Address.String()).To(Equal("192.168.1.2"))
+
+	// answers that do not depend on client location are valid for everyone
+	context, w, ok = query(1, "192.168.1.0", 24, 0)
+	Expect(ok).To(BeTrue())
+	h.filter(context, "@", plainRRSet)
+	context.Response()
+	Expect(responseSubnet(w).SourceScope).To(Equal(uint8(0)))
+
+	context, w, ok = query(2, "2001:db8:1:2::", 64, 0)
+	Expect(ok).To(BeTrue())
+	Expect(context.SourceIp.String()).To(Equal("2001:db8:1::"))
+	h.filter(context, "@", geoRRSet)
+	context.Response()
+	Expect(responseSubnet(w).SourceScope).To(Equal(uint8(56)))
+
+	// source prefix 0 asks server not to use client address
+	context, _, ok = query(1, "0.0.0.0", 0, 0)
+	Expect(ok).To(BeTrue())
+	Expect(context.SourceIp.String()).To(Equal(context.IP()))
+
+	// invalid options
+	_, _, ok = query(1, "192.168.1.0", 24, 24)
+	Expect(ok).To(BeFalse())
+	_, _, ok = query(1, "192.168.1.2", 24, 0)
+	Expect(ok).To(BeFalse())
+
+	// requests without ecs get no ecs option back
+	r := test.Case{Qname: "example.com.", Qtype: dns.TypeA}.Msg()
+	r.SetEdns0(1232, false)
+	w = test.NewRecorder(&test.ResponseWriter{})
+	context = NewRequestContext(w, r)
+	Expect(h.clientSubnet(context)).To(BeTrue())
+	context.Response()
+	Expect(responseSubnet(w)).To(BeNil())
+}
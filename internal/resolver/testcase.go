@@ -31,7 +31,7 @@ func DefaultInitialize(testCase *TestCase) (*DnsRequestHandler, error) {
 	r := storage.NewDataHandler(&testCase.RedisDataConfig)
 	r.Start()
 	l, _ := zap.NewProduction()
-	h := NewHandler(&testCase.HandlerConfig, r, l)
+	h := NewHandler(&testCase.HandlerConfig, r, nil, l)
 	if err := h.RedisData.Clear(); err != nil {
 		return nil, err
 	}
@@ -74,8 +74,10 @@ var DefaultRedisDataTestConfig = storage.DataHandlerConfig{
 	ZoneReload:         60,
 	RecordCacheSize:    1000000,
 	RecordCacheTimeout: 60,
+	SignatureCacheSize: 100000,
 	MinTTL:             5,
 	MaxTTL:             3600,
+	JournalSize:        100,
 	Redis: hiredis.Config{
 		Address:  "127.0.0.1:6379",
 		Net:      "tcp",
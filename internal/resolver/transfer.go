@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"z42-core/internal/types"
+)
+
+const transferChunkSize = 100
+
+// transfer answers AXFR and IXFR queries, full transfers are only served over tcp
+// to addresses listed in zone allow_transfer
+func (h *DnsRequestHandler) transfer(context *RequestContext) {
+	if context.RawName() != context.zone.Name {
+		context.Res = dns.RcodeNotAuth
+		h.response(context)
+		return
+	}
+	if !types.NetworksContain(context.zone.Config.AllowTransfer, net.ParseIP(context.IP())) {
+		zap.L().Debug(
+			"transfer refused",
+			zap.String("zone", context.zone.Name),
+			zap.String("source", context.IP()),
+		)
+		context.SetError(dns.RcodeRefused, dns.ExtendedErrorCodeProhibited, "transfer not allowed")
+		h.response(context)
+		return
+	}
+
+	soa := context.zone.Config.SOA.Data
+	var (
+		records []dns.RR
+		err     error
+	)
+	switch context.QType() {
+	case dns.TypeIXFR:
+		serial, ok := ixfrSerial(context.Req)
+		if !ok {
+			context.Res = dns.RcodeFormatError
+			h.response(context)
+			return
+		}
+		// client is up to date or ixfr over udp, answer with current soa only
+		if !types.SerialLess(serial, soa.Serial) || context.Proto() != "tcp" {
+			context.Answer = []dns.RR{soa}
+			h.response(context)
+			return
+		}
+		records, err = h.incrementalRecords(context, serial)
+		if err != nil {
+			zap.L().Debug(
+				"incremental transfer not available, sending full zone",
+				zap.String("zone", context.zone.Name),
+				zap.Uint32("serial", serial),
+				zap.Error(err),
+			)
+			records, err = h.zoneRecords(context)
+		}
+	default:
+		if context.Proto() != "tcp" {
+			context.Res = dns.RcodeFormatError
+			h.response(context)
+			return
+		}
+		records, err = h.zoneRecords(context)
+	}
+	if err != nil {
+		context.storageFailure()
+		h.response(context)
+		return
+	}
+
+	ch := make(chan *dns.Envelope, len(records)/transferChunkSize+1)
+	for start := 0; start < len(records); start += transferChunkSize {
+		end := start + transferChunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+		ch <- &dns.Envelope{RR: records[start:end]}
+	}
+	close(ch)
+
+	tr := new(dns.Transfer)
+	if err := tr.Out(context.W, context.Req, ch); err != nil {
+		zap.L().Error("zone transfer failed", zap.String("zone", context.zone.Name), zap.Error(err))
+	}
+	h.logRequest(context)
+}
+
+// zoneRecords returns zone contents surrounded by zone soa as required for AXFR
+func (h *DnsRequestHandler) zoneRecords(context *RequestContext) ([]dns.RR, error) {
+	zone := context.zone
+	soa := zone.Config.SOA.Data
+	records := []dns.RR{soa}
+	for _, location := range zone.LocationsList {
+		name := zone.Name
+		if location != "@" {
+			name = location + "." + zone.Name
+		}
+		for _, rtype := range types.TransferTypes {
+			rrset, err := h.RedisData.RRSet(zone.Name, location, rtype)
+			if err != nil {
+				return nil, err
+			}
+			if rrset.Empty() {
+				continue
+			}
+			records = append(records, rrset.Value(name)...)
+		}
+	}
+	return append(records, soa), nil
+}
+
+// incrementalRecords builds an IXFR response from zone journal as a sequence of
+// (old soa, deleted records, new soa, added records) blocks
+func (h *DnsRequestHandler) incrementalRecords(context *RequestContext, serial uint32) ([]dns.RR, error) {
+	soa := context.zone.Config.SOA.Data
+	entries, err := h.RedisData.Journal(context.zone.Name, serial, soa.Serial)
+	if err != nil {
+		return nil, err
+	}
+	records := []dns.RR{soa}
+	for _, entry := range entries {
+		from := dns.Copy(soa).(*dns.SOA)
+		from.Serial = serial
+		records = append(records, from)
+		for _, s := range entry.Deleted {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rr)
+		}
+		to := dns.Copy(soa).(*dns.SOA)
+		to.Serial = entry.Serial
+		records = append(records, to)
+		for _, s := range entry.Added {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rr)
+		}
+		serial = entry.Serial
+	}
+	return append(records, soa), nil
+}
+
+func ixfrSerial(r *dns.Msg) (uint32, bool) {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"sort"
+	"testing"
+	"z42-core/internal/test"
+)
+
+var transferTestCase = &TestCase{
+	Name:            "Zone Transfer",
+	Description:     "Test AXFR and IXFR",
+	Enabled:         true,
+	RedisDataConfig: DefaultRedisDataTestConfig,
+	HandlerConfig:   DefaultHandlerTestConfig,
+	Initialize:      DefaultInitialize,
+	Zones:           []string{"example.com.", "denied.com."},
+	ZoneConfigs: []string{
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.example.com.","ns":"ns1.example.com.","refresh":44,"retry":55,"expire":66, "serial":100}, "allow_transfer":["10.240.0.0/16"]}`,
+		`{"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.denied.com.","ns":"ns1.denied.com.","refresh":44,"retry":55,"expire":66, "serial":100}, "allow_transfer":["192.168.1.1"]}`,
+	},
+	Entries: [][][]string{
+		{
+			{"@",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.example.com."}]}}`,
+			},
+			{"www",
+				`{
+					"a":{"ttl":300, "records":[{"ip":"1.2.3.4"}]},
+					"txt":{"ttl":300, "records":[{"text":"foo"}]}
+				}`,
+			},
+			{"ns1",
+				`{"a":{"ttl":300, "records":[{"ip":"2.2.2.2"}]}}`,
+			},
+		},
+		{
+			{"@",
+				`{"ns":{"ttl":300, "records":[{"host":"ns1.denied.com."}]}}`,
+			},
+		},
+	},
+	TestCases: []test.Case{
+		{
+			Desc:  "full zone transfer",
+			Qname: "example.com.", Qtype: dns.TypeAXFR,
+			Answer: []dns.RR{
+				test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 100 44 55 66 100"),
+				test.NS("example.com. 300 IN NS ns1.example.com."),
+				test.A("www.example.com. 300 IN A 1.2.3.4"),
+				test.TXT("www.example.com. 300 IN TXT \"foo\""),
+				test.A("ns1.example.com. 300 IN A 2.2.2.2"),
+				test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 100 44 55 66 100"),
+			},
+		},
+		{
+			Desc:  "transfer of non-apex name",
+			Qname: "www.example.com.", Qtype: dns.TypeAXFR,
+			Rcode: dns.RcodeNotAuth,
+		},
+		{
+			Desc:  "transfer not in allow list",
+			Qname: "denied.com.", Qtype: dns.TypeAXFR,
+			Rcode: dns.RcodeRefused,
+		},
+	},
+}
+
+func TestTransfer(t *testing.T) {
+	RegisterTestingT(t)
+	h, err := transferTestCase.Initialize(transferTestCase)
+	Expect(err).To(BeNil())
+
+	for _, tc := range transferTestCase.TestCases {
+		w := test.NewRecorder(&test.ResponseWriter{TCP: true})
+		h.HandleRequest(NewRequestContext(w, tc.Msg()))
+		sort.Sort(test.RRSet(tc.Answer))
+		Expect(test.SortAndCheck(w.Msg, tc)).To(BeNil())
+	}
+
+	// axfr is not allowed over udp
+	w := test.NewRecorder(&test.ResponseWriter{})
+	h.HandleRequest(NewRequestContext(w, test.Case{Qname: "example.com.", Qtype: dns.TypeAXFR}.Msg()))
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeFormatError))
+
+	// ixfr from current serial returns current soa
+	r := test.Case{Qname: "example.com.", Qtype: dns.TypeIXFR}.Msg()
+	r.Ns = []dns.RR{test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 100 44 55 66 100")}
+	w = test.NewRecorder(&test.ResponseWriter{TCP: true})
+	h.HandleRequest(NewRequestContext(w, r))
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+	Expect(w.Msg.Answer).To(HaveLen(1))
+	Expect(w.Msg.Answer[0].(*dns.SOA).Serial).To(Equal(uint32(100)))
+
+	// ixfr without journal falls back to full zone
+	r.Ns = []dns.RR{test.SOA("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 90 44 55 66 100")}
+	w = test.NewRecorder(&test.ResponseWriter{TCP: true})
+	h.HandleRequest(NewRequestContext(w, r))
+	Expect(w.Msg.Rcode).To(Equal(dns.RcodeSuccess))
+	Expect(w.Msg.Answer).To(HaveLen(6))
+}
@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/miekg/dns"
+	"hash"
+	"z42-core/internal/storage"
+)
+
+// tsigProvider signs and verifies messages with zone tsig keys stored in redis
+type tsigProvider struct {
+	redisData *storage.DataHandler
+}
+
+func (p *tsigProvider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	_, key, err := p.redisData.TSIGKey(t.Hdr.Name)
+	if err != nil {
+		return nil, dns.ErrSecret
+	}
+	if dns.CanonicalName(key.Algorithm) != dns.CanonicalName(t.Algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	return tsigHMAC(msg, key.Secret, t.Algorithm)
+}
+
+func (p *tsigProvider) Verify(msg []byte, t *dns.TSIG) error {
+	expected, err := p.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, expected) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+func tsigHMAC(msg []byte, secret string, algorithm string) ([]byte, error) {
+	rawSecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	var h func() hash.Hash
+	switch dns.CanonicalName(algorithm) {
+	case dns.HmacSHA1:
+		h = sha1.New
+	case dns.HmacSHA224:
+		h = sha256.New224
+	case dns.HmacSHA256:
+		h = sha256.New
+	case dns.HmacSHA384:
+		h = sha512.New384
+	case dns.HmacSHA512:
+		h = sha512.New
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	m := hmac.New(h, rawSecret)
+	m.Write(msg)
+	return m.Sum(nil), nil
+}
+
+// tsigError converts tsig verification status to tsig error code
+func tsigError(status error) uint16 {
+	switch status {
+	case nil:
+		return dns.RcodeSuccess
+	case dns.ErrSig:
+		return dns.RcodeBadSig
+	case dns.ErrTime:
+		return dns.RcodeBadTime
+	default:
+		return dns.RcodeBadKey
+	}
+}
@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"encoding/hex"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+type secretProvider string
+
+func (s secretProvider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	return tsigHMAC(msg, string(s), t.Algorithm)
+}
+
+func (s secretProvider) Verify(msg []byte, t *dns.TSIG) error {
+	mac, err := s.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(mac) != t.MAC {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+func TestTsigHMAC(t *testing.T) {
+	RegisterTestingT(t)
+	secret := "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+	for _, algorithm := range []string{dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512} {
+		m := new(dns.Msg)
+		m.SetUpdate("example.com.")
+		m.SetTsig("key.example.com.", algorithm, 300, time.Now().Unix())
+		signed, _, err := dns.TsigGenerate(m, secret, "", false)
+		Expect(err).To(BeNil())
+		Expect(dns.TsigVerifyWithProvider(append([]byte{}, signed...), secretProvider(secret), "", false)).To(BeNil())
+		Expect(dns.TsigVerifyWithProvider(append([]byte{}, signed...), secretProvider("b3RoZXI="), "", false)).To(Equal(dns.ErrSig))
+	}
+	_, err := tsigHMAC([]byte{}, "c2VjcmV0", "hmac-md5.sig-alg.reg.int.")
+	Expect(err).To(Equal(dns.ErrKeyAlg))
+}
+
+func TestTsigError(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(tsigError(nil)).To(Equal(uint16(dns.RcodeSuccess)))
+	Expect(tsigError(dns.ErrSig)).To(Equal(uint16(dns.RcodeBadSig)))
+	Expect(tsigError(dns.ErrTime)).To(Equal(uint16(dns.RcodeBadTime)))
+	Expect(tsigError(dns.ErrSecret)).To(Equal(uint16(dns.RcodeBadKey)))
+}
@@ -0,0 +1,484 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"z42-core/internal/api/database"
+	"z42-core/internal/types"
+)
+
+// updateStorage is the part of database used to commit dynamic updates
+type updateStorage interface {
+	GetTSIGKeyUser(zoneName string, name string) (database.ObjectId, error)
+	ApplyRecordSetChanges(userId database.ObjectId, zoneName string, changes []database.RecordSetChange) error
+}
+
+// update handles rfc2136 dynamic updates signed with one of the zone tsig keys
+func (h *DnsRequestHandler) update(context *RequestContext) {
+	zone := context.zone
+	if h.db == nil {
+		context.Res = dns.RcodeNotImplemented
+		h.response(context)
+		return
+	}
+	if len(context.Req.Question) != 1 || context.RawName() != zone.Name || context.QType() != dns.TypeSOA {
+		context.Res = dns.RcodeFormatError
+		h.response(context)
+		return
+	}
+	if len(zone.Config.Primaries) > 0 {
+		context.SetError(dns.RcodeRefused, dns.ExtendedErrorCodeProhibited, "secondary zone")
+		h.response(context)
+		return
+	}
+	t := context.Req.IsTsig()
+	if t == nil {
+		zap.L().Debug("unsigned update refused", zap.String("zone", zone.Name), zap.String("source", context.IP()))
+		context.SetError(dns.RcodeRefused, dns.ExtendedErrorCodeProhibited, "update is not signed")
+		h.response(context)
+		return
+	}
+	keyName := dns.CanonicalName(t.Hdr.Name)
+	keyZone, _, err := h.RedisData.TSIGKey(keyName)
+	if err != nil || keyZone != zone.Name {
+		zap.L().Debug("tsig key not valid for zone", zap.String("zone", zone.Name), zap.String("key", keyName))
+		context.Res = dns.RcodeNotAuth
+		h.response(context)
+		return
+	}
+	userId, err := h.db.GetTSIGKeyUser(zone.Name, keyName)
+	if err == database.ErrNotFound {
+		context.Res = dns.RcodeNotAuth
+		h.response(context)
+		return
+	} else if err != nil {
+		zap.L().Error("cannot get tsig key owner", zap.String("zone", zone.Name), zap.String("key", keyName), zap.Error(err))
+		context.Res = dns.RcodeServerFailure
+		h.response(context)
+		return
+	}
+
+	u := newZoneUpdate(zone, h.RedisData.RRSet)
+	if context.Res, err = u.checkPrerequisites(context.Req.Answer); err == nil && context.Res == dns.RcodeSuccess {
+		if context.Res = prescanUpdate(zone.Name, context.Req.Ns); context.Res == dns.RcodeSuccess {
+			err = u.apply(context.Req.Ns)
+		}
+	}
+	if err == nil && context.Res == dns.RcodeSuccess {
+		err = h.commitUpdate(userId, u)
+	}
+	if err != nil {
+		zap.L().Error("cannot apply update", zap.String("zone", zone.Name), zap.String("key", keyName), zap.Error(err))
+		context.Res = dns.RcodeServerFailure
+	}
+	h.response(context)
+}
+
+// commitUpdate writes changed rrsets to database so they go through the regular event flow
+func (h *DnsRequestHandler) commitUpdate(userId database.ObjectId, u *zoneUpdate) error {
+	var changes []database.RecordSetChange
+	for _, key := range u.changes() {
+		rrset, err := u.rrset(key)
+		if err != nil {
+			return err
+		}
+		change := database.RecordSetChange{Location: key.label, Type: types.TypeToString(key.rtype)}
+		if !rrset.Empty() {
+			change.Value = rrset
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	// rfc2136 3.4.2: all changes are applied or none of them
+	if err := h.db.ApplyRecordSetChanges(userId, u.zone.Name, changes); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		zap.L().Info(
+			"rrset updated",
+			zap.String("zone", u.zone.Name),
+			zap.String("location", change.Location),
+			zap.String("type", change.Type),
+		)
+	}
+	return nil
+}
+
+type rrsetKey struct {
+	label string
+	rtype uint16
+}
+
+// zoneUpdate keeps the state of zone rrsets while an update message is being applied
+type zoneUpdate struct {
+	zone     *types.Zone
+	getRRSet func(zone string, label string, rtype uint16) (types.RRSet, error)
+	current  map[rrsetKey]types.RRSet
+	original map[rrsetKey][]dns.RR
+	records  map[rrsetKey][]dns.RR
+}
+
+func newZoneUpdate(zone *types.Zone, getRRSet func(zone string, label string, rtype uint16) (types.RRSet, error)) *zoneUpdate {
+	return &zoneUpdate{
+		zone:     zone,
+		getRRSet: getRRSet,
+		current:  make(map[rrsetKey]types.RRSet),
+		original: make(map[rrsetKey][]dns.RR),
+		records:  make(map[rrsetKey][]dns.RR),
+	}
+}
+
+func (u *zoneUpdate) load(key rrsetKey) ([]dns.RR, error) {
+	if records, ok := u.records[key]; ok {
+		return records, nil
+	}
+	var records []dns.RR
+	switch {
+	case key.rtype == dns.TypeSOA:
+		if key.label == "@" {
+			records = []dns.RR{u.zone.Config.SOA.Data}
+		}
+	case isUpdateType(key.rtype):
+		rrset, err := u.getRRSet(u.zone.Name, key.label, key.rtype)
+		if err != nil {
+			return nil, err
+		}
+		u.current[key] = rrset
+		for _, rr := range rrset.Value(ownerName(key.label, u.zone.Name)) {
+			if rr.Header().Rrtype == key.rtype {
+				records = append(records, rr)
+			}
+		}
+	}
+	u.original[key] = records
+	u.records[key] = records
+	return records, nil
+}
+
+func (u *zoneUpdate) nameInUse(label string) (bool, error) {
+	if label == "@" {
+		return true, nil
+	}
+	for _, t := range types.TransferTypes {
+		records, err := u.load(rrsetKey{label, t})
+		if err != nil {
+			return false, err
+		}
+		if len(records) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkPrerequisites checks prerequisite section as described in rfc2136 section 3.2
+func (u *zoneUpdate) checkPrerequisites(prerequisites []dns.RR) (int, error) {
+	var (
+		keys     []rrsetKey
+		expected = make(map[rrsetKey][]dns.RR)
+	)
+	for _, rr := range prerequisites {
+		hdr := rr.Header()
+		label, ok := zoneLabel(hdr.Name, u.zone.Name)
+		if !ok {
+			return dns.RcodeNotZone, nil
+		}
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError, nil
+		}
+		key := rrsetKey{label, hdr.Rrtype}
+		switch hdr.Class {
+		case dns.ClassANY, dns.ClassNONE:
+			if !emptyRdata(rr) {
+				return dns.RcodeFormatError, nil
+			}
+			var (
+				exists bool
+				err    error
+			)
+			if hdr.Rrtype == dns.TypeANY {
+				exists, err = u.nameInUse(label)
+			} else {
+				var records []dns.RR
+				records, err = u.load(key)
+				exists = len(records) > 0
+			}
+			if err != nil {
+				return dns.RcodeServerFailure, err
+			}
+			switch {
+			case hdr.Class == dns.ClassANY && !exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeNameError, nil
+			case hdr.Class == dns.ClassANY && !exists:
+				return dns.RcodeNXRrset, nil
+			case hdr.Class == dns.ClassNONE && exists && hdr.Rrtype == dns.TypeANY:
+				return dns.RcodeYXDomain, nil
+			case hdr.Class == dns.ClassNONE && exists:
+				return dns.RcodeYXRrset, nil
+			}
+		case dns.ClassINET:
+			if _, ok := expected[key]; !ok {
+				keys = append(keys, key)
+			}
+			expected[key] = append(expected[key], rr)
+		default:
+			return dns.RcodeFormatError, nil
+		}
+	}
+	for _, key := range keys {
+		records, err := u.load(key)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		if !sameRecords(records, expected[key]) {
+			return dns.RcodeNXRrset, nil
+		}
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// prescanUpdate validates update section before any change is applied, rfc2136 section 3.4.1
+func prescanUpdate(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if _, ok := zoneLabel(hdr.Name, zone); !ok {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if emptyRdata(rr) || isMetaType(hdr.Rrtype) {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype != dns.TypeSOA && !isUpdateType(hdr.Rrtype) {
+				return dns.RcodeRefused
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || !emptyRdata(rr) || (isMetaType(hdr.Rrtype) && hdr.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || isMetaType(hdr.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply applies update section to zone rrsets, soa and apex ns are managed by z42 and left untouched
+func (u *zoneUpdate) apply(updates []dns.RR) error {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		label, _ := zoneLabel(hdr.Name, u.zone.Name)
+		if hdr.Rrtype == dns.TypeSOA || (label == "@" && hdr.Rrtype == dns.TypeNS) {
+			continue
+		}
+		key := rrsetKey{label, hdr.Rrtype}
+		switch hdr.Class {
+		case dns.ClassINET:
+			conflict, err := u.cnameConflict(key)
+			if err != nil {
+				return err
+			}
+			if conflict {
+				continue
+			}
+			records, err := u.load(key)
+			if err != nil {
+				return err
+			}
+			var result []dns.RR
+			if key.rtype != dns.TypeCNAME {
+				for _, r := range records {
+					if !dns.IsDuplicate(r, rr) {
+						result = append(result, r)
+					}
+				}
+			}
+			result = append(result, dns.Copy(rr))
+			for _, r := range result {
+				r.Header().Ttl = hdr.Ttl
+			}
+			u.records[key] = result
+		case dns.ClassANY:
+			if hdr.Rrtype != dns.TypeANY {
+				if _, err := u.load(key); err != nil {
+					return err
+				}
+				u.records[key] = nil
+				continue
+			}
+			for _, t := range types.TransferTypes {
+				if label == "@" && t == dns.TypeNS {
+					continue
+				}
+				if _, err := u.load(rrsetKey{label, t}); err != nil {
+					return err
+				}
+				u.records[rrsetKey{label, t}] = nil
+			}
+		case dns.ClassNONE:
+			records, err := u.load(key)
+			if err != nil {
+				return err
+			}
+			var result []dns.RR
+			for _, r := range records {
+				if !isDuplicateRdata(r, rr) {
+					result = append(result, r)
+				}
+			}
+			u.records[key] = result
+		}
+	}
+	return nil
+}
+
+// cnameConflict reports whether adding an rrset of given type conflicts with cname rules
+func (u *zoneUpdate) cnameConflict(key rrsetKey) (bool, error) {
+	if key.rtype != dns.TypeCNAME {
+		records, err := u.load(rrsetKey{key.label, dns.TypeCNAME})
+		return len(records) > 0, err
+	}
+	if key.label == "@" {
+		return true, nil
+	}
+	for _, t := range types.TransferTypes {
+		if t == dns.TypeCNAME {
+			continue
+		}
+		records, err := u.load(rrsetKey{key.label, t})
+		if err != nil {
+			return false, err
+		}
+		if len(records) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// changes returns rrsets modified by update in a stable order
+func (u *zoneUpdate) changes() []rrsetKey {
+	var keys []rrsetKey
+	for key, records := range u.records {
+		original := u.original[key]
+		if sameRecords(original, records) && (len(records) == 0 || records[0].Header().Ttl == original[0].Header().Ttl) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].label != keys[j].label {
+			return keys[i].label < keys[j].label
+		}
+		return keys[i].rtype < keys[j].rtype
+	})
+	return keys
+}
+
+// rrset builds the new value of an rrset, ip filter, health check and failover settings are kept from current value
+func (u *zoneUpdate) rrset(key rrsetKey) (types.RRSet, error) {
+	rrset := types.TypeToRRSet(key.rtype)
+	for _, rr := range u.records[key] {
+		if err := rrset.Parse(rr); err != nil {
+			return nil, err
+		}
+	}
+	if ips, ok := rrset.(*types.IP_RRSet); ok {
+		if current, ok := u.current[key].(*types.IP_RRSet); ok {
+			ips.FilterConfig = current.FilterConfig
+			ips.HealthCheckConfig = current.HealthCheckConfig
+			ips.Failover = current.Failover
+			for i := range ips.Data {
+				for _, r := range current.Data {
+					if r.Ip.Equal(ips.Data[i].Ip) {
+						ips.Data[i] = r
+					}
+				}
+			}
+		}
+	}
+	return rrset, nil
+}
+
+func zoneLabel(name string, zone string) (string, bool) {
+	name = strings.ToLower(name)
+	if name == zone {
+		return "@", true
+	}
+	if !strings.HasSuffix(name, "."+zone) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."+zone), true
+}
+
+func ownerName(label string, zone string) string {
+	if label == "@" {
+		return zone
+	}
+	return label + "." + zone
+}
+
+func isUpdateType(t uint16) bool {
+	for _, transferType := range types.TransferTypes {
+		if t == transferType {
+			return true
+		}
+	}
+	return false
+}
+
+func isMetaType(t uint16) bool {
+	switch t {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	default:
+		return false
+	}
+}
+
+// emptyRdata reports whether rr has no rdata, unpacked messages use bare headers for them
+func emptyRdata(rr dns.RR) bool {
+	switch rr.(type) {
+	case *dns.ANY, *dns.RR_Header:
+		return true
+	default:
+		return false
+	}
+}
+
+// isDuplicateRdata compares records ignoring class and ttl
+func isDuplicateRdata(a dns.RR, b dns.RR) bool {
+	b = dns.Copy(b)
+	b.Header().Class = a.Header().Class
+	return dns.IsDuplicate(a, b)
+}
+
+func sameRecords(a []dns.RR, b []dns.RR) bool {
+	contains := func(records []dns.RR, rr dns.RR) bool {
+		for _, r := range records {
+			if isDuplicateRdata(r, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return true
+}
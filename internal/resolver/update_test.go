@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"z42-core/internal/types"
+)
+
+func newTestZoneUpdate() *zoneUpdate {
+	zone := types.NewZone("example.com.", []string{"@", "www", "alias"}, "")
+	data := map[rrsetKey]types.RRSet{
+		{"www", dns.TypeA}: &types.IP_RRSet{
+			GenericRRSet: types.GenericRRSet{TtlValue: 300},
+			FilterConfig: types.IpFilterConfig{Count: "single", Order: "weighted", GeoFilter: "none"},
+			Data:         []types.IP_RR{{Ip: []byte{1, 2, 3, 4}, Weight: 5}},
+		},
+		{"alias", dns.TypeCNAME}: &types.CNAME_RRSet{GenericRRSet: types.GenericRRSet{TtlValue: 300}, Host: "www.example.com."},
+	}
+	return newZoneUpdate(zone, func(zone string, label string, rtype uint16) (types.RRSet, error) {
+		if rrset, ok := data[rrsetKey{label, rtype}]; ok {
+			return rrset, nil
+		}
+		return types.TypeToRRSet(rtype), nil
+	})
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	RegisterTestingT(t)
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	a, _ := dns.NewRR("www.example.com. 0 IN A 1.2.3.4")
+	b, _ := dns.NewRR("www.example.com. 0 IN A 1.2.3.5")
+	tests := []struct {
+		prerequisites func(m *dns.Msg)
+		rcode         int
+	}{
+		{func(m *dns.Msg) { m.RRsetUsed([]dns.RR{a}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{a}) }, dns.RcodeYXRrset},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "new.example.com."}}}) }, dns.RcodeNameError},
+		{func(m *dns.Msg) { m.NameNotUsed([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.com."}}}) }, dns.RcodeYXDomain},
+		{func(m *dns.Msg) { m.Used([]dns.RR{a}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.Used([]dns.RR{a, b}) }, dns.RcodeNXRrset},
+		{func(m *dns.Msg) { m.Used([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.org."}}}) }, dns.RcodeNotZone},
+	}
+	for i, test := range tests {
+		m.Answer = nil
+		test.prerequisites(m)
+		rcode, err := newTestZoneUpdate().checkPrerequisites(m.Answer)
+		Expect(err).To(BeNil())
+		Expect(rcode).To(Equal(test.rcode), "test %d", i)
+	}
+}
+
+func TestUpdateApply(t *testing.T) {
+	RegisterTestingT(t)
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	a, _ := dns.NewRR("www.example.com. 600 IN A 1.2.3.5")
+	cname, _ := dns.NewRR("www.example.com. 600 IN CNAME foo.example.com.")
+	txt, _ := dns.NewRR("new.example.com. 300 IN TXT \"foo\"")
+	ns, _ := dns.NewRR("example.com. 300 IN NS ns3.example.com.")
+	m.Insert([]dns.RR{a, cname, txt, ns})
+	m.RemoveRRset([]dns.RR{&dns.CNAME{Hdr: dns.RR_Header{Name: "alias.example.com.", Rrtype: dns.TypeCNAME}}})
+	Expect(prescanUpdate("example.com.", m.Ns)).To(Equal(dns.RcodeSuccess))
+
+	u := newTestZoneUpdate()
+	Expect(u.apply(m.Ns)).To(BeNil())
+	Expect(u.changes()).To(Equal([]rrsetKey{
+		{"alias", dns.TypeCNAME},
+		{"new", dns.TypeTXT},
+		{"www", dns.TypeA},
+	}))
+
+	rrset, err := u.rrset(rrsetKey{"www", dns.TypeA})
+	Expect(err).To(BeNil())
+	ips := rrset.(*types.IP_RRSet)
+	Expect(ips.Ttl()).To(Equal(uint32(600)))
+	Expect(ips.FilterConfig.Count).To(Equal("single"))
+	Expect(ips.Data).To(HaveLen(2))
+	Expect(ips.Data[0].Weight).To(Equal(5))
+
+	rrset, err = u.rrset(rrsetKey{"alias", dns.TypeCNAME})
+	Expect(err).To(BeNil())
+	Expect(rrset.Empty()).To(BeTrue())
+
+	m.Ns = nil
+	m.Remove([]dns.RR{a})
+	u = newTestZoneUpdate()
+	Expect(prescanUpdate("example.com.", m.Ns)).To(Equal(dns.RcodeSuccess))
+	Expect(u.apply(m.Ns)).To(BeNil())
+	Expect(u.changes()).To(BeEmpty())
+
+	m.Ns = nil
+	m.Insert([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeANY, Class: dns.ClassINET}}})
+	Expect(prescanUpdate("example.com.", m.Ns)).To(Equal(dns.RcodeFormatError))
+}
@@ -112,3 +112,23 @@ func TestWeight(t *testing.T) {
 		Expect(n[i] <= 30000).To(BeTrue())
 	}
 }
+
+func TestOrderIpsTiers(t *testing.T) {
+	RegisterTestingT(t)
+	rrset := types.IP_RRSet{
+		GenericRRSet: types.GenericRRSet{TtlValue: 300},
+		FilterConfig: types.IpFilterConfig{Count: "multi", Order: "none"},
+		Data: []types.IP_RR{
+			{Ip: net.ParseIP("1.2.3.4"), Tier: 1},
+			{Ip: net.ParseIP("2.3.4.5")},
+			{Ip: net.ParseIP("3.4.5.6"), Tier: 2},
+			{Ip: net.ParseIP("4.5.6.7")},
+		},
+	}
+	Expect(orderIps(&rrset, make([]int, 4))).To(Equal([]net.IP{net.ParseIP("2.3.4.5"), net.ParseIP("4.5.6.7")}))
+	// backup tier is served once active ips are filtered out
+	mask := []int{types.IpMaskWhite, types.IpMaskBlack, types.IpMaskWhite, types.IpMaskBlack}
+	Expect(orderIps(&rrset, mask)).To(Equal([]net.IP{net.ParseIP("1.2.3.4")}))
+	mask = []int{types.IpMaskBlack, types.IpMaskBlack, types.IpMaskWhite, types.IpMaskBlack}
+	Expect(orderIps(&rrset, mask)).To(Equal([]net.IP{net.ParseIP("3.4.5.6")}))
+}
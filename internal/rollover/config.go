@@ -0,0 +1,42 @@
+package rollover
+
+import (
+	"errors"
+	"fmt"
+	"z42-core/configs"
+)
+
+// Config sets rollover timing, lifetimes and delays are in hours
+type Config struct {
+	Enable        bool `json:"enable"`
+	CheckInterval int  `json:"check_interval"`
+	ZSKLifetime   int  `json:"zsk_lifetime"`
+	KSKLifetime   int  `json:"ksk_lifetime"`
+	PublishDelay  int  `json:"publish_delay"`
+	RetireDelay   int  `json:"retire_delay"`
+	DSDelay       int  `json:"ds_delay"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enable:        false,
+		CheckInterval: 60,
+		ZSKLifetime:   720,
+		KSKLifetime:   8760,
+		PublishDelay:  24,
+		RetireDelay:   24,
+		DSDelay:       72,
+	}
+}
+
+// Verify checks delays even if scheduled rollovers are disabled since algorithm rollovers use them
+func (c Config) Verify() {
+	fmt.Println("checking key rollover...")
+	var err error
+	if c.PublishDelay*3600 < dnskeyTtl || c.RetireDelay*3600 < dnskeyTtl {
+		err = errors.New("publish and retire delays should be longer than dnskey ttl")
+	} else if c.Enable && (c.ZSKLifetime <= c.PublishDelay+c.RetireDelay || c.KSKLifetime <= c.DSDelay+c.RetireDelay) {
+		err = errors.New("key lifetime should be longer than rollover delays")
+	}
+	configs.PrintResult("checking rollover timings", err)
+}
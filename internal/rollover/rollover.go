@@ -0,0 +1,308 @@
+package rollover
+
+import (
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"z42-core/internal/dnssec"
+	"z42-core/internal/storage"
+	"z42-core/internal/types"
+	"z42-core/internal/upstream"
+)
+
+const dnskeyTtl = 14400
+
+// Rollover rotates keys of signed zones, zsks are pre-published and ksks use double-signature.
+// Enable turns on scheduled rollovers, key algorithm changes are rolled over regardless
+type Rollover struct {
+	Enable        bool
+	checkInterval time.Duration
+	zskLifetime   time.Duration
+	kskLifetime   time.Duration
+	publishDelay  time.Duration
+	retireDelay   time.Duration
+	dsDelay       time.Duration
+	redisData     *storage.DataHandler
+	upstream      *upstream.Upstream
+	generate      func(zone string, flags uint16, config *types.KeyAlgorithmConfig) (string, string, error)
+	dsPublished   func(zone string, key types.StoredZoneKey) bool
+	quit          chan struct{}
+	quitWG        sync.WaitGroup
+}
+
+func NewRollover(config *Config, redisData *storage.DataHandler, upstream *upstream.Upstream) *Rollover {
+	r := &Rollover{
+		Enable:        config.Enable,
+		checkInterval: time.Duration(config.CheckInterval) * time.Second,
+		zskLifetime:   time.Duration(config.ZSKLifetime) * time.Hour,
+		kskLifetime:   time.Duration(config.KSKLifetime) * time.Hour,
+		publishDelay:  time.Duration(config.PublishDelay) * time.Hour,
+		retireDelay:   time.Duration(config.RetireDelay) * time.Hour,
+		dsDelay:       time.Duration(config.DSDelay) * time.Hour,
+		redisData:     redisData,
+		upstream:      upstream,
+		generate:      dnssec.GenerateKey,
+		quit:          make(chan struct{}),
+	}
+	r.dsPublished = r.parentHasDS
+	return r
+}
+
+func (r *Rollover) Start() {
+	r.quitWG.Add(1)
+	go func() {
+		defer r.quitWG.Done()
+		ticker := time.NewTicker(r.checkInterval)
+		for {
+			select {
+			case <-r.quit:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				r.check()
+			}
+		}
+	}()
+}
+
+func (r *Rollover) ShutDown() {
+	close(r.quit)
+	r.quitWG.Wait()
+}
+
+func (r *Rollover) check() {
+	now := time.Now()
+	for _, zone := range r.redisData.GetZones() {
+		config, err := r.redisData.ReadZoneConfig(zone)
+		if err != nil || !config.DnsSec || config.CDSDelete {
+			continue
+		}
+		keys, err := r.redisData.ZoneKeys(zone)
+		if err != nil {
+			zap.L().Error("cannot load zone keys", zap.String("zone", zone), zap.Error(err))
+			continue
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		keys, changed, err := r.roll(zone, keys, config.KeyAlgorithm, now)
+		if err != nil {
+			zap.L().Error("key rollover failed", zap.String("zone", zone), zap.Error(err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := r.redisData.SetZoneKeys(zone, keys); err != nil {
+			zap.L().Error("cannot store zone keys", zap.String("zone", zone), zap.Error(err))
+		}
+	}
+}
+
+// roll advances key states of a zone at time now and reports whether key set has changed
+func (r *Rollover) roll(zone string, keys []types.StoredZoneKey, algorithmConfig *types.KeyAlgorithmConfig, now time.Time) ([]types.StoredZoneKey, bool, error) {
+	algorithm, _, err := dnssec.KeyAlgorithm(algorithmConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	keys = append([]types.StoredZoneKey{}, keys...)
+	changed := false
+	elapsed := func(key types.StoredZoneKey, d time.Duration) bool {
+		return !now.Before(time.Unix(key.Since, 0).Add(d))
+	}
+	setState := func(key *types.StoredZoneKey, state string) {
+		key.State = state
+		key.Since = now.Unix()
+		changed = true
+	}
+	addKey := func(keyType string, state string) error {
+		key, err := r.newKey(zone, keyType, state, algorithmConfig, now)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		changed = true
+		if keyType == "ksk" {
+			if rr, err := dns.NewRR(key.Public); err == nil && rr != nil {
+				if ds := rr.(*dns.DNSKEY).ToDS(dns.SHA256); ds != nil {
+					zap.L().Info("ksk introduced, update ds at parent", zap.String("zone", zone), zap.String("ds", ds.String()))
+				}
+			}
+		}
+		return nil
+	}
+
+	// keys imported from single zsk/ksk pair start their lifetime now
+	for i := range keys {
+		if keys[i].Since == 0 {
+			keys[i].Since = now.Unix()
+			changed = true
+		}
+		if keys[i].Algorithm == 0 {
+			if rr, err := dns.NewRR(keys[i].Public); err == nil && rr != nil {
+				keys[i].Algorithm = rr.(*dns.DNSKEY).Algorithm
+				changed = true
+			}
+		}
+	}
+
+	// algorithm rollover (rfc6781 section 4.1.4): keys of new algorithm sign zone before they are published so
+	// every algorithm in key set has signatures in caches (rfc4035 section 2.2), then they are published and parent
+	// ds is replaced. old keys leave key set before their signatures are dropped
+	if active := newest(keys, "ksk", types.KeyStateActive, algorithm); active == -1 {
+		if signing := newest(keys, "ksk", types.KeyStateSigning, algorithm); signing == -1 {
+			if err := addKey("zsk", types.KeyStateSigning); err != nil {
+				return nil, false, err
+			}
+			if err := addKey("ksk", types.KeyStateSigning); err != nil {
+				return nil, false, err
+			}
+			zap.L().Info("algorithm rollover started", zap.String("zone", zone), zap.Uint8("algorithm", algorithm))
+		} else if elapsed(keys[signing], r.publishDelay) {
+			for i := range keys {
+				if keys[i].Algorithm == algorithm && keys[i].State == types.KeyStateSigning {
+					setState(&keys[i], types.KeyStateActive)
+				}
+			}
+			zap.L().Info("keys of new algorithm published", zap.String("zone", zone))
+		}
+	} else if hasOldKeys(keys, algorithm) && elapsed(keys[active], r.dsDelay) && r.dsPublished(zone, keys[active]) {
+		res := keys[:0]
+		for _, key := range keys {
+			if key.Algorithm != algorithm {
+				if key.State != types.KeyStateActive && key.State != types.KeyStateSigning {
+					// not signing, nothing to keep in caches
+					changed = true
+					continue
+				}
+				if key.State == types.KeyStateActive {
+					setState(&key, types.KeyStateSigning)
+					zap.L().Info("key of previous algorithm unpublished", zap.String("zone", zone))
+				}
+			}
+			res = append(res, key)
+		}
+		keys = res
+	}
+
+	// zsk pre-publish: new key is published ahead of use, old key stays published until signatures expire from caches
+	active := newest(keys, "zsk", types.KeyStateActive, algorithm)
+	published := newest(keys, "zsk", types.KeyStatePublished, algorithm)
+	if published != -1 && elapsed(keys[published], r.publishDelay) {
+		for i := range keys {
+			if keys[i].Type == "zsk" && keys[i].State == types.KeyStateActive && keys[i].Algorithm == algorithm {
+				setState(&keys[i], types.KeyStateRetired)
+			}
+		}
+		setState(&keys[published], types.KeyStateActive)
+		zap.L().Info("zsk activated", zap.String("zone", zone))
+	} else if r.Enable && published == -1 && active != -1 && elapsed(keys[active], r.zskLifetime) {
+		if err := addKey("zsk", types.KeyStatePublished); err != nil {
+			return nil, false, err
+		}
+		zap.L().Info("zsk published", zap.String("zone", zone))
+	}
+
+	// ksk double-signature: new key signs key set along with old one until parent ds is replaced,
+	// ds delay is the least time given to registrar but old key stays until parent serves ds of new one
+	active = newest(keys, "ksk", types.KeyStateActive, algorithm)
+	if active != -1 && count(keys, "ksk", types.KeyStateActive, algorithm) > 1 && elapsed(keys[active], r.dsDelay) &&
+		r.dsPublished(zone, keys[active]) {
+		for i := range keys {
+			if i != active && keys[i].Type == "ksk" && keys[i].State == types.KeyStateActive && keys[i].Algorithm == algorithm {
+				setState(&keys[i], types.KeyStateRetired)
+				zap.L().Info("ksk retired", zap.String("zone", zone))
+			}
+		}
+	}
+	if r.Enable && active != -1 && count(keys, "ksk", types.KeyStateActive, algorithm) == 1 && elapsed(keys[active], r.kskLifetime) {
+		if err := addKey("ksk", types.KeyStateActive); err != nil {
+			return nil, false, err
+		}
+	}
+
+	res := keys[:0]
+	for _, key := range keys {
+		// old algorithm keys are removed once their signatures expire from caches
+		if (key.State == types.KeyStateRetired || (key.State == types.KeyStateSigning && key.Algorithm != algorithm)) &&
+			elapsed(key, r.retireDelay) {
+			changed = true
+			continue
+		}
+		res = append(res, key)
+	}
+	return res, changed, nil
+}
+
+// parentHasDS queries ds of zone through upstream and reports whether parent has published ds of key
+func (r *Rollover) parentHasDS(zone string, key types.StoredZoneKey) bool {
+	rr, err := dns.NewRR(key.Public)
+	if err != nil || rr == nil {
+		return false
+	}
+	dnskey, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return false
+	}
+	ds, rcode := r.upstream.Query(zone, dns.TypeDS)
+	if rcode != dns.RcodeSuccess {
+		return false
+	}
+	published := dnssec.HasDS(ds, dnskey)
+	if !published {
+		zap.L().Info("waiting for parent ds", zap.String("zone", zone), zap.Uint16("keytag", dnskey.KeyTag()))
+	}
+	return published
+}
+
+func (r *Rollover) newKey(zone string, keyType string, state string, algorithmConfig *types.KeyAlgorithmConfig, now time.Time) (types.StoredZoneKey, error) {
+	flags := dnssec.ZSKFlags
+	if keyType == "ksk" {
+		flags = dnssec.KSKFlags
+	}
+	pub, priv, err := r.generate(zone, flags, algorithmConfig)
+	if err != nil {
+		return types.StoredZoneKey{}, err
+	}
+	algorithm, _, _ := dnssec.KeyAlgorithm(algorithmConfig)
+	return types.StoredZoneKey{
+		Type:      keyType,
+		Public:    pub,
+		Private:   priv,
+		State:     state,
+		Since:     now.Unix(),
+		Algorithm: algorithm,
+	}, nil
+}
+
+// newest returns index of the most recent key with given type, state and algorithm or -1
+func newest(keys []types.StoredZoneKey, keyType string, state string, algorithm uint8) int {
+	res := -1
+	for i, key := range keys {
+		if key.Type == keyType && key.State == state && key.Algorithm == algorithm && (res == -1 || key.Since >= keys[res].Since) {
+			res = i
+		}
+	}
+	return res
+}
+
+// hasOldKeys reports whether key set has published keys of an algorithm other than algorithm
+func hasOldKeys(keys []types.StoredZoneKey, algorithm uint8) bool {
+	for _, key := range keys {
+		if key.Algorithm != algorithm && types.KeyPublished(key.State) {
+			return true
+		}
+	}
+	return false
+}
+
+func count(keys []types.StoredZoneKey, keyType string, state string, algorithm uint8) int {
+	n := 0
+	for _, key := range keys {
+		if key.Type == keyType && key.State == state && key.Algorithm == algorithm {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,149 @@
+package rollover
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"strconv"
+	"testing"
+	"time"
+	"z42-core/internal/types"
+)
+
+// newTestRollover returns a rollover with fake keys, parent has ds of keys in published
+func newTestRollover(published map[string]bool) *Rollover {
+	config := DefaultConfig()
+	config.Enable = true
+	r := NewRollover(&config, nil, nil)
+	n := 0
+	r.generate = func(zone string, flags uint16, config *types.KeyAlgorithmConfig) (string, string, error) {
+		n++
+		return "key" + strconv.Itoa(n), "priv" + strconv.Itoa(n), nil
+	}
+	r.dsPublished = func(zone string, key types.StoredZoneKey) bool {
+		return published[key.Public]
+	}
+	return r
+}
+
+func states(keys []types.StoredZoneKey) []string {
+	var res []string
+	for _, key := range keys {
+		res = append(res, key.Type+":"+key.Public+":"+key.State)
+	}
+	return res
+}
+
+func TestZSKRollover(t *testing.T) {
+	RegisterTestingT(t)
+	r := newTestRollover(nil)
+	now := time.Unix(1000000, 0)
+	keys := []types.StoredZoneKey{
+		{Type: "zsk", Public: "zsk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256},
+		{Type: "ksk", Public: "ksk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256},
+	}
+	keys, changed, err := r.roll("example.com.", keys, nil, now)
+	Expect(err).To(BeNil())
+	Expect(changed).To(BeTrue())
+	Expect(keys[0].Since).To(Equal(now.Unix()))
+
+	keys, changed, _ = r.roll("example.com.", keys, nil, now.Add(time.Hour))
+	Expect(changed).To(BeFalse())
+
+	now = now.Add(r.zskLifetime)
+	keys, _, _ = r.roll("example.com.", keys, nil, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:active", "zsk:key1:published"}))
+
+	now = now.Add(r.publishDelay)
+	keys, _, _ = r.roll("example.com.", keys, nil, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:retired", "ksk:ksk0:active", "zsk:key1:active"}))
+
+	now = now.Add(r.retireDelay)
+	keys, _, _ = r.roll("example.com.", keys, nil, now)
+	Expect(states(keys)).To(Equal([]string{"ksk:ksk0:active", "zsk:key1:active"}))
+}
+
+func TestKSKRollover(t *testing.T) {
+	RegisterTestingT(t)
+	published := make(map[string]bool)
+	r := newTestRollover(published)
+	now := time.Unix(1000000, 0)
+	keys := []types.StoredZoneKey{
+		{Type: "zsk", Public: "zsk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256, Since: now.Unix()},
+		{Type: "ksk", Public: "ksk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256, Since: now.Add(-r.kskLifetime).Unix()},
+	}
+	keys, changed, err := r.roll("example.com.", keys, nil, now)
+	Expect(err).To(BeNil())
+	Expect(changed).To(BeTrue())
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:active", "ksk:key1:active"}))
+
+	keys, changed, _ = r.roll("example.com.", keys, nil, now.Add(r.dsDelay-time.Second))
+	Expect(changed).To(BeFalse())
+
+	// registrar is late, both keys keep signing
+	now = now.Add(r.dsDelay)
+	keys, changed, _ = r.roll("example.com.", keys, nil, now)
+	Expect(changed).To(BeFalse())
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:active", "ksk:key1:active"}))
+
+	published["key1"] = true
+	now = now.Add(time.Hour)
+	keys, _, _ = r.roll("example.com.", keys, nil, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:retired", "ksk:key1:active"}))
+
+	now = now.Add(r.retireDelay)
+	keys, _, _ = r.roll("example.com.", keys, nil, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:key1:active"}))
+}
+
+func TestAlgorithmRollover(t *testing.T) {
+	RegisterTestingT(t)
+	published := make(map[string]bool)
+	r := newTestRollover(published)
+	// algorithm changes are applied even if scheduled rollovers are disabled
+	r.Enable = false
+	now := time.Unix(1000000, 0)
+	keys := []types.StoredZoneKey{
+		{Type: "zsk", Public: "zsk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256, Since: now.Unix()},
+		{Type: "ksk", Public: "ksk0", State: types.KeyStateActive, Algorithm: dns.ECDSAP256SHA256, Since: now.Unix()},
+	}
+	algorithm := &types.KeyAlgorithmConfig{Algorithm: "ED25519"}
+
+	// new keys sign before they are published
+	keys, changed, err := r.roll("example.com.", keys, algorithm, now)
+	Expect(err).To(BeNil())
+	Expect(changed).To(BeTrue())
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:active", "zsk:key1:signing", "ksk:key2:signing"}))
+	Expect(keys[2].Algorithm).To(Equal(dns.ED25519))
+
+	keys, changed, _ = r.roll("example.com.", keys, algorithm, now.Add(r.publishDelay-time.Second))
+	Expect(changed).To(BeFalse())
+
+	now = now.Add(r.publishDelay)
+	keys, _, _ = r.roll("example.com.", keys, algorithm, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:active", "ksk:ksk0:active", "zsk:key1:active", "ksk:key2:active"}))
+
+	// old keys stay until parent has ds of new ksk
+	now = now.Add(r.dsDelay)
+	keys, changed, _ = r.roll("example.com.", keys, algorithm, now)
+	Expect(changed).To(BeFalse())
+
+	// old keys are unpublished before their signatures are dropped
+	published["key2"] = true
+	now = now.Add(time.Hour)
+	keys, _, _ = r.roll("example.com.", keys, algorithm, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:zsk0:signing", "ksk:ksk0:signing", "zsk:key1:active", "ksk:key2:active"}))
+
+	keys, changed, _ = r.roll("example.com.", keys, algorithm, now.Add(r.retireDelay-time.Second))
+	Expect(changed).To(BeFalse())
+
+	now = now.Add(r.retireDelay)
+	keys, _, _ = r.roll("example.com.", keys, algorithm, now)
+	Expect(states(keys)).To(Equal([]string{"zsk:key1:active", "ksk:key2:active"}))
+
+	// no scheduled rollovers while disabled
+	keys, changed, _ = r.roll("example.com.", keys, algorithm, now.Add(r.kskLifetime))
+	Expect(changed).To(BeFalse())
+
+	_, _, err = r.roll("example.com.", keys, &types.KeyAlgorithmConfig{Algorithm: "RSASHA256", Bits: 512}, now)
+	Expect(err).NotTo(BeNil())
+}
@@ -0,0 +1,18 @@
+package secondary
+
+type Config struct {
+	Enable        bool `json:"enable"`
+	Timeout       int  `json:"timeout"`
+	CheckInterval int  `json:"check_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enable:        false,
+		Timeout:       5000,
+		CheckInterval: 1,
+	}
+}
+
+func (_ Config) Verify() {
+}
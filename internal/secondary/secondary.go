@@ -0,0 +1,393 @@
+package secondary
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"z42-core/internal/storage"
+	"z42-core/internal/types"
+)
+
+const defaultRetry = 60 * time.Second
+
+type rrsetKey struct {
+	label string
+	rtype uint16
+}
+
+type zoneState struct {
+	name        string
+	primaries   []string
+	soa         *dns.SOA
+	records     map[rrsetKey][]dns.RR
+	nextRefresh time.Time
+	expire      time.Time
+	expired     bool
+}
+
+// Secondary keeps zones with configured primaries in sync using AXFR/IXFR
+type Secondary struct {
+	Enable        bool
+	timeout       time.Duration
+	checkInterval time.Duration
+	redisData     *storage.DataHandler
+	zones         map[string]*zoneState
+	quit          chan struct{}
+	quitWG        sync.WaitGroup
+}
+
+func NewSecondary(config *Config, redisData *storage.DataHandler) *Secondary {
+	s := &Secondary{
+		Enable:        config.Enable,
+		timeout:       time.Duration(config.Timeout) * time.Millisecond,
+		checkInterval: time.Duration(config.CheckInterval) * time.Second,
+		redisData:     redisData,
+		zones:         make(map[string]*zoneState),
+		quit:          make(chan struct{}),
+	}
+	return s
+}
+
+func (s *Secondary) Start() {
+	if !s.Enable {
+		return
+	}
+	s.quitWG.Add(1)
+	go func() {
+		defer s.quitWG.Done()
+		ticker := time.NewTicker(s.checkInterval)
+		for {
+			select {
+			case <-s.quit:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				s.check()
+			}
+		}
+	}()
+}
+
+func (s *Secondary) ShutDown() {
+	if !s.Enable {
+		return
+	}
+	close(s.quit)
+	s.quitWG.Wait()
+}
+
+func (s *Secondary) check() {
+	s.loadZones()
+	notifies, err := s.redisData.TakeNotifies()
+	if err != nil {
+		zap.L().Error("cannot load notifies", zap.Error(err))
+	}
+	for _, zone := range notifies {
+		if z, ok := s.zones[zone]; ok {
+			zap.L().Info("notify received", zap.String("zone", zone))
+			z.nextRefresh = time.Time{}
+		}
+	}
+	now := time.Now()
+	for _, z := range s.zones {
+		if now.Before(z.nextRefresh) {
+			continue
+		}
+		s.refresh(z)
+	}
+}
+
+func (s *Secondary) loadZones() {
+	current := make(map[string]bool)
+	for _, zone := range s.redisData.GetZones() {
+		current[zone] = true
+	}
+	for zone, z := range s.zones {
+		// expired zones are disabled so they are not in zone list anymore
+		if z.expired {
+			current[zone] = true
+		}
+	}
+	for zone := range current {
+		config, err := s.redisData.GetZoneConfig(zone)
+		if err != nil || len(config.Primaries) == 0 {
+			delete(current, zone)
+			continue
+		}
+		z, ok := s.zones[zone]
+		if !ok {
+			z = &zoneState{name: zone}
+			s.zones[zone] = z
+		}
+		z.primaries = config.Primaries
+	}
+	for zone := range s.zones {
+		if !current[zone] {
+			delete(s.zones, zone)
+		}
+	}
+}
+
+func (s *Secondary) refresh(z *zoneState) {
+	serial, primary, err := s.querySerial(z)
+	if err == nil {
+		if z.soa != nil && !types.SerialLess(z.soa.Serial, serial) {
+			s.refreshed(z)
+			return
+		}
+		err = s.transfer(z, primary)
+	}
+	if err != nil {
+		zap.L().Error("zone refresh failed", zap.String("zone", z.name), zap.Error(err))
+		// in-memory copy may be partially updated, next transfer will be a full one
+		z.records = nil
+		retry := defaultRetry
+		if z.soa != nil {
+			retry = time.Duration(z.soa.Retry) * time.Second
+		}
+		z.nextRefresh = time.Now().Add(retry)
+		if z.soa != nil && !z.expired && time.Now().After(z.expire) {
+			zap.L().Error("zone expired", zap.String("zone", z.name))
+			if err := s.redisData.DisableZone(z.name); err != nil {
+				zap.L().Error("cannot disable zone", zap.String("zone", z.name), zap.Error(err))
+			}
+			z.expired = true
+		}
+		return
+	}
+	s.refreshed(z)
+}
+
+func (s *Secondary) refreshed(z *zoneState) {
+	now := time.Now()
+	z.nextRefresh = now.Add(time.Duration(z.soa.Refresh) * time.Second)
+	z.expire = now.Add(time.Duration(z.soa.Expire) * time.Second)
+	if z.expired {
+		if err := s.redisData.EnableZone(z.name); err != nil {
+			zap.L().Error("cannot enable zone", zap.String("zone", z.name), zap.Error(err))
+			return
+		}
+		z.expired = false
+	}
+}
+
+func primaryAddress(primary string) string {
+	if _, _, err := net.SplitHostPort(primary); err == nil {
+		return primary
+	}
+	return net.JoinHostPort(primary, "53")
+}
+
+// querySerial returns current serial of zone from the first primary that answers
+func (s *Secondary) querySerial(z *zoneState) (uint32, string, error) {
+	client := &dns.Client{
+		Net:     "udp",
+		Timeout: s.timeout,
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(z.name, dns.TypeSOA)
+	err := errors.New("no primary available")
+	for _, primary := range z.primaries {
+		address := primaryAddress(primary)
+		var resp *dns.Msg
+		resp, _, err = client.Exchange(m, address)
+		if err != nil {
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			err = errors.New("primary returned " + dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Serial, address, nil
+			}
+		}
+		err = errors.New("no soa in response")
+	}
+	return 0, "", err
+}
+
+func (s *Secondary) transfer(z *zoneState, primary string) error {
+	m := new(dns.Msg)
+	incremental := z.soa != nil && z.records != nil
+	if incremental {
+		m.SetIxfr(z.name, z.soa.Serial, z.soa.Ns, z.soa.Mbox)
+	} else {
+		m.SetAxfr(z.name)
+	}
+	t := &dns.Transfer{
+		DialTimeout:  s.timeout,
+		ReadTimeout:  s.timeout,
+		WriteTimeout: s.timeout,
+	}
+	env, err := t.In(m, primary)
+	if err != nil {
+		return err
+	}
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			err = e.Error
+			continue
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	if err != nil {
+		return err
+	}
+	if len(rrs) == 0 {
+		return errors.New("empty transfer")
+	}
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return errors.New("transfer does not start with soa")
+	}
+	if len(rrs) == 1 {
+		// ixfr response with a single soa, we are up to date
+		z.soa = soa
+		return nil
+	}
+	if incremental {
+		if oldSoa, ok := rrs[1].(*dns.SOA); ok && oldSoa.Serial == z.soa.Serial {
+			return s.applyIncremental(z, soa, rrs[1:len(rrs)-1])
+		}
+	}
+	return s.applyFull(z, soa, rrs[1:len(rrs)-1])
+}
+
+func (s *Secondary) applyFull(z *zoneState, soa *dns.SOA, rrs []dns.RR) error {
+	records := make(map[rrsetKey][]dns.RR)
+	for _, rr := range rrs {
+		key, ok := recordKey(z.name, rr)
+		if !ok {
+			continue
+		}
+		records[key] = append(records[key], rr)
+	}
+	entries := make(map[string]map[string]types.RRSet)
+	entries["@"] = make(map[string]types.RRSet)
+	for key, rrs := range records {
+		rrset, err := toRRSet(key.rtype, rrs)
+		if err != nil {
+			return err
+		}
+		if _, ok := entries[key.label]; !ok {
+			entries[key.label] = make(map[string]types.RRSet)
+		}
+		entries[key.label][types.TypeToString(key.rtype)] = rrset
+	}
+	soaRRSet := &types.SOA_RRSet{}
+	if err := soaRRSet.Parse(soa); err != nil {
+		return err
+	}
+	if err := s.redisData.ReplaceZoneData(z.name, soaRRSet, entries); err != nil {
+		return err
+	}
+	zap.L().Info("zone transferred", zap.String("zone", z.name), zap.Uint32("serial", soa.Serial), zap.Int("records", len(rrs)))
+	z.soa = soa
+	z.records = records
+	return nil
+}
+
+// applyIncremental applies IXFR (old soa, deleted records, new soa, added records) blocks to zone
+func (s *Secondary) applyIncremental(z *zoneState, soa *dns.SOA, rrs []dns.RR) error {
+	changed := make(map[rrsetKey]bool)
+	deleting := false
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.SOA); ok {
+			deleting = !deleting
+			continue
+		}
+		key, ok := recordKey(z.name, rr)
+		if !ok {
+			continue
+		}
+		current := z.records[key]
+		for i := range current {
+			if dns.IsDuplicate(current[i], rr) {
+				current = append(current[:i], current[i+1:]...)
+				break
+			}
+		}
+		if !deleting {
+			current = append(current, rr)
+		}
+		if len(current) == 0 {
+			delete(z.records, key)
+		} else {
+			z.records[key] = current
+		}
+		changed[key] = true
+	}
+	entries := make(map[string]map[string]types.RRSet)
+	for key := range changed {
+		var rrset types.RRSet
+		if rrs, ok := z.records[key]; ok {
+			var err error
+			if rrset, err = toRRSet(key.rtype, rrs); err != nil {
+				return err
+			}
+		}
+		if _, ok := entries[key.label]; !ok {
+			entries[key.label] = make(map[string]types.RRSet)
+		}
+		entries[key.label][types.TypeToString(key.rtype)] = rrset
+	}
+	labelSet := map[string]bool{"@": true}
+	for key := range z.records {
+		labelSet[key.label] = true
+	}
+	labels := make([]string, 0, len(labelSet))
+	for label := range labelSet {
+		labels = append(labels, label)
+	}
+	soaRRSet := &types.SOA_RRSet{}
+	if err := soaRRSet.Parse(soa); err != nil {
+		return err
+	}
+	if err := s.redisData.UpdateZoneData(z.name, soaRRSet, entries, labels); err != nil {
+		return err
+	}
+	zap.L().Info("zone updated", zap.String("zone", z.name), zap.Uint32("serial", soa.Serial), zap.Int("changes", len(changed)))
+	z.soa = soa
+	return nil
+}
+
+func recordKey(zone string, rr dns.RR) (rrsetKey, bool) {
+	rtype := rr.Header().Rrtype
+	if !isTransferType(rtype) {
+		return rrsetKey{}, false
+	}
+	name := strings.ToLower(rr.Header().Name)
+	if name == zone {
+		return rrsetKey{label: "@", rtype: rtype}, true
+	}
+	if !strings.HasSuffix(name, "."+zone) {
+		return rrsetKey{}, false
+	}
+	return rrsetKey{label: strings.TrimSuffix(name, "."+zone), rtype: rtype}, true
+}
+
+func isTransferType(rtype uint16) bool {
+	for _, t := range types.TransferTypes {
+		if t == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+func toRRSet(rtype uint16, rrs []dns.RR) (types.RRSet, error) {
+	rrset := types.TypeToRRSet(rtype)
+	for _, rr := range rrs {
+		if err := rrset.Parse(rr); err != nil {
+			return nil, err
+		}
+	}
+	return rrset, nil
+}
@@ -0,0 +1,52 @@
+package secondary
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+	"z42-core/internal/types"
+)
+
+func TestRecordKey(t *testing.T) {
+	RegisterTestingT(t)
+	rr, _ := dns.NewRR("example.com. 300 IN NS ns1.example.com.")
+	key, ok := recordKey("example.com.", rr)
+	Expect(ok).To(BeTrue())
+	Expect(key).To(Equal(rrsetKey{label: "@", rtype: dns.TypeNS}))
+
+	rr, _ = dns.NewRR("WWW.a.Example.com. 300 IN A 1.2.3.4")
+	key, ok = recordKey("example.com.", rr)
+	Expect(ok).To(BeTrue())
+	Expect(key).To(Equal(rrsetKey{label: "www.a", rtype: dns.TypeA}))
+
+	rr, _ = dns.NewRR("www.example.net. 300 IN A 1.2.3.4")
+	_, ok = recordKey("example.com.", rr)
+	Expect(ok).To(BeFalse())
+
+	rr, _ = dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 2 3 4 5")
+	_, ok = recordKey("example.com.", rr)
+	Expect(ok).To(BeFalse())
+
+	rr, _ = dns.NewRR("example.com. 300 IN HINFO cpu os")
+	key, ok = recordKey("example.com.", rr)
+	Expect(ok).To(BeTrue())
+	Expect(key).To(Equal(rrsetKey{label: "@", rtype: dns.TypeHINFO}))
+
+	rr, _ = dns.NewRR("example.com. 300 IN AFSDB 1 afs.example.com.")
+	_, ok = recordKey("example.com.", rr)
+	Expect(ok).To(BeFalse())
+}
+
+func TestToRRSet(t *testing.T) {
+	RegisterTestingT(t)
+	rr1, _ := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	rr2, _ := dns.NewRR("www.example.com. 300 IN A 5.6.7.8")
+	rrset, err := toRRSet(dns.TypeA, []dns.RR{rr1, rr2})
+	Expect(err).To(BeNil())
+	Expect(rrset.(*types.IP_RRSet).Data).To(HaveLen(2))
+	Expect(rrset.Value("www.example.com.")).To(HaveLen(2))
+	Expect(rrset.Ttl()).To(Equal(uint32(300)))
+
+	_, err = toRRSet(dns.TypeCNAME, []dns.RR{rr1})
+	Expect(err).NotTo(BeNil())
+}
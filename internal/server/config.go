@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"z42-core/configs"
 	"net"
@@ -14,12 +15,27 @@ type TlsConfig struct {
 	CaPath   string `json:"ca_path"`
 }
 
+// QuicConfig limits resources of a dns over quic listener, idle timeout is in seconds
+type QuicConfig struct {
+	MaxConnections int `json:"max_connections"`
+	MaxStreams     int `json:"max_streams"`
+	IdleTimeout    int `json:"idle_timeout"`
+}
+
+// ProxyProtocolConfig accepts PROXY v1/v2 headers on tcp and v2 on udp from trusted sources (ip or cidr)
+type ProxyProtocolConfig struct {
+	Enable         bool     `json:"enable"`
+	TrustedSources []string `json:"trusted_sources"`
+}
+
 type Config struct {
-	Ip       string    `json:"ip"`
-	Port     int       `json:"port"`
-	Protocol string    `json:"protocol"`
-	Count    int       `json:"count"`
-	Tls      TlsConfig `json:"tls"`
+	Ip            string              `json:"ip"`
+	Port          int                 `json:"port"`
+	Protocol      string              `json:"protocol"`
+	Count         int                 `json:"count"`
+	Tls           TlsConfig           `json:"tls"`
+	Quic          QuicConfig          `json:"quic"`
+	ProxyProtocol ProxyProtocolConfig `json:"proxy_protocol"`
 }
 
 func DefaultConfig() Config {
@@ -34,11 +50,49 @@ func DefaultConfig() Config {
 			KeyPath:  "",
 			CaPath:   "",
 		},
+		Quic: QuicConfig{
+			MaxConnections: 1000,
+			MaxStreams:     100,
+			IdleTimeout:    30,
+		},
+	}
+}
+
+// network returns transport protocol listener binds to
+func (c Config) network() string {
+	switch c.Protocol {
+	case "tcp-tls", "https":
+		return "tcp"
+	case "doq":
+		return "udp"
+	default:
+		return c.Protocol
 	}
 }
 
 func (c Config) Verify() {
-	configs.CheckAddress(c.Protocol, c.Ip, c.Port)
+	configs.CheckAddress(c.network(), c.Ip, c.Port)
+	if c.Protocol == "https" && !c.Tls.Enable {
+		configs.PrintWarning("checking https listener", "tls is disabled, serving dns over plain http")
+	}
+	if c.ProxyProtocol.Enable {
+		var err error
+		if c.Protocol == "https" || c.Protocol == "doq" {
+			err = errors.New("proxy protocol is only supported on udp and tcp listeners")
+		} else if len(newTrustedSources(c.ProxyProtocol.TrustedSources)) != len(c.ProxyProtocol.TrustedSources) {
+			err = errors.New("invalid trusted source")
+		} else if c.Count > 1 {
+			configs.PrintWarning("checking proxy protocol", "count is ignored, a single listener is used")
+		}
+		configs.PrintResult("checking proxy protocol", err)
+	}
+	if c.Protocol == "doq" {
+		var err error
+		if !c.Tls.Enable || c.Tls.CertPath == "" || c.Tls.KeyPath == "" {
+			err = errors.New("dns over quic requires tls certificate")
+		}
+		configs.PrintResult("checking doq listener", err)
+	}
 	msg := fmt.Sprintf("checking port number : %d", c.Port)
 	if c.Port != 53 {
 		configs.PrintWarning(msg, "using non-standard port")
@@ -49,15 +103,15 @@ func (c Config) Verify() {
 	address := c.Ip + ":" + strconv.Itoa(c.Port)
 	msg = fmt.Sprintf("checking whether %s://%s is available", c.Protocol, address)
 	var err error
-	if c.Protocol == "udp" {
+	if c.network() == "udp" {
 		var con net.PacketConn
-		con, err = net.ListenPacket(c.Protocol, address)
+		con, err = net.ListenPacket(c.network(), address)
 		if err == nil {
 			_ = con.Close()
 		}
 	} else {
 		var ln net.Listener
-		ln, err = net.Listen(c.Protocol, address)
+		ln, err = net.Listen(c.network(), address)
 		if err == nil {
 			_ = ln.Close()
 		}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohPath        = "/dns-query"
+	dohContentType = "application/dns-message"
+	dohMaxSize     = dns.MaxMsgSize
+)
+
+// HttpsServer serves dns over https (rfc8484) and hands requests to the same dns.Handler as dns.Server
+type HttpsServer struct {
+	Addr         string
+	Handler      dns.Handler
+	TsigProvider dns.TsigProvider
+	server       *http.Server
+}
+
+func NewHttpsServer(cfg Config) *HttpsServer {
+	s := &HttpsServer{
+		Addr: cfg.Ip + ":" + strconv.Itoa(cfg.Port),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohPath, s.ServeHTTP)
+	s.server = &http.Server{
+		Addr:              s.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	if cfg.Tls.Enable {
+		s.server.TLSConfig = loadTlsConfig(cfg.Tls)
+	}
+	return s
+}
+
+func (s *HttpsServer) ListenAndServe() error {
+	if s.server.TLSConfig != nil {
+		// certificates are already loaded into TLSConfig
+		return s.server.ListenAndServeTLS("", "")
+	}
+	return s.server.ListenAndServe()
+}
+
+func (s *HttpsServer) Shutdown() error {
+	return s.server.Shutdown(context.Background())
+}
+
+func (s *HttpsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf []byte
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = io.ReadAll(io.LimitReader(r.Body, dohMaxSize+1))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(buf) == 0 || len(buf) > dohMaxSize {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	var local net.Addr
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		local = addr
+	}
+	var remote net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	writer := newMessageWriter("https", local, remote, s.TsigProvider, req, buf)
+	writer.write = func(m *dns.Msg, data []byte) error {
+		w.Header().Set("Content-Type", dohContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(minTtl(m))))
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write(data)
+		return err
+	}
+	if isTransfer(req) {
+		// zone transfers do not fit in a single http response
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNotImplemented)
+		_ = writer.WriteMsg(m)
+		return
+	}
+	handler := s.Handler
+	if handler == nil {
+		handler = dns.DefaultServeMux
+	}
+	handler.ServeDNS(writer, req)
+	if !writer.written {
+		http.Error(w, "no response", http.StatusInternalServerError)
+	}
+}
+
+// minTtl returns freshness lifetime of a response as described in rfc8484 section 5.1
+func minTtl(m *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT || rr.Header().Rrtype == dns.TypeTSIG {
+				continue
+			}
+			if first || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				first = false
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func newTestHttpsServer() *HttpsServer {
+	s := NewHttpsServer(Config{Ip: "127.0.0.1", Port: 8443, Protocol: "https"})
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		a, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 1.2.3.4")
+		ns, _ := dns.NewRR(r.Question[0].Name + " 60 IN NS ns1.example.com.")
+		m.Answer = []dns.RR{a}
+		m.Ns = []dns.RR{ns}
+		_ = w.WriteMsg(m)
+	})
+	return s
+}
+
+func checkDohResponse(rec *httptest.ResponseRecorder) {
+	Expect(rec.Code).To(Equal(http.StatusOK))
+	Expect(rec.Header().Get("Content-Type")).To(Equal(dohContentType))
+	Expect(rec.Header().Get("Cache-Control")).To(Equal("max-age=60"))
+	resp := new(dns.Msg)
+	Expect(resp.Unpack(rec.Body.Bytes())).To(BeNil())
+	Expect(resp.Answer).To(HaveLen(1))
+	Expect(resp.Answer[0].(*dns.A).A.String()).To(Equal("1.2.3.4"))
+}
+
+func TestHttpsServer(t *testing.T) {
+	RegisterTestingT(t)
+	s := newTestHttpsServer()
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	req.Id = 0
+	buf, err := req.Pack()
+	Expect(err).To(BeNil())
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns="+base64.RawURLEncoding.EncodeToString(buf), nil))
+	checkDohResponse(rec)
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader(buf))
+	r.Header.Set("Content-Type", dohContentType)
+	s.ServeHTTP(rec, r)
+	checkDohResponse(rec)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader(buf)))
+	Expect(rec.Code).To(Equal(http.StatusUnsupportedMediaType))
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns=!!", nil))
+	Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, dohPath, nil))
+	Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+
+	// remote address is tcp so responses are never truncated or rate limited
+	var network string
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		network = w.RemoteAddr().Network()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns="+base64.RawURLEncoding.EncodeToString(buf), nil))
+	Expect(rec.Code).To(Equal(http.StatusOK))
+	Expect(network).To(Equal("tcp"))
+
+	// zone transfers are not served over https
+	network = ""
+	axfr := new(dns.Msg)
+	axfr.SetAxfr("example.com.")
+	axfr.Id = 0
+	buf, err = axfr.Pack()
+	Expect(err).To(BeNil())
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dohPath+"?dns="+base64.RawURLEncoding.EncodeToString(buf), nil))
+	Expect(rec.Code).To(Equal(http.StatusOK))
+	resp := new(dns.Msg)
+	Expect(resp.Unpack(rec.Body.Bytes())).To(BeNil())
+	Expect(resp.Rcode).To(Equal(dns.RcodeNotImplemented))
+	Expect(network).To(BeEmpty())
+}
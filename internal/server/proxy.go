@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/patrickmn/go-cache"
+	"z42-core/internal/types"
+)
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyV2Length    = 16
+	// udp responses are sent back through the balancer that forwarded the request
+	proxyUdpTimeout = 30 * time.Second
+)
+
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+var errProxyHeader = errors.New("invalid proxy protocol header")
+
+// parseProxyV2 parses a PROXY v2 header at start of buf and returns source address and header length,
+// header length is 0 if buf has no header and source is nil for LOCAL commands and unsupported families
+func parseProxyV2(buf []byte) (*net.UDPAddr, int, error) {
+	if !bytes.HasPrefix(buf, proxyV2Signature) {
+		return nil, 0, nil
+	}
+	if len(buf) < proxyV2Length || buf[12]>>4 != 2 {
+		return nil, 0, errProxyHeader
+	}
+	length := proxyV2Length + int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < length {
+		return nil, 0, errProxyHeader
+	}
+	// LOCAL command is used by balancer health checks, connection endpoints are the real ones
+	if buf[12]&0x0F == 0 {
+		return nil, length, nil
+	}
+	addresses := buf[proxyV2Length:length]
+	switch buf[13] >> 4 {
+	case 1:
+		if len(addresses) < 12 {
+			return nil, 0, errProxyHeader
+		}
+		return &net.UDPAddr{IP: net.IP(addresses[0:4]).To16(), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, length, nil
+	case 2:
+		if len(addresses) < 36 {
+			return nil, 0, errProxyHeader
+		}
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, addresses[0:16])
+		return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, length, nil
+	default:
+		return nil, length, nil
+	}
+}
+
+// parseProxyV1 parses a text PROXY v1 header line, source is nil for UNKNOWN protocol
+func parseProxyV1(line string) (*net.TCPAddr, error) {
+	fields := strings.Fields(strings.TrimSuffix(line, "\r\n"))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyHeader reads a PROXY v1 or v2 header from r if there is one
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(prefix, proxyV2Signature):
+		header, err := r.Peek(proxyV2Length)
+		if err != nil {
+			return nil, err
+		}
+		length := proxyV2Length + int(binary.BigEndian.Uint16(header[14:16]))
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		src, _, err := parseProxyV2(buf)
+		if src == nil || err != nil {
+			return nil, err
+		}
+		return &net.TCPAddr{IP: src.IP, Port: src.Port}, nil
+	case bytes.HasPrefix(prefix, []byte(proxyV1Prefix)):
+		var line []byte
+		for !bytes.HasSuffix(line, []byte("\r\n")) {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			line = append(line, b)
+			if len(line) > proxyV1MaxLength {
+				return nil, errProxyHeader
+			}
+		}
+		src, err := parseProxyV1(string(line))
+		if src == nil || err != nil {
+			return nil, err
+		}
+		return src, nil
+	default:
+		return nil, nil
+	}
+}
+
+// trustedSources holds networks allowed to send PROXY headers, headers from other sources are not parsed
+type trustedSources []*net.IPNet
+
+func newTrustedSources(addresses []string) trustedSources {
+	var sources trustedSources
+	for _, address := range addresses {
+		if network, err := types.ParseNetwork(address); err == nil {
+			sources = append(sources, network)
+		}
+	}
+	return sources
+}
+
+func (t trustedSources) contains(addr net.Addr) bool {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	default:
+		return false
+	}
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted trustedSources
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil || !l.trusted.contains(conn.RemoteAddr()) {
+		return conn, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads PROXY header on first use, reads are done by server so its deadlines apply
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.remote = c.Conn.RemoteAddr()
+		src, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if src != nil {
+			c.remote = src
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+type proxyPacketConn struct {
+	net.PacketConn
+	trusted trustedSources
+	proxies *cache.Cache
+}
+
+func (c *proxyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil || !c.trusted.contains(addr) {
+			return n, addr, err
+		}
+		src, length, err := parseProxyV2(b[:n])
+		if err != nil {
+			// malformed headers are dropped like any other malformed packet
+			continue
+		}
+		if src == nil {
+			return copy(b, b[length:n]), addr, nil
+		}
+		c.proxies.SetDefault(src.String(), addr)
+		return copy(b, b[length:n]), src, nil
+	}
+}
+
+func (c *proxyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if proxy, found := c.proxies.Get(addr.String()); found {
+		addr = proxy.(net.Addr)
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// proxyServer binds its own listener so PROXY headers are removed before requests reach dns.Server
+type proxyServer struct {
+	*dns.Server
+	trusted trustedSources
+}
+
+func newProxyServer(server *dns.Server, config ProxyProtocolConfig) *proxyServer {
+	// leave room for proxy header in front of udp requests
+	server.UDPSize = dns.DefaultMsgSize
+	return &proxyServer{
+		Server:  server,
+		trusted: newTrustedSources(config.TrustedSources),
+	}
+}
+
+func (s *proxyServer) ListenAndServe() error {
+	switch s.Net {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(s.Net, s.Addr)
+		if err != nil {
+			return err
+		}
+		s.PacketConn = &proxyPacketConn{
+			PacketConn: conn,
+			trusted:    s.trusted,
+			proxies:    cache.New(proxyUdpTimeout, 2*proxyUdpTimeout),
+		}
+	default:
+		network := strings.TrimSuffix(s.Net, "-tls")
+		ln, err := net.Listen(network, s.Addr)
+		if err != nil {
+			return err
+		}
+		s.Listener = &proxyListener{Listener: ln, trusted: s.trusted}
+		if strings.HasSuffix(s.Net, "-tls") {
+			if s.TLSConfig == nil {
+				_ = ln.Close()
+				return errors.New("tls config is missing")
+			}
+			s.Listener = tls.NewListener(s.Listener, s.TLSConfig)
+		}
+	}
+	return s.ActivateAndServe()
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func proxyV2Header(command byte, src *net.UDPAddr, dst *net.UDPAddr, proto byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command)
+	var addresses []byte
+	if src.IP.To4() != nil {
+		header = append(header, 0x10|proto)
+		addresses = append(append(addresses, src.IP.To4()...), dst.IP.To4()...)
+	} else {
+		header = append(header, 0x20|proto)
+		addresses = append(append(addresses, src.IP.To16()...), dst.IP.To16()...)
+	}
+	addresses = binary.BigEndian.AppendUint16(addresses, uint16(src.Port))
+	addresses = binary.BigEndian.AppendUint16(addresses, uint16(dst.Port))
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	RegisterTestingT(t)
+	dst := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}
+	header := proxyV2Header(1, &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}, dst, 2)
+	src, length, err := parseProxyV2(append(header, 1, 2, 3))
+	Expect(err).To(BeNil())
+	Expect(length).To(Equal(len(header)))
+	Expect(src.String()).To(Equal("192.0.2.1:5353"))
+
+	header = proxyV2Header(1, &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5353}, &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 53}, 2)
+	src, _, err = parseProxyV2(header)
+	Expect(err).To(BeNil())
+	Expect(src.String()).To(Equal("[2001:db8::1]:5353"))
+
+	src, length, err = parseProxyV2(proxyV2Header(0, &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}, dst, 2))
+	Expect(err).To(BeNil())
+	Expect(src).To(BeNil())
+	Expect(length).To(Equal(28))
+
+	_, length, err = parseProxyV2([]byte{0, 1, 2})
+	Expect(err).To(BeNil())
+	Expect(length).To(BeZero())
+	_, _, err = parseProxyV2(header[:20])
+	Expect(err).NotTo(BeNil())
+
+	v1, err := parseProxyV1("PROXY TCP4 192.0.2.1 10.0.0.1 5353 53\r\n")
+	Expect(err).To(BeNil())
+	Expect(v1.String()).To(Equal("192.0.2.1:5353"))
+	v1, err = parseProxyV1("PROXY UNKNOWN\r\n")
+	Expect(err).To(BeNil())
+	Expect(v1).To(BeNil())
+	_, err = parseProxyV1("PROXY TCP4 192.0.2.1\r\n")
+	Expect(err).NotTo(BeNil())
+}
+
+func startProxyServer(protocol string, trusted []string) (*proxyServer, string) {
+	var port int
+	if protocol == "udp" {
+		port = freeUdpPort()
+	} else {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		port = ln.Addr().(*net.TCPAddr).Port
+		_ = ln.Close()
+	}
+	servers := NewServer([]Config{{Ip: "127.0.0.1", Port: port, Protocol: protocol, ProxyProtocol: ProxyProtocolConfig{Enable: true, TrustedSources: trusted}}})
+	s := servers[0].(*proxyServer)
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: []string{w.RemoteAddr().String()},
+		}}
+		_ = w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	s.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = s.ListenAndServe() }()
+	Eventually(started, 2*time.Second).Should(BeClosed())
+	return s, s.Addr
+}
+
+func proxyQuery(protocol string, addr string, header []byte) string {
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeTXT)
+	data, err := req.Pack()
+	Expect(err).To(BeNil())
+	conn, err := net.Dial(protocol, addr)
+	Expect(err).To(BeNil())
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if protocol == "udp" {
+		_, err = conn.Write(append(header, data...))
+		Expect(err).To(BeNil())
+		buf := make([]byte, dns.MaxMsgSize)
+		n, err := conn.Read(buf)
+		Expect(err).To(BeNil())
+		data = buf[:n]
+	} else {
+		_, err = conn.Write(header)
+		Expect(err).To(BeNil())
+		dnsConn := &dns.Conn{Conn: conn}
+		Expect(dnsConn.WriteMsg(req)).To(BeNil())
+		resp, err := dnsConn.ReadMsg()
+		Expect(err).To(BeNil())
+		return resp.Answer[0].(*dns.TXT).Txt[0]
+	}
+	resp := new(dns.Msg)
+	Expect(resp.Unpack(data)).To(BeNil())
+	return resp.Answer[0].(*dns.TXT).Txt[0]
+}
+
+func TestProxyServer(t *testing.T) {
+	RegisterTestingT(t)
+	src := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}
+	dst := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+
+	s, addr := startProxyServer("udp", []string{"127.0.0.0/8"})
+	Expect(proxyQuery("udp", addr, proxyV2Header(1, src, dst, 2))).To(Equal("192.0.2.1:5353"))
+	Expect(proxyQuery("udp", addr, nil)).To(HavePrefix("127.0.0.1:"))
+	_ = s.Shutdown()
+
+	s, addr = startProxyServer("tcp", []string{"127.0.0.1"})
+	Expect(proxyQuery("tcp", addr, proxyV2Header(1, src, dst, 1))).To(Equal("192.0.2.1:5353"))
+	Expect(proxyQuery("tcp", addr, []byte("PROXY TCP4 192.0.2.2 127.0.0.1 4444 53\r\n"))).To(Equal("192.0.2.2:4444"))
+	Expect(proxyQuery("tcp", addr, nil)).To(HavePrefix("127.0.0.1:"))
+	_ = s.Shutdown()
+
+	trusted := newTrustedSources([]string{"10.0.0.0/8", "2001:db8::1", "invalid"})
+	Expect(trusted).To(HaveLen(2))
+	Expect(trusted.contains(&net.UDPAddr{IP: net.ParseIP("10.1.2.3")})).To(BeTrue())
+	Expect(trusted.contains(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")})).To(BeTrue())
+	Expect(trusted.contains(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")})).To(BeFalse())
+}
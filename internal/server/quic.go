@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// error codes of rfc9250 section 4.3
+const (
+	doqInternalError = 0x1
+	doqProtocolError = 0x2
+	doqExcessiveLoad = 0x4
+)
+
+const doqReadTimeout = 5 * time.Second
+
+// QuicServer serves dns over quic (rfc9250), every stream carries a single query and its response,
+// zone transfer responses may take several messages
+type QuicServer struct {
+	Addr         string
+	Handler      dns.Handler
+	TsigProvider dns.TsigProvider
+	tlsConfig    *tls.Config
+	config       QuicConfig
+	connections  chan struct{}
+
+	lock     sync.Mutex
+	listener *quic.Listener
+	closed   bool
+}
+
+func NewQuicServer(cfg Config) *QuicServer {
+	defaults := DefaultConfig().Quic
+	if cfg.Quic.MaxConnections < 1 {
+		cfg.Quic.MaxConnections = defaults.MaxConnections
+	}
+	if cfg.Quic.MaxStreams < 1 {
+		cfg.Quic.MaxStreams = defaults.MaxStreams
+	}
+	if cfg.Quic.IdleTimeout < 1 {
+		cfg.Quic.IdleTimeout = defaults.IdleTimeout
+	}
+	s := &QuicServer{
+		Addr:        cfg.Ip + ":" + strconv.Itoa(cfg.Port),
+		config:      cfg.Quic,
+		connections: make(chan struct{}, cfg.Quic.MaxConnections),
+	}
+	if cfg.Tls.Enable {
+		s.tlsConfig = loadTlsConfig(cfg.Tls)
+	}
+	return s
+}
+
+func (s *QuicServer) ListenAndServe() error {
+	if s.tlsConfig == nil || len(s.tlsConfig.Certificates) == 0 {
+		return errors.New("dns over quic requires tls certificate")
+	}
+	tlsConfig := s.tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"doq"}
+	listener, err := quic.ListenAddr(s.Addr, tlsConfig, &quic.Config{
+		MaxIncomingStreams:    int64(s.config.MaxStreams),
+		MaxIncomingUniStreams: -1,
+		MaxIdleTimeout:        time.Duration(s.config.IdleTimeout) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return listener.Close()
+	}
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		select {
+		case s.connections <- struct{}{}:
+			go s.serveConnection(conn)
+		default:
+			_ = conn.CloseWithError(doqExcessiveLoad, "too many connections")
+		}
+	}
+}
+
+func (s *QuicServer) Shutdown() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *QuicServer) serveConnection(conn quic.Connection) {
+	defer func() { <-s.connections }()
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go s.serveStream(conn, stream)
+	}
+}
+
+func (s *QuicServer) serveStream(conn quic.Connection, stream quic.Stream) {
+	_ = stream.SetReadDeadline(time.Now().Add(doqReadTimeout))
+	buf, err := readQuicMessage(stream)
+	if err != nil {
+		_ = conn.CloseWithError(doqProtocolError, "invalid message")
+		return
+	}
+	req := new(dns.Msg)
+	// message id must be zero since streams already identify queries
+	if err := req.Unpack(buf); err != nil || req.Id != 0 {
+		_ = conn.CloseWithError(doqProtocolError, "invalid message")
+		return
+	}
+
+	writer := newMessageWriter("doq", conn.LocalAddr(), conn.RemoteAddr(), s.TsigProvider, req, buf)
+	// zone transfers are sent as several messages on the same stream (rfc9250 section 4.2)
+	writer.multiple = isTransfer(req)
+	writer.write = func(m *dns.Msg, data []byte) error {
+		msg := make([]byte, 2+len(data))
+		binary.BigEndian.PutUint16(msg, uint16(len(data)))
+		copy(msg[2:], data)
+		_, err := stream.Write(msg)
+		return err
+	}
+	handler := s.Handler
+	if handler == nil {
+		handler = dns.DefaultServeMux
+	}
+	handler.ServeDNS(writer, req)
+	if !writer.written {
+		stream.CancelWrite(doqInternalError)
+		return
+	}
+	_ = stream.Close()
+}
+
+// readQuicMessage reads a length prefixed message, client must not send anything after it
+func readQuicMessage(stream quic.Stream) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return nil, err
+	}
+	if extra, err := io.ReadAll(io.LimitReader(stream, 1)); err != nil || len(extra) != 0 {
+		return nil, errors.New("extra data after query")
+	}
+	return buf, nil
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"github.com/quic-go/quic-go"
+)
+
+func selfSignedTlsConfig() *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func freeUdpPort() int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func doqQuery(conn quic.Connection, m *dns.Msg) (*dns.Msg, error) {
+	msgs, err := doqExchange(conn, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 {
+		return nil, errors.New("expected a single response")
+	}
+	return msgs[0], nil
+}
+
+// doqExchange sends m on a new stream and returns all responses sent on it
+func doqExchange(conn quic.Connection, m *dns.Msg) ([]*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	data, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(msg, uint16(len(data)))
+	copy(msg[2:], data)
+	if _, err := stream.Write(msg); err != nil {
+		return nil, err
+	}
+	_ = stream.Close()
+	_ = stream.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*dns.Msg
+	for len(resp) > 0 {
+		if len(resp) < 2 {
+			return nil, errors.New("truncated response")
+		}
+		length := int(binary.BigEndian.Uint16(resp))
+		if len(resp) < 2+length {
+			return nil, errors.New("truncated response")
+		}
+		r := new(dns.Msg)
+		if err := r.Unpack(resp[2 : 2+length]); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, r)
+		resp = resp[2+length:]
+	}
+	return msgs, nil
+}
+
+func TestQuicServer(t *testing.T) {
+	RegisterTestingT(t)
+	s := NewQuicServer(Config{Ip: "127.0.0.1", Port: freeUdpPort(), Protocol: "doq", Quic: QuicConfig{MaxConnections: 1}})
+	s.tlsConfig = selfSignedTlsConfig()
+	transports := make(chan string, 10)
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		// remote address is tcp so responses are never truncated or rate limited
+		transports <- w.(interface{ Transport() string }).Transport() + "/" + w.RemoteAddr().Network()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		a, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 1.2.3.4")
+		m.Answer = []dns.RR{a}
+		_ = w.WriteMsg(m)
+	})
+	go func() { _ = s.ListenAndServe() }()
+	defer func() { _ = s.Shutdown() }()
+
+	clientTls := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var conn quic.Connection
+	Eventually(func() error {
+		var err error
+		conn, err = quic.DialAddr(ctx, s.Addr, clientTls, nil)
+		return err
+	}, 3*time.Second, 100*time.Millisecond).Should(BeNil())
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	req.Id = 0
+	for i := 0; i < 3; i++ {
+		resp, err := doqQuery(conn, req)
+		Expect(err).To(BeNil())
+		Expect(resp.Id).To(BeZero())
+		Expect(resp.Answer).To(HaveLen(1))
+		Expect(<-transports).To(Equal("doq/tcp"))
+	}
+
+	// connection limit is reached, new connections are refused
+	second, err := quic.DialAddr(ctx, s.Addr, clientTls, nil)
+	if err == nil {
+		_, err = doqQuery(second, req)
+	}
+	Expect(err).NotTo(BeNil())
+
+	// non-zero message id is a protocol error
+	req.Id = 1
+	_, err = doqQuery(conn, req)
+	Expect(err).NotTo(BeNil())
+}
+
+func TestQuicTransfer(t *testing.T) {
+	RegisterTestingT(t)
+	s := NewQuicServer(Config{Ip: "127.0.0.1", Port: freeUdpPort(), Protocol: "doq"})
+	s.tlsConfig = selfSignedTlsConfig()
+	s.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		// zone larger than one envelope, as sent by resolver transfers
+		ch := make(chan *dns.Envelope, 3)
+		for i := 0; i < 250; i += 100 {
+			var records []dns.RR
+			for j := i; j < i+100 && j < 250; j++ {
+				rr, _ := dns.NewRR(fmt.Sprintf("w%d.example.com. 300 IN A 1.2.3.4", j))
+				records = append(records, rr)
+			}
+			ch <- &dns.Envelope{RR: records}
+		}
+		close(ch)
+		_ = new(dns.Transfer).Out(w, r, ch)
+	})
+	go func() { _ = s.ListenAndServe() }()
+	defer func() { _ = s.Shutdown() }()
+
+	clientTls := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var conn quic.Connection
+	Eventually(func() error {
+		var err error
+		conn, err = quic.DialAddr(ctx, s.Addr, clientTls, nil)
+		return err
+	}, 3*time.Second, 100*time.Millisecond).Should(BeNil())
+
+	req := new(dns.Msg)
+	req.SetAxfr("example.com.")
+	req.Id = 0
+	msgs, err := doqExchange(conn, req)
+	Expect(err).To(BeNil())
+	Expect(msgs).To(HaveLen(3))
+	count := 0
+	for _, m := range msgs {
+		count += len(m.Answer)
+	}
+	Expect(count).To(Equal(250))
+}
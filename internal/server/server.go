@@ -38,10 +38,24 @@ func loadTlsConfig(cfg TlsConfig) *tls.Config {
 	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: root}
 }
 
-func NewServer(config []Config) []*dns.Server {
-	var servers []*dns.Server
+// Server is a listener that passes dns requests to the handler registered in dns.DefaultServeMux
+type Server interface {
+	ListenAndServe() error
+	Shutdown() error
+}
+
+func NewServer(config []Config) []Server {
+	var servers []Server
 	for _, cfg := range config {
-		if cfg.Count < 1 {
+		switch cfg.Protocol {
+		case "https":
+			servers = append(servers, NewHttpsServer(cfg))
+			continue
+		case "doq":
+			servers = append(servers, NewQuicServer(cfg))
+			continue
+		}
+		if cfg.Count < 1 || cfg.ProxyProtocol.Enable {
 			cfg.Count = 1
 		}
 		for i := 0; i < cfg.Count; i++ {
@@ -53,8 +67,28 @@ func NewServer(config []Config) []*dns.Server {
 			if cfg.Tls.Enable {
 				server.TLSConfig = loadTlsConfig(cfg.Tls)
 			}
+			if cfg.ProxyProtocol.Enable {
+				servers = append(servers, newProxyServer(server, cfg.ProxyProtocol))
+				continue
+			}
 			servers = append(servers, server)
 		}
 	}
 	return servers
 }
+
+// SetTsigProvider sets provider used by servers to verify and sign tsig messages
+func SetTsigProvider(servers []Server, provider dns.TsigProvider) {
+	for _, s := range servers {
+		switch s := s.(type) {
+		case *dns.Server:
+			s.TsigProvider = provider
+		case *proxyServer:
+			s.TsigProvider = provider
+		case *HttpsServer:
+			s.TsigProvider = provider
+		case *QuicServer:
+			s.TsigProvider = provider
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// messageWriter implements dns.ResponseWriter for transports that carry one response per request unless
+// multiple is set, requests are treated like tcp so answers are never truncated
+type messageWriter struct {
+	local          net.Addr
+	remote         net.Addr
+	transport      string
+	provider       dns.TsigProvider
+	tsigStatus     error
+	tsigRequestMAC string
+	tsigTimersOnly bool
+	multiple       bool
+	write          func(m *dns.Msg, data []byte) error
+	written        bool
+}
+
+func newMessageWriter(transport string, local net.Addr, remote net.Addr, provider dns.TsigProvider, req *dns.Msg, buf []byte) *messageWriter {
+	w := &messageWriter{
+		local:     tcpAddr(local),
+		remote:    tcpAddr(remote),
+		transport: transport,
+		provider:  provider,
+	}
+	if t := req.IsTsig(); t != nil {
+		w.tsigRequestMAC = t.MAC
+		if provider == nil {
+			w.tsigStatus = dns.ErrSecret
+		} else {
+			w.tsigStatus = dns.TsigVerifyWithProvider(buf, provider, "", false)
+		}
+	}
+	return w
+}
+
+// tcpAddr converts addr to a tcp address, request context decides on truncation by address type
+func tcpAddr(addr net.Addr) net.Addr {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr
+	case *net.UDPAddr:
+		return &net.TCPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+	case nil:
+		return &net.TCPAddr{}
+	default:
+		if a, err := net.ResolveTCPAddr("tcp", addr.String()); err == nil {
+			return a
+		}
+		return &net.TCPAddr{}
+	}
+}
+
+func (w *messageWriter) LocalAddr() net.Addr {
+	return w.local
+}
+
+func (w *messageWriter) RemoteAddr() net.Addr {
+	return w.remote
+}
+
+func (w *messageWriter) WriteMsg(m *dns.Msg) error {
+	var (
+		data []byte
+		err  error
+	)
+	if m.IsTsig() != nil && w.provider != nil {
+		var mac string
+		data, mac, err = dns.TsigGenerateWithProvider(m, w.provider, w.tsigRequestMAC, w.tsigTimersOnly)
+		// following messages of a transfer are signed with mac of previous one (rfc8945 section 5.3.1)
+		w.tsigRequestMAC = mac
+	} else {
+		data, err = m.Pack()
+	}
+	if err != nil {
+		return err
+	}
+	return w.writeOnce(m, data)
+}
+
+func (w *messageWriter) Write(data []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(data); err != nil {
+		return 0, err
+	}
+	if err := w.writeOnce(m, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *messageWriter) writeOnce(m *dns.Msg, data []byte) error {
+	if w.written && !w.multiple {
+		return errors.New("response already written")
+	}
+	w.written = true
+	return w.write(m, data)
+}
+
+func (w *messageWriter) Close() error {
+	return nil
+}
+
+func (w *messageWriter) TsigStatus() error {
+	return w.tsigStatus
+}
+
+func (w *messageWriter) TsigTimersOnly(b bool) {
+	w.tsigTimersOnly = b
+}
+
+func (w *messageWriter) Hijack() {}
+
+// Transport is recorded in access log to tell requests apart from plain tcp
+func (w *messageWriter) Transport() string {
+	return w.transport
+}
+
+// isTransfer reports whether req asks for a zone transfer
+func isTransfer(req *dns.Msg) bool {
+	if len(req.Question) == 0 {
+		return false
+	}
+	qtype := req.Question[0].Qtype
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
@@ -8,9 +8,11 @@ type DataHandlerConfig struct {
 	ZoneReload         int            `json:"zone_reload"`
 	RecordCacheSize    int            `json:"record_cache_size"`
 	RecordCacheTimeout int64          `json:"record_cache_timeout"`
+	SignatureCacheSize int            `json:"signature_cache_size"`
 	Redis              hiredis.Config `json:"redis"`
 	MinTTL             uint32         `json:"min_ttl"`
 	MaxTTL             uint32         `json:"max_ttl"`
+	JournalSize        int            `json:"journal_size"`
 }
 
 func DefaultDataHandlerConfig() DataHandlerConfig {
@@ -20,8 +22,10 @@ func DefaultDataHandlerConfig() DataHandlerConfig {
 		ZoneReload:         60,
 		RecordCacheSize:    1000000,
 		RecordCacheTimeout: 60,
+		SignatureCacheSize: 100000,
 		MinTTL:             5,
 		MaxTTL:             300,
+		JournalSize:        100,
 		Redis:              hiredis.DefaultConfig(),
 	}
 }
@@ -23,6 +23,7 @@ import (
 )
 
 type DataHandler struct {
+	*DataView
 	config         *DataHandlerConfig
 	redis          *hiredis.Redis
 	zones          atomic.Value
@@ -31,6 +32,7 @@ type DataHandler struct {
 	recordInflight *singleflight.Group
 	zoneCache      *ristretto.Cache
 	zoneInflight   *singleflight.Group
+	signatureCache *ristretto.Cache
 	quit           chan struct{}
 	quitWG         sync.WaitGroup
 }
@@ -50,6 +52,7 @@ func NewDataHandler(config *DataHandlerConfig) *DataHandler {
 		zoneInflight:   new(singleflight.Group),
 		quit:           make(chan struct{}),
 	}
+	dh.DataView = &DataView{dh: dh}
 	dh.zones.Store(iradix.New())
 	dh.zoneCache, _ = ristretto.NewCache(&ristretto.Config{
 		NumCounters: int64(config.ZoneCacheSize) * 10,
@@ -63,6 +66,12 @@ func NewDataHandler(config *DataHandlerConfig) *DataHandler {
 		BufferItems: 64,
 		Metrics:     false,
 	})
+	dh.signatureCache, _ = ristretto.NewCache(&ristretto.Config{
+		NumCounters: int64(config.SignatureCacheSize) * 10,
+		MaxCost:     int64(config.SignatureCacheSize),
+		BufferItems: 64,
+		Metrics:     false,
+	})
 
 	return dh
 }
@@ -91,6 +100,10 @@ func (dh *DataHandler) Start() {
 			keyParts := splitDbKey(keyStr)
 			if isRRSetEntry(keyParts) {
 				dh.recordCache.Del(keyStr)
+				dh.invalidateSignatures(keyParts[0], keyParts[2], keyParts[3])
+			} else if isViewRRSetEntry(keyParts) {
+				dh.recordCache.Del(keyStr)
+				dh.invalidateSignatures(keyParts[0], keyParts[3], keyParts[4])
 			} else {
 				dh.zoneCache.Del(keyParts[0])
 			}
@@ -130,6 +143,13 @@ func isRRSetEntry(parts []string) bool {
 	return false
 }
 
+func isViewRRSetEntry(parts []string) bool {
+	if len(parts) == 5 && parts[1] == "views" {
+		return true
+	}
+	return false
+}
+
 func splitDbKey(key string) []string {
 	key = strings.TrimPrefix(key, keyPrefix)
 	return strings.Split(key, ":")
@@ -152,6 +172,14 @@ func zoneLocationRRSetKey(zone string, label string, rtype string) string {
 	return keyPrefix + zone + ":labels:" + label + ":" + rtype
 }
 
+func zoneViewRRSetKey(zone string, view string, label string, rtype string) string {
+	return keyPrefix + zone + ":views:" + view + ":" + label + ":" + rtype
+}
+
+func zoneViewsWildcard(zone string) string {
+	return keyPrefix + zone + ":views:*"
+}
+
 func zonePubKey(zone string, keyType string) string {
 	return keyPrefix + zone + ":" + keyType + ":pub"
 }
@@ -250,6 +278,15 @@ func (dh *DataHandler) GetZoneConfig(zone string) (*types.ZoneConfig, error) {
 	return z.Config, nil
 }
 
+// ReadZoneConfig loads zone config directly from redis bypassing zone cache
+func (dh *DataHandler) ReadZoneConfig(zone string) (*types.ZoneConfig, error) {
+	configStr, err := dh.redis.Get(zoneConfigKey(zone))
+	if err != nil {
+		return nil, err
+	}
+	return types.ZoneConfigFromJson(zone, configStr), nil
+}
+
 func (dh *DataHandler) GetZones() []string {
 	domains, err := dh.redis.SMembers(zonesKey)
 	if err != nil {
@@ -288,7 +325,10 @@ func (dh *DataHandler) SetZoneConfigFromJson(zone string, config string) error {
 }
 
 func (dh *DataHandler) getRRSet(zone string, label string, rtype uint16, result types.RRSet) (types.RRSet, error) {
-	key := zoneLocationRRSetKey(zone, label, types.TypeToString(rtype))
+	return dh.loadRRSet(zoneLocationRRSetKey(zone, label, types.TypeToString(rtype)), zone, label, result)
+}
+
+func (dh *DataHandler) loadRRSet(key string, zone string, label string, result types.RRSet) (types.RRSet, error) {
 	cachedRRSet, found := dh.recordCache.Get(key)
 	var r types.RRSet
 	if found {
@@ -330,6 +370,22 @@ func (dh *DataHandler) getRRSet(zone string, label string, rtype uint16, result
 	return answer.(types.RRSet), nil
 }
 
+// View returns zone data as seen by clients of view, empty name is the default view
+func (dh *DataHandler) View(view string) *DataView {
+	if view == "" {
+		return dh.DataView
+	}
+	return &DataView{dh: dh, view: view}
+}
+
+func (dh *DataHandler) SetViewRRSet(zone string, view string, label string, rtype uint16, rrset types.RRSet) error {
+	jsonValue, err := jsoniter.Marshal(rrset)
+	if err != nil {
+		return err
+	}
+	return dh.redis.Set(zoneViewRRSetKey(zone, view, label, types.TypeToString(rtype)), string(jsonValue))
+}
+
 func (dh *DataHandler) SetRRSetFromJson(zone string, label string, rtype uint16, value string) error {
 	return dh.redis.Set(zoneLocationRRSetKey(zone, label, types.TypeToString(rtype)), value)
 }
@@ -346,6 +402,7 @@ type locationEntry struct {
 	A     *types.IP_RRSet    `json:"a,omitempty"`
 	AAAA  *types.IP_RRSet    `json:"aaaa,omitempty"`
 	CNAME *types.CNAME_RRSet `json:"cname,omitempty"`
+	DNAME *types.DNAME_RRSet `json:"dname,omitempty"`
 	TXT   *types.TXT_RRSet   `json:"txt,omitempty"`
 	NS    *types.NS_RRSet    `json:"ns,omitempty"`
 	MX    *types.MX_RRSet    `json:"mx,omitempty"`
@@ -354,6 +411,8 @@ type locationEntry struct {
 	PTR   *types.PTR_RRSet   `json:"ptr,omitempty"`
 	TLSA  *types.TLSA_RRSet  `json:"tlsa,omitempty"`
 	DS    *types.DS_RRSet    `json:"ds,omitempty"`
+	SVCB  *types.SVCB_RRSet  `json:"svcb,omitempty"`
+	HTTPS *types.HTTPS_RRSet `json:"https,omitempty"`
 	ANAME *types.ANAME_RRSet `json:"aname,omitempty"`
 }
 
@@ -383,6 +442,12 @@ func (dh *DataHandler) SetLocationFromJson(zone string, location string, value s
 			zap.L().Error("cannot set rrset", zap.Error(err))
 		}
 	}
+	if entry.DNAME != nil {
+		entry.DNAME.TtlValue = fixTTL(entry.DNAME.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeDNAME, entry.DNAME); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
 	if entry.TXT != nil {
 		entry.TXT.TtlValue = fixTTL(entry.TXT.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
 		if err := dh.SetRRSet(zone, location, dns.TypeTXT, entry.TXT); err != nil {
@@ -431,12 +496,41 @@ func (dh *DataHandler) SetLocationFromJson(zone string, location string, value s
 			zap.L().Error("cannot set rrset", zap.Error(err))
 		}
 	}
+	if entry.SVCB != nil {
+		entry.SVCB.TtlValue = fixTTL(entry.SVCB.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeSVCB, entry.SVCB); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
+	if entry.HTTPS != nil {
+		entry.HTTPS.TtlValue = fixTTL(entry.HTTPS.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, dns.TypeHTTPS, entry.HTTPS); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
 	if entry.ANAME != nil {
 		entry.ANAME.TtlValue = fixTTL(entry.ANAME.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
 		if err := dh.SetRRSet(zone, location, types.TypeANAME, entry.ANAME); err != nil {
 			zap.L().Error("cannot set rrset", zap.Error(err))
 		}
 	}
+	var generic map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal([]byte(value), &generic); err != nil {
+		return err
+	}
+	for rtype, rvalue := range generic {
+		if !types.IsGeneric(types.StringToType(rtype)) {
+			continue
+		}
+		rrset := types.TypeStrToRRSet(rtype).(*types.Raw_RRSet)
+		if err := jsoniter.Unmarshal(rvalue, rrset); err != nil {
+			return err
+		}
+		rrset.TtlValue = fixTTL(rrset.TtlValue, dh.config.MinTTL, dh.config.MaxTTL)
+		if err := dh.SetRRSet(zone, location, rrset.Type, rrset); err != nil {
+			zap.L().Error("cannot set rrset", zap.Error(err))
+		}
+	}
 	return nil
 }
 
@@ -450,102 +544,152 @@ func fixTTL(ttl uint32, min uint32, max uint32) uint32 {
 	return ttl
 }
 
-func (dh *DataHandler) A(zone string, label string) (*types.IP_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeA, &types.IP_RRSet{})
+// DataView reads rrsets of a split horizon view, rrsets a view does not override come from default zone data
+type DataView struct {
+	dh   *DataHandler
+	view string
+}
+
+func (v *DataView) getRRSet(zone string, label string, rtype uint16, result types.RRSet) (types.RRSet, error) {
+	if v.view == "" {
+		return v.dh.getRRSet(zone, label, rtype, result)
+	}
+	r, err := v.dh.loadRRSet(zoneViewRRSetKey(zone, v.view, label, types.TypeToString(rtype)), zone, label, result)
+	if err != nil || !r.Empty() {
+		return r, err
+	}
+	// result is cached for view key, default data needs a value of its own
+	return v.dh.getRRSet(zone, label, rtype, types.TypeToRRSet(rtype))
+}
+
+func (v *DataView) A(zone string, label string) (*types.IP_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeA, &types.IP_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.IP_RRSet), nil
 }
 
-func (dh *DataHandler) AAAA(zone string, label string) (*types.IP_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeAAAA, &types.IP_RRSet{})
+func (v *DataView) AAAA(zone string, label string) (*types.IP_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeAAAA, &types.IP_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.IP_RRSet), nil
 }
 
-func (dh *DataHandler) CNAME(zone string, label string) (*types.CNAME_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeCNAME, &types.CNAME_RRSet{})
+func (v *DataView) CNAME(zone string, label string) (*types.CNAME_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeCNAME, &types.CNAME_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.CNAME_RRSet), nil
 }
 
-func (dh *DataHandler) TXT(zone string, label string) (*types.TXT_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeTXT, &types.TXT_RRSet{})
+func (v *DataView) DNAME(zone string, label string) (*types.DNAME_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeDNAME, &types.DNAME_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.DNAME_RRSet), nil
+}
+
+func (v *DataView) TXT(zone string, label string) (*types.TXT_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeTXT, &types.TXT_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.TXT_RRSet), nil
 }
 
-func (dh *DataHandler) NS(zone string, label string) (*types.NS_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeNS, &types.NS_RRSet{})
+func (v *DataView) NS(zone string, label string) (*types.NS_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeNS, &types.NS_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.NS_RRSet), nil
 }
 
-func (dh *DataHandler) MX(zone string, label string) (*types.MX_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeMX, &types.MX_RRSet{})
+func (v *DataView) MX(zone string, label string) (*types.MX_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeMX, &types.MX_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.MX_RRSet), nil
 }
 
-func (dh *DataHandler) SRV(zone string, label string) (*types.SRV_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeSRV, &types.SRV_RRSet{})
+func (v *DataView) SRV(zone string, label string) (*types.SRV_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeSRV, &types.SRV_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.SRV_RRSet), nil
 }
 
-func (dh *DataHandler) CAA(zone string, label string) (*types.CAA_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeCAA, &types.CAA_RRSet{})
+func (v *DataView) CAA(zone string, label string) (*types.CAA_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeCAA, &types.CAA_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.CAA_RRSet), nil
 }
 
-func (dh *DataHandler) PTR(zone string, label string) (*types.PTR_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypePTR, &types.PTR_RRSet{})
+func (v *DataView) PTR(zone string, label string) (*types.PTR_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypePTR, &types.PTR_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.PTR_RRSet), nil
 }
 
-func (dh *DataHandler) TLSA(zone string, label string) (*types.TLSA_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeTLSA, &types.TLSA_RRSet{})
+func (v *DataView) TLSA(zone string, label string) (*types.TLSA_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeTLSA, &types.TLSA_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.TLSA_RRSet), nil
 }
 
-func (dh *DataHandler) DS(zone string, label string) (*types.DS_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, dns.TypeDS, &types.DS_RRSet{})
+func (v *DataView) DS(zone string, label string) (*types.DS_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeDS, &types.DS_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.DS_RRSet), nil
 }
 
-func (dh *DataHandler) ANAME(zone string, label string) (*types.ANAME_RRSet, error) {
-	r, err := dh.getRRSet(zone, label, types.TypeANAME, &types.ANAME_RRSet{})
+func (v *DataView) SVCB(zone string, label string) (*types.SVCB_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeSVCB, &types.SVCB_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.SVCB_RRSet), nil
+}
+
+func (v *DataView) HTTPS(zone string, label string) (*types.HTTPS_RRSet, error) {
+	r, err := v.getRRSet(zone, label, dns.TypeHTTPS, &types.HTTPS_RRSet{})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*types.HTTPS_RRSet), nil
+}
+
+func (v *DataView) ANAME(zone string, label string) (*types.ANAME_RRSet, error) {
+	r, err := v.getRRSet(zone, label, types.TypeANAME, &types.ANAME_RRSet{})
 	if err != nil {
 		return nil, err
 	}
 	return r.(*types.ANAME_RRSet), nil
 }
 
+func (v *DataView) RRSet(zone string, label string, rtype uint16) (types.RRSet, error) {
+	result := types.TypeToRRSet(rtype)
+	if result == nil {
+		return nil, fmt.Errorf("invalid rrset type: %d", rtype)
+	}
+	return v.getRRSet(zone, label, rtype, result)
+}
+
 func (dh *DataHandler) SetZoneKey(zone string, keyType string, pub string, priv string) error {
 	if err := dh.redis.Set(zonePubKey(zone, keyType), pub); err != nil {
 		return err
@@ -553,20 +697,10 @@ func (dh *DataHandler) SetZoneKey(zone string, keyType string, pub string, priv
 	return dh.redis.Set(zonePrivKey(zone, keyType), priv)
 }
 
-func (dh *DataHandler) loadKey(zone string, keyType string) *types.ZoneKey {
-	pubStr, _ := dh.redis.Get(zonePubKey(zone, keyType))
-	if pubStr == "" {
-		zap.L().Error("key is not set", zap.String("key", zonePubKey(zone, keyType)))
-		return nil
-	}
-	privStr, _ := dh.redis.Get(zonePrivKey(zone, keyType))
-	if privStr == "" {
-		zap.L().Error("key is not set", zap.String("key", zonePrivKey(zone, keyType)))
-		return nil
-	}
+func parseZoneKey(pubStr string, privStr string) *types.ZoneKey {
 	privStr = strings.Replace(privStr, "\\n", "\n", -1)
 	zoneKey := new(types.ZoneKey)
-	if rr, err := dns.NewRR(pubStr); err == nil {
+	if rr, err := dns.NewRR(pubStr); err == nil && rr != nil {
 		zoneKey.DnsKey = rr.(*dns.DNSKEY)
 	} else {
 		zap.L().Error("cannot parse zone key", zap.Error(err))
@@ -578,37 +712,61 @@ func (dh *DataHandler) loadKey(zone string, keyType string) *types.ZoneKey {
 		zap.L().Error("cannot create private key", zap.Error(err))
 		return nil
 	}
-	now := time.Now()
-	zoneKey.KeyInception = uint32(now.Add(-3 * time.Hour).Unix())
-	zoneKey.KeyExpiration = uint32(now.Add(8 * 24 * time.Hour).Unix())
 	return zoneKey
 }
 
 func (dh *DataHandler) loadZoneKeys(z *types.Zone) {
 	if z.Config.DnsSec {
-		z.ZSK = dh.loadKey(z.Name, "zsk")
-		if z.ZSK == nil {
-			z.Config.DnsSec = false
-			return
+		storedKeys, err := dh.ZoneKeys(z.Name)
+		if err != nil {
+			zap.L().Error("cannot load zone keys", zap.String("zone", z.Name), zap.Error(err))
+		}
+		inception, expiration := dnssec.SignatureWindow(time.Now(), z.Config.Signature)
+		for _, storedKey := range storedKeys {
+			key := parseZoneKey(storedKey.Public, storedKey.Private)
+			if key == nil {
+				continue
+			}
+			key.State = storedKey.State
+			key.KeyInception = inception
+			key.KeyExpiration = expiration
+			key.Since = storedKey.Since
+			if storedKey.Type == "ksk" {
+				key.DnsKey.Flags = dnssec.KSKFlags
+			} else {
+				key.DnsKey.Flags = dnssec.ZSKFlags
+			}
+			z.Keys = append(z.Keys, key)
 		}
-		z.KSK = dh.loadKey(z.Name, "ksk")
-		if z.KSK == nil {
+
+		z.ZSK = dnssec.ActiveKey(z.Keys, dnssec.ZSKFlags)
+		z.KSK = dnssec.ActiveKey(z.Keys, dnssec.KSKFlags)
+		if z.ZSK == nil || z.KSK == nil {
+			zap.L().Error("no active key", zap.String("zone", z.Name))
 			z.Config.DnsSec = false
 			return
 		}
 
-		z.ZSK.DnsKey.Flags = 256
-		z.KSK.DnsKey.Flags = 257
-		if z.ZSK.DnsKey.Hdr.Ttl != z.KSK.DnsKey.Hdr.Ttl {
-			z.ZSK.DnsKey.Hdr.Ttl = z.KSK.DnsKey.Hdr.Ttl
+		ttl := z.KSK.DnsKey.Hdr.Ttl
+		for _, key := range z.Keys {
+			key.DnsKey.Hdr.Ttl = ttl
+			if types.KeyPublished(key.State) {
+				z.DnsKeys = append(z.DnsKeys, key.DnsKey)
+			}
 		}
 
-		if rrsig := dnssec.SignRRSet([]dns.RR{z.ZSK.DnsKey, z.KSK.DnsKey}, z.Name, z.KSK, z.KSK.DnsKey.Hdr.Ttl); rrsig != nil {
-			z.DnsKeySig = rrsig
-		} else {
-			zap.L().Error("cannot create RRSIG for DNSKEY")
-			z.Config.DnsSec = false
-			return
+		// every signing ksk signs the key set so both old and new ksk validate during rollover
+		for _, key := range z.Keys {
+			if !types.KeySigns(key.State) || key.DnsKey.Flags != dnssec.KSKFlags {
+				continue
+			}
+			if rrsig := dh.SignRRSet(z.DnsKeys, z.Name, key, ttl); rrsig != nil {
+				z.DnsKeySigs = append(z.DnsKeySigs, rrsig)
+			} else {
+				zap.L().Error("cannot create RRSIG for DNSKEY")
+				z.Config.DnsSec = false
+				return
+			}
 		}
 	}
 }
@@ -632,6 +790,30 @@ func (dh *DataHandler) SetRevision(revision int) error {
 	return dh.redis.Set(revisionKey, strconv.Itoa(revision))
 }
 
+func viewConfigs(views []database.View) []types.ViewConfig {
+	var configs []types.ViewConfig
+	for _, view := range views {
+		configs = append(configs, view.ViewConfig)
+	}
+	return configs
+}
+
+// setViewRecords stores rrset overrides of views, zone config only keeps how views are selected
+func setViewRecords(tx hiredis.Transaction, zone string, views []database.View) (hiredis.Transaction, error) {
+	for _, view := range views {
+		for label, location := range view.Records {
+			for rtype, rrset := range location {
+				value, err := jsoniter.Marshal(rrset)
+				if err != nil {
+					return tx, err
+				}
+				tx = tx.Set(zoneViewRRSetKey(zone, view.Name, label, rtype), string(value))
+			}
+		}
+	}
+	return tx, nil
+}
+
 func (dh *DataHandler) ApplyEvent(event database.Event) error {
 	var tx hiredis.Transaction
 	switch event.Type {
@@ -641,10 +823,18 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 			return err
 		}
 		config := &types.ZoneConfig{
-			DomainId:        event.ZoneId,
-			SOA:             &newZone.SOA,
-			DnsSec:          newZone.Dnssec,
-			CnameFlattening: newZone.CNameFlattening,
+			DomainId:           event.ZoneId,
+			SOA:                &newZone.SOA,
+			DnsSec:             newZone.Dnssec,
+			CnameFlattening:    newZone.CNameFlattening,
+			AllowTransfer:      newZone.AllowTransfer,
+			Primaries:          newZone.Primaries,
+			AlsoNotify:         newZone.AlsoNotify,
+			NSEC3:              newZone.NSEC3,
+			KeyAlgorithm:       newZone.KeyAlgorithm,
+			Signature:          newZone.Signature,
+			IgnoreClientSubnet: newZone.IgnoreClientSubnet,
+			Views:              viewConfigs(newZone.Views),
 		}
 		configJson, err := jsoniter.Marshal(config)
 		if err != nil {
@@ -660,6 +850,7 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		}
 		tx.
 			Del(zoneWildcard(newZone.Name)).
+			Del(zoneJournalKey(newZone.Name)).
 			SAdd(zoneLocationsKey(newZone.Name), "@").
 			Set(zoneConfigKey(newZone.Name), string(configJson)).
 			Set(zoneLocationRRSetKey(newZone.Name, "@", types.TypeToString(dns.TypeNS)), string(nsValue)).
@@ -667,6 +858,9 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 			Set(zonePrivKey(newZone.Name, "ksk"), newZone.Keys.KSKPrivate).
 			Set(zonePubKey(newZone.Name, "zsk"), newZone.Keys.ZSKPublic).
 			Set(zonePrivKey(newZone.Name, "zsk"), newZone.Keys.ZSKPrivate)
+		if tx, err = setViewRecords(tx, newZone.Name, newZone.Views); err != nil {
+			return err
+		}
 	case database.ImportZone:
 		var importZone database.ZoneImport
 		zap.L().Error("importZone", zap.String("data", event.Value))
@@ -683,22 +877,53 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 				tx.Set(zoneLocationRRSetKey(importZone.Name, location, recordType), string(value))
 			}
 		}
+		var err error
+		if tx, err = dh.bumpSerial(tx, importZone.Name, nil); err != nil {
+			return err
+		}
 	case database.UpdateZone:
 		var zoneUpdate database.ZoneUpdate
 		if err := jsoniter.Unmarshal([]byte(event.Value), &zoneUpdate); err != nil {
 			return err
 		}
 		config := &types.ZoneConfig{
-			DomainId:        event.ZoneId,
-			SOA:             &zoneUpdate.SOA,
-			DnsSec:          zoneUpdate.Dnssec,
-			CnameFlattening: zoneUpdate.CNameFlattening,
+			DomainId:           event.ZoneId,
+			SOA:                &zoneUpdate.SOA,
+			DnsSec:             zoneUpdate.Dnssec || zoneUpdate.CDSDelete,
+			CnameFlattening:    zoneUpdate.CNameFlattening,
+			AllowTransfer:      zoneUpdate.AllowTransfer,
+			Primaries:          zoneUpdate.Primaries,
+			AlsoNotify:         zoneUpdate.AlsoNotify,
+			NSEC3:              zoneUpdate.NSEC3,
+			KeyAlgorithm:       zoneUpdate.KeyAlgorithm,
+			Signature:          zoneUpdate.Signature,
+			IgnoreClientSubnet: zoneUpdate.IgnoreClientSubnet,
+			Views:              viewConfigs(zoneUpdate.Views),
+			// zone stays signed while delete cds is published so parent can validate it
+			CDSDelete: !zoneUpdate.Dnssec && zoneUpdate.CDSDelete,
+		}
+		if current, err := dh.redis.Get(zoneConfigKey(zoneUpdate.Name)); err == nil {
+			currentSOA := types.ZoneConfigFromJson(zoneUpdate.Name, current).SOA
+			if len(config.Primaries) > 0 {
+				// soa of secondary zones comes from primary
+				config.SOA = currentSOA
+			} else {
+				// served serial is kept here only, serial stored by api is used when zone is added
+				config.SOA.Serial = currentSOA.Serial + 1
+			}
 		}
 		configJson, err := jsoniter.Marshal(config)
 		if err != nil {
 			return err
 		}
+		staleViewKeys, err := dh.redis.GetKeys(zoneViewsWildcard(zoneUpdate.Name))
+		if err != nil {
+			return err
+		}
 		tx = dh.redis.Start()
+		for _, key := range staleViewKeys {
+			tx.Del(key)
+		}
 		if zoneUpdate.Enabled {
 			tx.SAdd(zonesKey, zoneUpdate.Name)
 		} else {
@@ -706,7 +931,11 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		}
 		tx.
 			SAdd(zoneLocationsKey(zoneUpdate.Name), "@").
-			Set(zoneConfigKey(zoneUpdate.Name), string(configJson))
+			Set(zoneConfigKey(zoneUpdate.Name), string(configJson)).
+			Del(zoneJournalKey(zoneUpdate.Name))
+		if tx, err = setViewRecords(tx, zoneUpdate.Name, zoneUpdate.Views); err != nil {
+			return err
+		}
 	case database.DeleteZone:
 		var zoneDelete database.ZoneDelete
 		if err := jsoniter.Unmarshal([]byte(event.Value), &zoneDelete); err != nil {
@@ -715,7 +944,10 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		tx = dh.redis.Start()
 		tx.
 			SRem(zonesKey, zoneDelete.Name).
-			Del(zoneWildcard(zoneDelete.Name))
+			Del(zoneWildcard(zoneDelete.Name)).
+			Del(zoneJournalKey(zoneDelete.Name)).
+			Del(zoneTSIGKey(zoneDelete.Name)).
+			Del(zoneKeysKey(zoneDelete.Name))
 	case database.AddLocation:
 		var newLocation database.NewLocation
 		if err := jsoniter.Unmarshal([]byte(event.Value), &newLocation); err != nil {
@@ -725,6 +957,10 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		if newLocation.Enabled {
 			tx.SAdd(zoneLocationsKey(newLocation.ZoneName), newLocation.Location)
 		}
+		var err error
+		if tx, err = dh.bumpSerial(tx, newLocation.ZoneName, nil); err != nil {
+			return err
+		}
 	case database.UpdateLocation:
 		var locationUpdate database.LocationUpdate
 		if err := jsoniter.Unmarshal([]byte(event.Value), &locationUpdate); err != nil {
@@ -736,6 +972,10 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		} else {
 			tx.SRem(zoneLocationsKey(locationUpdate.ZoneName), locationUpdate.Location)
 		}
+		var err error
+		if tx, err = dh.bumpSerial(tx, locationUpdate.ZoneName, nil); err != nil {
+			return err
+		}
 	case database.DeleteLocation:
 		var locationDelete database.LocationDelete
 		if err := jsoniter.Unmarshal([]byte(event.Value), &locationDelete); err != nil {
@@ -745,15 +985,25 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		tx.
 			SRem(zoneLocationsKey(locationDelete.ZoneName), locationDelete.Location).
 			Del(locationWildcard(locationDelete.ZoneName, locationDelete.Location))
+		var err error
+		if tx, err = dh.bumpSerial(tx, locationDelete.ZoneName, nil); err != nil {
+			return err
+		}
 	case database.AddRecord:
 		var newRecord database.NewRecordSet
 		if err := jsoniter.Unmarshal([]byte(event.Value), &newRecord); err != nil {
 			return err
 		}
 		tx = dh.redis.Start()
+		var value types.RRSet
 		if newRecord.Enabled {
-			value, _ := jsoniter.Marshal(newRecord.Value)
-			tx.Set(zoneLocationRRSetKey(newRecord.ZoneName, newRecord.Location, newRecord.Type), string(value))
+			value = newRecord.Value
+			valueJson, _ := jsoniter.Marshal(newRecord.Value)
+			tx.Set(zoneLocationRRSetKey(newRecord.ZoneName, newRecord.Location, newRecord.Type), string(valueJson))
+		}
+		var err error
+		if tx, err = dh.journalRecordSet(tx, newRecord.ZoneName, newRecord.Location, newRecord.Type, value); err != nil {
+			return err
 		}
 	case database.UpdateRecord:
 		var recordUpdate database.RecordSetUpdate
@@ -761,12 +1011,18 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 			return err
 		}
 		tx = dh.redis.Start()
+		var value types.RRSet
 		if recordUpdate.Enabled {
-			value, _ := jsoniter.Marshal(recordUpdate.Value)
-			tx.Set(zoneLocationRRSetKey(recordUpdate.ZoneName, recordUpdate.Location, recordUpdate.Type), string(value))
+			value = recordUpdate.Value
+			valueJson, _ := jsoniter.Marshal(recordUpdate.Value)
+			tx.Set(zoneLocationRRSetKey(recordUpdate.ZoneName, recordUpdate.Location, recordUpdate.Type), string(valueJson))
 		} else {
 			tx.Del(zoneLocationRRSetKey(recordUpdate.ZoneName, recordUpdate.Location, recordUpdate.Type))
 		}
+		var err error
+		if tx, err = dh.journalRecordSet(tx, recordUpdate.ZoneName, recordUpdate.Location, recordUpdate.Type, value); err != nil {
+			return err
+		}
 	case database.DeleteRecord:
 		var recordDelete database.RecordSetDelete
 		if err := jsoniter.Unmarshal([]byte(event.Value), &recordDelete); err != nil {
@@ -774,6 +1030,15 @@ func (dh *DataHandler) ApplyEvent(event database.Event) error {
 		}
 		tx = dh.redis.Start()
 		tx.Del(zoneLocationRRSetKey(recordDelete.ZoneName, recordDelete.Location, recordDelete.Type))
+		var err error
+		if tx, err = dh.journalRecordSet(tx, recordDelete.ZoneName, recordDelete.Location, recordDelete.Type, nil); err != nil {
+			return err
+		}
+	case database.AddTSIGKey, database.UpdateTSIGKey, database.DeleteTSIGKey:
+		var err error
+		if tx, err = dh.applyTSIGEvent(event); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("invalid event type: %s", event.Type)
 	}
@@ -6,9 +6,11 @@ import (
 	. "github.com/onsi/gomega"
 	"net"
 	"sort"
+	"strconv"
 	"testing"
 	"time"
 	"z42-core/internal/api/database"
+	"z42-core/internal/dnssec"
 	"z42-core/pkg/hiredis"
 
 	"github.com/miekg/dns"
@@ -21,8 +23,10 @@ var dataHandlerDefaultTestConfig = DataHandlerConfig{
 	ZoneReload:         1,
 	RecordCacheSize:    1000000,
 	RecordCacheTimeout: 60,
+	SignatureCacheSize: 100000,
 	MinTTL:             5,
 	MaxTTL:             300,
+	JournalSize:        100,
 	Redis: hiredis.Config{
 		Suffix:  "_redistest",
 		Prefix:  "redistest_",
@@ -390,6 +394,50 @@ func TestSetZoneKey(t *testing.T) {
 	Expect(zone.Config.DnsSec).To(BeTrue())
 }
 
+func TestZoneKeys(t *testing.T) {
+	RegisterTestingT(t)
+	zoneName := "zone1.com."
+	dh := NewDataHandler(&dataHandlerDefaultTestConfig)
+	dh.Start()
+	err := dh.Clear()
+	Expect(err).To(BeNil())
+	err = dh.EnableZone(zoneName)
+	Expect(err).To(BeNil())
+	err = dh.SetZoneConfig(zoneName, &types.ZoneConfig{DnsSec: true})
+	Expect(err).To(BeNil())
+	err = dh.SetZoneKey(zoneName, "zsk", zone1ZskPub, zone1ZskPriv)
+	Expect(err).To(BeNil())
+	err = dh.SetZoneKey(zoneName, "ksk", zone1KskPub, zone1KskPriv)
+	Expect(err).To(BeNil())
+	keys, err := dh.ZoneKeys(zoneName)
+	Expect(err).To(BeNil())
+	Expect(keys).To(HaveLen(2))
+	Expect(keys[0].State).To(Equal(types.KeyStateActive))
+
+	var newKeys []types.StoredZoneKey
+	for i, state := range []string{types.KeyStateRetired, types.KeyStateActive, types.KeyStateActive, types.KeyStateActive} {
+		keyType, flags := "zsk", dnssec.ZSKFlags
+		if i > 1 {
+			keyType, flags = "ksk", dnssec.KSKFlags
+		}
+		pub, priv, err := dnssec.GenerateKey(zoneName, flags, nil)
+		Expect(err).To(BeNil())
+		newKeys = append(newKeys, types.StoredZoneKey{Type: keyType, Public: pub, Private: priv, State: state, Since: int64(i)})
+	}
+	err = dh.SetZoneKeys(zoneName, newKeys)
+	Expect(err).To(BeNil())
+	keys, err = dh.ZoneKeys(zoneName)
+	Expect(err).To(BeNil())
+	Expect(keys).To(Equal(newKeys))
+
+	zone := dh.GetZone(zoneName)
+	Expect(zone.Config.DnsSec).To(BeTrue())
+	Expect(zone.DnsKeys).To(HaveLen(4))
+	Expect(zone.DnsKeySigs).To(HaveLen(2))
+	Expect(zone.ZSK.Since).To(Equal(int64(1)))
+	Expect(zone.KSK.Since).To(Equal(int64(3)))
+}
+
 func TestLocationUpdate(t *testing.T) {
 	RegisterTestingT(t)
 	zoneName := "example.com."
@@ -556,7 +604,7 @@ func TestEvents(t *testing.T) {
 			Retry:        55,
 			Expire:       66,
 			MinTtl:       100,
-			Serial:       0,
+			Serial:       4,
 		},
 		DnsSec:          false,
 		CnameFlattening: false,
@@ -575,4 +623,96 @@ func TestEvents(t *testing.T) {
 		GenericRRSet: types.GenericRRSet{TtlValue: 300},
 		Data:         []types.IP_RR{{Ip: net.ParseIP("2.3.4.5")}},
 	}))
+	journal, err := dh.Journal("zone1.com.", 2, 4)
+	Expect(err).To(BeNil())
+	Expect(journal).To(Equal([]JournalEntry{
+		{Serial: 3, Deleted: []string{}, Added: []string{}},
+		{Serial: 4, Deleted: []string{}, Added: []string{"www.zone1.com.\t300\tIN\tA\t2.3.4.5"}},
+	}))
+	_, err = dh.Journal("zone1.com.", 0, 4)
+	Expect(err).To(Equal(ErrJournalGap))
+}
+
+func TestSerialAfterZoneUpdate(t *testing.T) {
+	RegisterTestingT(t)
+	dh := NewDataHandler(&dataHandlerDefaultTestConfig)
+	dh.Start()
+	Expect(dh.Clear()).To(BeNil())
+	zoneUpdate := func(revision int, serial int) {
+		err := dh.ApplyEvent(database.Event{
+			Revision: revision,
+			ZoneId:   "12345",
+			Type:     database.UpdateZone,
+			Value: `{
+				"name":"zone1.com.", "enabled":true, "dnssec":false, "cname_flattening":false,
+				"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.zone1.com.","ns":"ns1.zone1.com.","refresh":44,"retry":55,"expire":66,"serial":` + strconv.Itoa(serial) + `}
+			}`,
+		})
+		Expect(err).To(BeNil())
+	}
+	serial := func() uint32 {
+		config, err := dh.ReadZoneConfig("zone1.com.")
+		Expect(err).To(BeNil())
+		return config.SOA.Serial
+	}
+	err := dh.ApplyEvent(database.Event{
+		Revision: 1,
+		ZoneId:   "12345",
+		Type:     database.AddZone,
+		Value: `{
+			"name":"zone1.com.", "enabled":true, "dnssec":false, "cname_flattening":false,
+			"soa":{"ttl":300, "minttl":100, "mbox":"hostmaster.zone1.com.","ns":"ns1.zone1.com.","refresh":44,"retry":55,"expire":66,"serial":10},
+			"ns":{"ttl":300,"records":[{"host":"ns1.zone1.com."},{"host":"ns2.zone1.com."}]}
+		}`,
+	})
+	Expect(err).To(BeNil())
+	err = dh.ApplyEvent(database.Event{
+		Revision: 2,
+		ZoneId:   "12345",
+		Type:     database.AddRecord,
+		Value:    `{"zone_name":"zone1.com.", "location":"@", "enabled":true, "type":"a", "value":{"ttl":300, "records":[{"ip":"1.2.3.4"}]}}`,
+	})
+	Expect(err).To(BeNil())
+	err = dh.ApplyEvent(database.Event{
+		Revision: 3,
+		ZoneId:   "12345",
+		Type:     database.UpdateRecord,
+		Value:    `{"zone_name":"zone1.com.", "location":"@", "enabled":true, "type":"a", "value":{"ttl":300, "records":[{"ip":"2.3.4.5"}]}}`,
+	})
+	Expect(err).To(BeNil())
+	Expect(serial()).To(Equal(uint32(12)))
+
+	// serial sent by api is ignored for existing zones
+	zoneUpdate(4, 11)
+	Expect(serial()).To(Equal(uint32(13)))
+	zoneUpdate(5, 20)
+	Expect(serial()).To(Equal(uint32(14)))
+}
+
+func TestSignatureCache(t *testing.T) {
+	RegisterTestingT(t)
+	dh := NewDataHandler(&dataHandlerDefaultTestConfig)
+	key := parseZoneKey(zone1ZskPub, zone1ZskPriv)
+	Expect(key).NotTo(BeNil())
+	key.KeyInception, key.KeyExpiration = dnssec.SignatureWindow(time.Now(), nil)
+
+	a1, _ := dns.NewRR("www.zone1.com. 300 IN A 1.2.3.4")
+	a2, _ := dns.NewRR("www.zone1.com. 300 IN A 2.3.4.5")
+	first := dh.SignRRSet([]dns.RR{a1, a2}, "www.zone1.com.", key, 300)
+	Expect(first).NotTo(BeNil())
+	Expect(first.Verify(key.DnsKey, []dns.RR{a1, a2})).To(BeNil())
+	dh.signatureCache.Wait()
+
+	// ecdsa signatures are randomized, equal signatures mean the cached one is served
+	second := dh.SignRRSet([]dns.RR{a2, a1}, "www.zone1.com.", key, 300)
+	Expect(second.Signature).To(Equal(first.Signature))
+
+	other := dh.SignRRSet([]dns.RR{a1}, "www.zone1.com.", key, 300)
+	Expect(other.Signature).NotTo(Equal(first.Signature))
+	Expect(other.Verify(key.DnsKey, []dns.RR{a1})).To(BeNil())
+
+	key.KeyInception, key.KeyExpiration = dnssec.SignatureWindow(time.Now().Add(48*time.Hour), nil)
+	renewed := dh.SignRRSet([]dns.RR{a1, a2}, "www.zone1.com.", key, 300)
+	Expect(renewed.Signature).NotTo(Equal(first.Signature))
+	Expect(renewed.Inception).To(Equal(key.KeyInception))
 }
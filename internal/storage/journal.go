@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	redisCon "github.com/gomodule/redigo/redis"
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"strconv"
+	"z42-core/internal/types"
+	"z42-core/pkg/hiredis"
+)
+
+// JournalEntry holds the changes needed to move a zone from one serial to the next
+type JournalEntry struct {
+	Serial  uint32   `json:"serial"`
+	Deleted []string `json:"deleted"`
+	Added   []string `json:"added"`
+}
+
+var ErrJournalGap = errors.New("journal does not cover requested serial")
+
+func zoneJournalKey(zone string) string {
+	return keyPrefix + zone + ":journal"
+}
+
+func locationName(zone string, label string) string {
+	if label == "@" {
+		return zone
+	}
+	return label + "." + zone
+}
+
+func isTransferType(rtype uint16) bool {
+	for _, t := range types.TransferTypes {
+		if t == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	res := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		res = append(res, rr.String())
+	}
+	return res
+}
+
+// Journal returns journal entries needed to move a zone from serial to its current serial
+func (dh *DataHandler) Journal(zone string, serial uint32, current uint32) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for serial != current {
+		value, err := dh.redis.HGet(zoneJournalKey(zone), strconv.FormatUint(uint64(serial), 10))
+		if err == redisCon.ErrNil {
+			return nil, ErrJournalGap
+		} else if err != nil {
+			return nil, err
+		}
+		var entry JournalEntry
+		if err := jsoniter.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		serial = entry.Serial
+		if len(entries) > dh.config.JournalSize {
+			return nil, ErrJournalGap
+		}
+	}
+	return entries, nil
+}
+
+func (dh *DataHandler) currentRRs(zone string, label string, rtype string) ([]dns.RR, error) {
+	t := types.StringToType(rtype)
+	if !isTransferType(t) {
+		return nil, nil
+	}
+	enabled, err := dh.redis.SIsMember(zoneLocationsKey(zone), label)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	value, err := dh.redis.Get(zoneLocationRRSetKey(zone, label, rtype))
+	if err == redisCon.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rrset := types.TypeToRRSet(t)
+	if err := jsoniter.Unmarshal([]byte(value), rrset); err != nil {
+		return nil, err
+	}
+	return rrset.Value(locationName(zone, label)), nil
+}
+
+// journalRecordSet bumps zone serial and adds an entry for replacing a single rrset to zone journal,
+// a nil value means the rrset is removed
+func (dh *DataHandler) journalRecordSet(tx hiredis.Transaction, zone string, label string, rtype string, value types.RRSet) (hiredis.Transaction, error) {
+	deleted, err := dh.currentRRs(zone, label, rtype)
+	if err != nil {
+		return tx, err
+	}
+	entry := &JournalEntry{
+		Deleted: rrStrings(deleted),
+		Added:   []string{},
+	}
+	if value != nil && isTransferType(types.StringToType(rtype)) {
+		enabled, err := dh.redis.SIsMember(zoneLocationsKey(zone), label)
+		if err != nil {
+			return tx, err
+		}
+		if enabled {
+			entry.Added = rrStrings(value.Value(locationName(zone, label)))
+		}
+	}
+	return dh.bumpSerial(tx, zone, entry)
+}
+
+// bumpSerial increments zone serial and records entry in zone journal,
+// a nil entry (or a zero journal size) resets the journal so next incremental transfer falls back to full zone
+func (dh *DataHandler) bumpSerial(tx hiredis.Transaction, zone string, entry *JournalEntry) (hiredis.Transaction, error) {
+	configStr, err := dh.redis.Get(zoneConfigKey(zone))
+	if err == redisCon.ErrNil {
+		return tx, nil
+	} else if err != nil {
+		return tx, err
+	}
+	config := types.ZoneConfigFromJson(zone, configStr)
+	serial := config.SOA.Serial
+	config.SOA.Serial++
+	configJson, err := jsoniter.Marshal(config)
+	if err != nil {
+		return tx, err
+	}
+	tx = tx.Set(zoneConfigKey(zone), string(configJson))
+	if entry == nil || dh.config.JournalSize <= 0 {
+		return tx.Del(zoneJournalKey(zone)), nil
+	}
+	entry.Serial = config.SOA.Serial
+	entryJson, err := jsoniter.Marshal(entry)
+	if err != nil {
+		return tx, err
+	}
+	return tx.
+		HSet(zoneJournalKey(zone), strconv.FormatUint(uint64(serial), 10), string(entryJson)).
+		HDel(zoneJournalKey(zone), strconv.FormatUint(uint64(serial-uint32(dh.config.JournalSize)), 10)), nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	redisCon "github.com/gomodule/redigo/redis"
+	"github.com/json-iterator/go"
+	"z42-core/internal/types"
+)
+
+func zoneKeysKey(zone string) string {
+	return keyPrefix + zone + ":keys"
+}
+
+// ZoneKeys returns all keys of a zone with their rollover state,
+// zones without a key set use the single zsk/ksk pair as active keys
+func (dh *DataHandler) ZoneKeys(zone string) ([]types.StoredZoneKey, error) {
+	value, err := dh.redis.Get(zoneKeysKey(zone))
+	if err == redisCon.ErrNil {
+		return dh.legacyZoneKeys(zone)
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []types.StoredZoneKey
+	if err := jsoniter.Unmarshal([]byte(value), &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// SetZoneKeys replaces key set of a zone
+func (dh *DataHandler) SetZoneKeys(zone string, keys []types.StoredZoneKey) error {
+	value, err := jsoniter.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return dh.redis.Set(zoneKeysKey(zone), string(value))
+}
+
+func (dh *DataHandler) legacyZoneKeys(zone string) ([]types.StoredZoneKey, error) {
+	var keys []types.StoredZoneKey
+	for _, keyType := range []string{"zsk", "ksk"} {
+		pub, err := dh.redis.Get(zonePubKey(zone, keyType))
+		if err == redisCon.ErrNil {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		priv, err := dh.redis.Get(zonePrivKey(zone, keyType))
+		if err == redisCon.ErrNil {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, types.StoredZoneKey{
+			Type:    keyType,
+			Public:  pub,
+			Private: priv,
+			State:   types.KeyStateActive,
+		})
+	}
+	return keys, nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	redisCon "github.com/gomodule/redigo/redis"
+	"github.com/json-iterator/go"
+	"z42-core/internal/types"
+	"z42-core/pkg/hiredis"
+)
+
+const notifyKey = "z42:notify"
+
+// AddNotify queues a refresh request for a secondary zone
+func (dh *DataHandler) AddNotify(zone string) error {
+	return dh.redis.SAdd(notifyKey, zone)
+}
+
+// TakeNotifies returns and removes queued refresh requests
+func (dh *DataHandler) TakeNotifies() ([]string, error) {
+	zones, err := dh.redis.SMembers(notifyKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
+		if err := dh.redis.SRem(notifyKey, zone); err != nil {
+			return nil, err
+		}
+	}
+	return zones, nil
+}
+
+// ReplaceZoneData replaces all zone data with entries, used for zones maintained outside of event stream
+func (dh *DataHandler) ReplaceZoneData(zone string, soa *types.SOA_RRSet, entries map[string]map[string]types.RRSet) error {
+	keys, err := dh.redis.GetKeys(zoneLocationsWildcard(zone))
+	if err != nil {
+		return err
+	}
+	tx := dh.redis.Start()
+	for _, key := range keys {
+		parts := splitDbKey(key)
+		if !isRRSetEntry(parts) {
+			continue
+		}
+		if _, ok := entries[parts[2]][parts[3]]; !ok {
+			tx = tx.Del(key)
+		}
+	}
+	labels := make([]string, 0, len(entries))
+	for label := range entries {
+		labels = append(labels, label)
+	}
+	if tx, err = dh.setZoneData(tx, zone, soa, entries, labels); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateZoneData writes changed rrsets of a zone maintained outside of event stream,
+// a nil rrset removes that record type and labels replaces list of zone locations
+func (dh *DataHandler) UpdateZoneData(zone string, soa *types.SOA_RRSet, entries map[string]map[string]types.RRSet, labels []string) error {
+	tx, err := dh.setZoneData(dh.redis.Start(), zone, soa, entries, labels)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (dh *DataHandler) setZoneData(tx hiredis.Transaction, zone string, soa *types.SOA_RRSet, entries map[string]map[string]types.RRSet, labels []string) (hiredis.Transaction, error) {
+	configStr, err := dh.redis.Get(zoneConfigKey(zone))
+	if err != nil && err != redisCon.ErrNil {
+		return tx, err
+	}
+	config := types.ZoneConfigFromJson(zone, configStr)
+	config.SOA = soa
+	configJson, err := jsoniter.Marshal(config)
+	if err != nil {
+		return tx, err
+	}
+	tx = tx.
+		Set(zoneConfigKey(zone), string(configJson)).
+		Del(zoneJournalKey(zone)).
+		Del(zoneLocationsKey(zone))
+	for _, label := range labels {
+		tx = tx.SAdd(zoneLocationsKey(zone), label)
+	}
+	for label, location := range entries {
+		for rtype, rrset := range location {
+			key := zoneLocationRRSetKey(zone, label, rtype)
+			if rrset == nil || rrset.Empty() {
+				tx = tx.Del(key)
+				continue
+			}
+			value, err := jsoniter.Marshal(rrset)
+			if err != nil {
+				return tx, err
+			}
+			tx = tx.Set(key, string(value))
+		}
+	}
+	return tx, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"github.com/miekg/dns"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"z42-core/internal/dnssec"
+	"z42-core/internal/types"
+)
+
+// filtered answers of a single rrset (geo, weights) produce different contents, only a few are kept per key
+const maxSignatureVariants = 32
+
+type signatureSet struct {
+	sync.Mutex
+	signatures map[[sha256.Size]byte]*dns.RRSIG
+}
+
+func signatureKey(owner string, rtype uint16, keyTag uint16) string {
+	return strings.ToLower(owner) + ":" + strconv.Itoa(int(rtype)) + ":" + strconv.Itoa(int(keyTag))
+}
+
+// rrsetHash identifies rrset content independent of record order
+func rrsetHash(set []dns.RR, ttl uint32) [sha256.Size]byte {
+	records := make([]string, 0, len(set))
+	for _, rr := range set {
+		records = append(records, strings.TrimPrefix(rr.String(), rr.Header().String()))
+	}
+	sort.Strings(records)
+	return sha256.Sum256([]byte(strconv.Itoa(int(ttl)) + "\n" + strings.Join(records, "\n")))
+}
+
+// SignRRSet returns a cached signature of set if it was made in current validity window of key
+func (dh *DataHandler) SignRRSet(set []dns.RR, name string, key *types.ZoneKey, ttl uint32) *dns.RRSIG {
+	if len(set) == 0 {
+		return nil
+	}
+	cacheKey := signatureKey(name, set[0].Header().Rrtype, key.DnsKey.KeyTag())
+	hash := rrsetHash(set, ttl)
+	var sigs *signatureSet
+	cached, found := dh.signatureCache.Get(cacheKey)
+	if found {
+		sigs = cached.(*signatureSet)
+	} else {
+		sigs = &signatureSet{signatures: make(map[[sha256.Size]byte]*dns.RRSIG)}
+	}
+
+	sigs.Lock()
+	rrsig, ok := sigs.signatures[hash]
+	sigs.Unlock()
+	if ok && rrsig.Inception == key.KeyInception && rrsig.Expiration == key.KeyExpiration {
+		return dns.Copy(rrsig).(*dns.RRSIG)
+	}
+
+	rrsig = dnssec.SignRRSet(set, name, key, ttl)
+	if rrsig == nil {
+		return nil
+	}
+	sigs.Lock()
+	if len(sigs.signatures) >= maxSignatureVariants {
+		sigs.signatures = make(map[[sha256.Size]byte]*dns.RRSIG)
+	}
+	sigs.signatures[hash] = rrsig
+	sigs.Unlock()
+	if !found {
+		dh.signatureCache.Set(cacheKey, sigs, 1)
+	}
+	return dns.Copy(rrsig).(*dns.RRSIG)
+}
+
+// invalidateSignatures drops cached signatures of a changed rrset for all keys of its zone
+func (dh *DataHandler) invalidateSignatures(zone string, label string, rtype string) {
+	cached, found := dh.zoneCache.Get(zone)
+	if !found || cached == nil {
+		return
+	}
+	owner := zone
+	if label != "@" {
+		owner = label + "." + zone
+	}
+	for _, key := range cached.(*types.Zone).Keys {
+		dh.signatureCache.Del(signatureKey(owner, types.StringToType(rtype), key.DnsKey.KeyTag()))
+	}
+}
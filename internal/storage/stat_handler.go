@@ -2,6 +2,7 @@ package storage
 
 import (
 	"github.com/dgraph-io/ristretto"
+	redisCon "github.com/gomodule/redigo/redis"
 	"z42-core/internal/types"
 	"z42-core/pkg/hiredis"
 	jsoniter "github.com/json-iterator/go"
@@ -13,6 +14,8 @@ import (
 
 const (
 	cacheSize = 100000
+	// items that are not checked yet are looked up again after missTTL
+	missTTL = 10 * time.Second
 )
 
 type StatHandler struct {
@@ -41,7 +44,7 @@ func NewStatHandler(config *StatHandlerConfig) *StatHandler {
 			func() {
 			},
 			func(channel string, data string) {
-				key := strings.TrimLeft(channel, "z42:healthcheck:")
+				key := strings.TrimPrefix(channel, "z42:healthcheck:")
 				sh.cache.Del(key)
 			},
 			func(err error) {
@@ -72,7 +75,9 @@ func (sh *StatHandler) GetHealthcheckItem(key string) (*types.HealthCheckItem, e
 	item := new(types.HealthCheckItem)
 	itemStr, err := sh.redis.Get("z42:healthcheck:" + key)
 	if err != nil {
-		zap.L().Error("cannot load item", zap.String("key", key), zap.Error(err))
+		if err != redisCon.ErrNil {
+			zap.L().Error("cannot load item", zap.String("key", key), zap.Error(err))
+		}
 		return nil, err
 	}
 	jsoniter.Unmarshal([]byte(itemStr), item)
@@ -106,11 +111,13 @@ func (sh *StatHandler) GetHealthStatus(domain string, ip string) int {
 	val, found := sh.cache.Get(key)
 	if !found {
 		item, err = sh.GetHealthcheckItem(key)
-		if err != nil {
+		if err == redisCon.ErrNil {
+			// missing items are cached too, resolver asks for them on every query
+			sh.cache.SetWithTTL(key, new(types.HealthCheckItem), 1, missTTL)
 			return 0
 		}
-		if item == nil {
-			item = new(types.HealthCheckItem)
+		if err != nil {
+			return 0
 		}
 		sh.cache.Set(key, item, 1)
 	} else {
@@ -119,6 +126,69 @@ func (sh *StatHandler) GetHealthStatus(domain string, ip string) int {
 	return item.Status
 }
 
+// HealthcheckHost is the host health check items of a zone location are kept under, it is also
+// the name tls and dns checks use so apex is the zone name itself
+func HealthcheckHost(zone string, location string) string {
+	return locationName(zone, location)
+}
+
+// FilterHealthcheck blacks out ips that are less healthy than the healthiest ones, ips with a status
+// between down and up count are all kept unless one is up, if every ip is down all of them are kept
+func (sh *StatHandler) FilterHealthcheck(host string, rrset *types.IP_RRSet, mask []int) []int {
+	min := rrset.HealthCheckConfig.DownCount
+	for i, x := range mask {
+		if x == types.IpMaskWhite {
+			status := sh.GetHealthStatus(host, rrset.Data[i].Ip.String())
+			if status > min {
+				min = status
+			}
+		}
+	}
+	if min < rrset.HealthCheckConfig.UpCount-1 && min > rrset.HealthCheckConfig.DownCount {
+		min = rrset.HealthCheckConfig.DownCount + 1
+	}
+	for i, x := range mask {
+		if x == types.IpMaskWhite {
+			if sh.GetHealthStatus(host, rrset.Data[i].Ip.String()) < min {
+				mask[i] = types.IpMaskBlack
+			}
+		} else {
+			mask[i] = types.IpMaskBlack
+		}
+	}
+	return mask
+}
+
+// FilterFailover keeps healthy ips of lowest tier that has enough of them, an ip is healthy until it is down.
+// when no tier is healthy enough mask is kept as is for fail open rrsets and all ips are blacked out otherwise
+func (sh *StatHandler) FilterFailover(host string, rrset *types.IP_RRSet, mask []int) []int {
+	healthy := make(map[int]int)
+	status := make([]int, len(mask))
+	for i, x := range mask {
+		if x == types.IpMaskWhite {
+			status[i] = sh.GetHealthStatus(host, rrset.Data[i].Ip.String())
+			if status[i] > rrset.HealthCheckConfig.DownCount {
+				healthy[rrset.Data[i].Tier]++
+			}
+		}
+	}
+	tier, found := 0, false
+	for t, count := range healthy {
+		if count >= rrset.Failover.MinHealthy(t) && (!found || t < tier) {
+			tier, found = t, true
+		}
+	}
+	if !found && rrset.Failover.FailOpen {
+		return mask
+	}
+	for i, x := range mask {
+		if !found || x != types.IpMaskWhite || rrset.Data[i].Tier != tier || status[i] <= rrset.HealthCheckConfig.DownCount {
+			mask[i] = types.IpMaskBlack
+		}
+	}
+	return mask
+}
+
 func (sh *StatHandler) ShutDown() {
 	close(sh.quit)
 	sh.quitWG.Wait()
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	redisCon "github.com/gomodule/redigo/redis"
+	"github.com/json-iterator/go"
+	"strings"
+	"z42-core/internal/api/database"
+	"z42-core/pkg/hiredis"
+)
+
+const tsigIndexKey = "z42:tsig"
+
+func zoneTSIGKey(zone string) string {
+	return keyPrefix + zone + ":tsig"
+}
+
+// TSIGKey returns an enabled tsig key and the zone it belongs to, key names are unique across zones
+func (dh *DataHandler) TSIGKey(name string) (string, *database.TSIGKey, error) {
+	name = strings.ToLower(name)
+	zone, err := dh.redis.HGet(tsigIndexKey, name)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := dh.redis.HGet(zoneTSIGKey(zone), name)
+	if err != nil {
+		return "", nil, err
+	}
+	var key database.TSIGKey
+	if err := jsoniter.Unmarshal([]byte(value), &key); err != nil {
+		return "", nil, err
+	}
+	if !key.Enabled {
+		return "", nil, redisCon.ErrNil
+	}
+	return zone, &key, nil
+}
+
+func (dh *DataHandler) setTSIGKey(tx hiredis.Transaction, zone string, key database.TSIGKey) (hiredis.Transaction, error) {
+	key.Name = strings.ToLower(key.Name)
+	value, err := jsoniter.Marshal(key)
+	if err != nil {
+		return tx, err
+	}
+	return tx.
+		HSet(zoneTSIGKey(zone), key.Name, string(value)).
+		HSet(tsigIndexKey, key.Name, zone), nil
+}
+
+func (dh *DataHandler) applyTSIGEvent(event database.Event) (hiredis.Transaction, error) {
+	tx := dh.redis.Start()
+	switch event.Type {
+	case database.AddTSIGKey:
+		var newKey database.NewTSIGKey
+		if err := jsoniter.Unmarshal([]byte(event.Value), &newKey); err != nil {
+			return tx, err
+		}
+		return dh.setTSIGKey(tx, newKey.ZoneName, database.TSIGKey{
+			Name:      newKey.Name,
+			Algorithm: newKey.Algorithm,
+			Secret:    newKey.Secret,
+			Enabled:   newKey.Enabled,
+		})
+	case database.UpdateTSIGKey:
+		var keyUpdate database.TSIGKeyUpdate
+		if err := jsoniter.Unmarshal([]byte(event.Value), &keyUpdate); err != nil {
+			return tx, err
+		}
+		value, err := dh.redis.HGet(zoneTSIGKey(keyUpdate.ZoneName), strings.ToLower(keyUpdate.Name))
+		if err == redisCon.ErrNil {
+			return tx, nil
+		} else if err != nil {
+			return tx, err
+		}
+		var key database.TSIGKey
+		if err := jsoniter.Unmarshal([]byte(value), &key); err != nil {
+			return tx, err
+		}
+		key.Enabled = keyUpdate.Enabled
+		return dh.setTSIGKey(tx, keyUpdate.ZoneName, key)
+	default:
+		var keyDelete database.TSIGKeyDelete
+		if err := jsoniter.Unmarshal([]byte(event.Value), &keyDelete); err != nil {
+			return tx, err
+		}
+		name := strings.ToLower(keyDelete.Name)
+		return tx.
+			HDel(zoneTSIGKey(keyDelete.ZoneName), name).
+			HDel(tsigIndexKey, name), nil
+	}
+}
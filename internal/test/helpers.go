@@ -85,6 +85,15 @@ func TXT(rr string) *dns.TXT { r, _ := dns.NewRR(rr); return r.(*dns.TXT) }
 // HINFO returns a HINFO record from rr. It panics on errors.
 func HINFO(rr string) *dns.HINFO { r, _ := dns.NewRR(rr); return r.(*dns.HINFO) }
 
+// SVCB returns a SVCB record from rr. It panics on errors.
+func SVCB(rr string) *dns.SVCB { r, _ := dns.NewRR(rr); return r.(*dns.SVCB) }
+
+// HTTPS returns a HTTPS record from rr. It panics on errors.
+func HTTPS(rr string) *dns.HTTPS { r, _ := dns.NewRR(rr); return r.(*dns.HTTPS) }
+
+// RR returns a record of any type from rr. It panics on errors.
+func RR(rr string) dns.RR { r, _ := dns.NewRR(rr); return r }
+
 // MX returns an MX record from rr. It panics on errors.
 func MX(rr string) *dns.MX { r, _ := dns.NewRR(rr); return r.(*dns.MX) }
 
@@ -94,6 +103,12 @@ func RRSIG(rr string) *dns.RRSIG { r, _ := dns.NewRR(rr); return r.(*dns.RRSIG)
 // NSEC returns an NSEC record from rr. It panics on errors.
 func NSEC(rr string) *dns.NSEC { r, _ := dns.NewRR(rr); return r.(*dns.NSEC) }
 
+// NSEC3 returns an NSEC3 record from rr. It panics on errors.
+func NSEC3(rr string) *dns.NSEC3 { r, _ := dns.NewRR(rr); return r.(*dns.NSEC3) }
+
+// NSEC3PARAM returns an NSEC3PARAM record from rr. It panics on errors.
+func NSEC3PARAM(rr string) *dns.NSEC3PARAM { r, _ := dns.NewRR(rr); return r.(*dns.NSEC3PARAM) }
+
 // DNSKEY returns a DNSKEY record from rr. It panics on errors.
 func DNSKEY(rr string) *dns.DNSKEY { r, _ := dns.NewRR(rr); return r.(*dns.DNSKEY) }
 
@@ -193,6 +208,22 @@ func Section(tc Case, sec sect, rr []dns.RR) error {
 				return fmt.Errorf("RR %d should have a NextDomain of %s, but has %s", i, section[i].(*dns.NSEC).NextDomain, x.NextDomain)
 			}
 			// TypeBitMap
+		case *dns.NSEC3:
+			tt := section[i].(*dns.NSEC3)
+			if x.NextDomain != tt.NextDomain {
+				return fmt.Errorf("RR %d should have a NextDomain of %s, but has %s", i, tt.NextDomain, x.NextDomain)
+			}
+			if x.Flags != tt.Flags {
+				return fmt.Errorf("RR %d should have Flags of %d, but has %d", i, tt.Flags, x.Flags)
+			}
+			if x.Salt != tt.Salt || x.Iterations != tt.Iterations {
+				return fmt.Errorf("RR %d should have salt %s and %d iterations, but has %s and %d", i, tt.Salt, tt.Iterations, x.Salt, x.Iterations)
+			}
+		case *dns.NSEC3PARAM:
+			tt := section[i].(*dns.NSEC3PARAM)
+			if x.Salt != tt.Salt || x.Iterations != tt.Iterations || x.Hash != tt.Hash {
+				return fmt.Errorf("RR %d should be %s, but is %s", i, tt.String(), x.String())
+			}
 		case *dns.A:
 			if x.A.String() != section[i].(*dns.A).A.String() {
 				return fmt.Errorf("RR %d should have a Address of %q, but has %q", i, section[i].(*dns.A).A.String(), x.A.String())
@@ -207,6 +238,10 @@ func Section(tc Case, sec sect, rr []dns.RR) error {
 					return fmt.Errorf("RR %d should have a Txt of %q, but has %q", i, section[i].(*dns.TXT).Txt[j], txt)
 				}
 			}
+		case *dns.SVCB, *dns.HTTPS:
+			if x.String() != section[i].String() {
+				return fmt.Errorf("RR %d should be %s, but is %s", i, section[i].String(), x.String())
+			}
 		case *dns.HINFO:
 			if x.Cpu != section[i].(*dns.HINFO).Cpu {
 				return fmt.Errorf("RR %d should have a Cpu of %s, but has %s", i, section[i].(*dns.HINFO).Cpu, x.Cpu)
@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"errors"
 	"fmt"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/miekg/dns"
 	"math/rand"
 	"net"
@@ -22,11 +23,35 @@ const (
 	TypeANAME = 500
 )
 
+// GenericTypes is allow-list of types stored as Raw_RRSet, they are served as is without any type specific processing
+var GenericTypes = []uint16{
+	dns.TypeHINFO,
+	dns.TypeLOC,
+	dns.TypeNAPTR,
+	dns.TypeCERT,
+	dns.TypeSSHFP,
+	dns.TypeOPENPGPKEY,
+	dns.TypeURI,
+}
+
+func IsGeneric(t uint16) bool {
+	for _, generic := range GenericTypes {
+		if t == generic {
+			return true
+		}
+	}
+	return false
+}
+
 func IsSupported(t uint16) bool {
+	if IsGeneric(t) {
+		return true
+	}
 	switch t {
 	case dns.TypeA,
 		dns.TypeAAAA,
 		dns.TypeCNAME,
+		dns.TypeDNAME,
 		dns.TypeTXT,
 		dns.TypeNS,
 		dns.TypeMX,
@@ -35,6 +60,8 @@ func IsSupported(t uint16) bool {
 		dns.TypePTR,
 		dns.TypeTLSA,
 		dns.TypeDS,
+		dns.TypeSVCB,
+		dns.TypeHTTPS,
 		TypeANAME,
 		dns.TypeSOA:
 		return true
@@ -43,6 +70,25 @@ func IsSupported(t uint16) bool {
 	}
 }
 
+// TransferTypes lists rrset types included in zone transfers. ANAME is resolved
+// at query time and SOA is generated from zone config so both are left out.
+var TransferTypes = append([]uint16{
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeDNAME,
+	dns.TypeTXT,
+	dns.TypeNS,
+	dns.TypeMX,
+	dns.TypeSRV,
+	dns.TypeCAA,
+	dns.TypePTR,
+	dns.TypeTLSA,
+	dns.TypeDS,
+	dns.TypeSVCB,
+	dns.TypeHTTPS,
+}, GenericTypes...)
+
 func TypeToRRSet(t uint16) RRSet {
 	switch t {
 	case dns.TypeA:
@@ -51,6 +97,8 @@ func TypeToRRSet(t uint16) RRSet {
 		return &IP_RRSet{Data: []IP_RR{}}
 	case dns.TypeCNAME:
 		return &CNAME_RRSet{}
+	case dns.TypeDNAME:
+		return &DNAME_RRSet{}
 	case dns.TypeTXT:
 		return &TXT_RRSet{Data: []TXT_RR{}}
 	case dns.TypeNS:
@@ -67,11 +115,18 @@ func TypeToRRSet(t uint16) RRSet {
 		return &TLSA_RRSet{Data: []TLSA_RR{}}
 	case dns.TypeDS:
 		return &DS_RRSet{Data: []DS_RR{}}
+	case dns.TypeSVCB:
+		return &SVCB_RRSet{Data: []SVCB_RR{}}
+	case dns.TypeHTTPS:
+		return &HTTPS_RRSet{SVCB_RRSet{Data: []SVCB_RR{}}}
 	case dns.TypeSOA:
 		return &SOA_RRSet{}
 	case TypeANAME:
 		return &ANAME_RRSet{}
 	default:
+		if IsGeneric(t) {
+			return &Raw_RRSet{Type: t, Data: []Raw_RR{}}
+		}
 		return nil
 	}
 }
@@ -135,6 +190,8 @@ type ZoneKey struct {
 	PrivateKey    crypto.PrivateKey
 	KeyInception  uint32
 	KeyExpiration uint32
+	State         string
+	Since         int64
 }
 
 type IP_RR struct {
@@ -142,16 +199,23 @@ type IP_RR struct {
 	Ip      net.IP   `json:"ip"`
 	Country []string `json:"country,omitempty"`
 	ASN     []uint   `json:"asn,omitempty"`
+	Tier    int      `json:"tier,omitempty"`
 }
 
 type IpHealthCheckConfig struct {
-	Protocol  string `json:"protocol,omitempty"`
-	Uri       string `json:"uri,omitempty"`
-	Port      int    `json:"port,omitempty"`
-	Timeout   int    `json:"timeout,omitempty"`
-	UpCount   int    `json:"up_count,omitempty"`
-	DownCount int    `json:"down_count,omitempty"`
-	Enable    bool   `json:"enable,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Uri        string `json:"uri,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	Timeout    int    `json:"timeout,omitempty"`
+	UpCount    int    `json:"up_count,omitempty"`
+	DownCount  int    `json:"down_count,omitempty"`
+	Enable     bool   `json:"enable,omitempty"`
+	Query      string `json:"query,omitempty"`
+	QueryType  string `json:"query_type,omitempty"`
+	Rcode      string `json:"rcode,omitempty"`
+	Answer     string `json:"answer,omitempty"`
+	ExpiryDays int    `json:"expiry_days,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
 }
 
 type IpFilterConfig struct {
@@ -160,13 +224,45 @@ type IpFilterConfig struct {
 	GeoFilter string `json:"geo_filter,omitempty"` // "country", "location", "asn", "asn+country", "none"
 }
 
+// IpFailoverConfig orders ips in tiers by their tier number, lowest tier is active and others are backups.
+// a tier is served while it has enough healthy ips, if no tier has them fail open serves active tier
+// regardless of health and fail closed serves nothing
+type IpFailoverConfig struct {
+	Tiers    []IpTierConfig `json:"tiers,omitempty"`
+	FailOpen bool           `json:"fail_open,omitempty"`
+}
+
+// IpTierConfig sets number of healthy ips a tier needs to be served, defaults to 1
+type IpTierConfig struct {
+	MinHealthy int `json:"min_healthy,omitempty"`
+}
+
+// MinHealthy returns number of healthy ips tier needs to be served
+func (config *IpFailoverConfig) MinHealthy(tier int) int {
+	if tier >= 0 && tier < len(config.Tiers) && config.Tiers[tier].MinHealthy > 0 {
+		return config.Tiers[tier].MinHealthy
+	}
+	return 1
+}
+
 type IP_RRSet struct {
 	GenericRRSet
 	FilterConfig      IpFilterConfig      `json:"filter,omitempty"`
 	HealthCheckConfig IpHealthCheckConfig `json:"health_check,omitempty"`
+	Failover          IpFailoverConfig    `json:"failover,omitempty"`
 	Data              []IP_RR             `json:"records"`
 }
 
+// HasTiers reports whether some ips are backups
+func (rrset *IP_RRSet) HasTiers() bool {
+	for _, r := range rrset.Data {
+		if r.Tier != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (rrset *IP_RRSet) Value(name string) []dns.RR {
 	var res []dns.RR
 	for _, record := range rrset.Data {
@@ -238,6 +334,36 @@ func (rrset *CNAME_RRSet) Parse(r dns.RR) error {
 	return nil
 }
 
+// DNAME_RRSet redirects names below owner to same names below target, owner itself is not redirected
+type DNAME_RRSet struct {
+	GenericRRSet
+	Target string `json:"target"`
+}
+
+func (rrset *DNAME_RRSet) Value(name string) []dns.RR {
+	if len(rrset.Target) == 0 {
+		return []dns.RR{}
+	}
+	r := new(dns.DNAME)
+	r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeDNAME,
+		Class: dns.ClassINET, Ttl: rrset.TtlValue}
+	r.Target = dns.Fqdn(rrset.Target)
+	return []dns.RR{r}
+}
+
+func (rrset *DNAME_RRSet) Empty() bool {
+	return len(rrset.Target) == 0
+}
+
+func (rrset *DNAME_RRSet) Parse(r dns.RR) error {
+	if r.Header().Rrtype != dns.TypeDNAME {
+		return errInvalidType
+	}
+	rrset.TtlValue = r.Header().Ttl
+	rrset.Target = r.(*dns.DNAME).Target
+	return nil
+}
+
 type TXT_RR struct {
 	Text string `json:"text"`
 }
@@ -590,6 +716,234 @@ func (rrset *DS_RRSet) Parse(r dns.RR) error {
 	return nil
 }
 
+// SVCB_RR holds a service binding, priority 0 is alias mode where target is an alias for owner name
+// and params are not allowed. target "." stands for owner name in service mode
+type SVCB_RR struct {
+	Priority      uint16   `json:"priority"`
+	Target        string   `json:"target"`
+	Mandatory     []string `json:"mandatory,omitempty"`
+	Alpn          []string `json:"alpn,omitempty"`
+	NoDefaultAlpn bool     `json:"no_default_alpn,omitempty"`
+	Port          uint16   `json:"port,omitempty"`
+	IPv4Hint      []net.IP `json:"ipv4hint,omitempty"`
+	ECH           []byte   `json:"ech,omitempty"`
+	IPv6Hint      []net.IP `json:"ipv6hint,omitempty"`
+	DoHPath       string   `json:"dohpath,omitempty"`
+}
+
+type SVCB_RRSet struct {
+	GenericRRSet
+	Data []SVCB_RR `json:"records"`
+}
+
+func (rrset *SVCB_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, svcb := range rrset.Data {
+		r := new(dns.SVCB)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSVCB,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		svcb.fill(r)
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *SVCB_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+func (rrset *SVCB_RRSet) Parse(r dns.RR) error {
+	if r.Header().Rrtype != dns.TypeSVCB {
+		return errInvalidType
+	}
+	return rrset.parse(r.Header().Ttl, r.(*dns.SVCB))
+}
+
+func (rrset *SVCB_RRSet) parse(ttl uint32, svcb *dns.SVCB) error {
+	rr := SVCB_RR{
+		Priority: svcb.Priority,
+		Target:   svcb.Target,
+	}
+	for _, kv := range svcb.Value {
+		switch v := kv.(type) {
+		case *dns.SVCBMandatory:
+			for _, key := range v.Code {
+				rr.Mandatory = append(rr.Mandatory, key.String())
+			}
+		case *dns.SVCBAlpn:
+			rr.Alpn = v.Alpn
+		case *dns.SVCBNoDefaultAlpn:
+			rr.NoDefaultAlpn = true
+		case *dns.SVCBPort:
+			rr.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			rr.IPv4Hint = v.Hint
+		case *dns.SVCBECHConfig:
+			rr.ECH = v.ECH
+		case *dns.SVCBIPv6Hint:
+			rr.IPv6Hint = v.Hint
+		case *dns.SVCBDoHPath:
+			rr.DoHPath = v.Template
+		default:
+			return fmt.Errorf("unsupported svcb parameter: %s", kv.Key())
+		}
+	}
+	if len(rrset.Data) == 0 {
+		rrset.TtlValue = ttl
+	}
+	rrset.Data = append(rrset.Data, rr)
+	return nil
+}
+
+// fill sets rdata of r, params are added in key order as required on the wire
+func (svcb *SVCB_RR) fill(r *dns.SVCB) {
+	r.Priority = svcb.Priority
+	r.Target = dns.Fqdn(svcb.Target)
+	if svcb.Priority == 0 {
+		return
+	}
+	if len(svcb.Mandatory) > 0 {
+		mandatory := &dns.SVCBMandatory{}
+		for _, name := range svcb.Mandatory {
+			if key, ok := svcbKey(name); ok {
+				mandatory.Code = append(mandatory.Code, key)
+			}
+		}
+		r.Value = append(r.Value, mandatory)
+	}
+	if len(svcb.Alpn) > 0 {
+		r.Value = append(r.Value, &dns.SVCBAlpn{Alpn: svcb.Alpn})
+	}
+	if svcb.NoDefaultAlpn {
+		r.Value = append(r.Value, &dns.SVCBNoDefaultAlpn{})
+	}
+	if svcb.Port != 0 {
+		r.Value = append(r.Value, &dns.SVCBPort{Port: svcb.Port})
+	}
+	if len(svcb.IPv4Hint) > 0 {
+		r.Value = append(r.Value, &dns.SVCBIPv4Hint{Hint: svcb.IPv4Hint})
+	}
+	if len(svcb.ECH) > 0 {
+		r.Value = append(r.Value, &dns.SVCBECHConfig{ECH: svcb.ECH})
+	}
+	if len(svcb.IPv6Hint) > 0 {
+		r.Value = append(r.Value, &dns.SVCBIPv6Hint{Hint: svcb.IPv6Hint})
+	}
+	if svcb.DoHPath != "" {
+		r.Value = append(r.Value, &dns.SVCBDoHPath{Template: svcb.DoHPath})
+	}
+}
+
+func svcbKey(name string) (dns.SVCBKey, bool) {
+	for key := dns.SVCB_MANDATORY; key <= dns.SVCB_DOHPATH; key++ {
+		if key.String() == name {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// HTTPS_RRSet has the same data as SVCB_RRSet, only record type differs
+type HTTPS_RRSet struct {
+	SVCB_RRSet
+}
+
+func (rrset *HTTPS_RRSet) Value(name string) []dns.RR {
+	var res []dns.RR
+	for _, svcb := range rrset.Data {
+		r := new(dns.HTTPS)
+		r.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeHTTPS,
+			Class: dns.ClassINET, Ttl: rrset.TtlValue}
+		svcb.fill(&r.SVCB)
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *HTTPS_RRSet) Parse(r dns.RR) error {
+	if r.Header().Rrtype != dns.TypeHTTPS {
+		return errInvalidType
+	}
+	return rrset.parse(r.Header().Ttl, &r.(*dns.HTTPS).SVCB)
+}
+
+// Raw_RR holds rdata in presentation format or in rfc3597 generic format like "\# 4 0a000001"
+type Raw_RR struct {
+	Data string `json:"data"`
+}
+
+// Raw_RRSet stores records of any type in GenericTypes, records are parsed once when rrset is loaded
+type Raw_RRSet struct {
+	GenericRRSet
+	Type    uint16   `json:"-"`
+	Data    []Raw_RR `json:"records"`
+	records []dns.RR
+}
+
+func (rrset *Raw_RRSet) UnmarshalJSON(data []byte) error {
+	var value struct {
+		GenericRRSet
+		Data []Raw_RR `json:"records"`
+	}
+	if err := jsoniter.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	rrset.GenericRRSet = value.GenericRRSet
+	rrset.Data = value.Data
+	records, err := rrset.parseData()
+	if err != nil {
+		return err
+	}
+	rrset.records = records
+	return nil
+}
+
+func (rrset *Raw_RRSet) parseData() ([]dns.RR, error) {
+	var records []dns.RR
+	for _, raw := range rrset.Data {
+		rr, err := dns.NewRR(". 0 IN " + dns.Type(rrset.Type).String() + " " + raw.Data)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil || rr.Header().Rrtype != rrset.Type {
+			return nil, fmt.Errorf("invalid %s data: %s", dns.Type(rrset.Type).String(), raw.Data)
+		}
+		records = append(records, rr)
+	}
+	return records, nil
+}
+
+func (rrset *Raw_RRSet) Value(name string) []dns.RR {
+	records := rrset.records
+	if len(records) != len(rrset.Data) {
+		records, _ = rrset.parseData()
+	}
+	var res []dns.RR
+	for _, record := range records {
+		r := dns.Copy(record)
+		r.Header().Name = name
+		r.Header().Ttl = rrset.TtlValue
+		res = append(res, r)
+	}
+	return res
+}
+
+func (rrset *Raw_RRSet) Empty() bool {
+	return len(rrset.Data) == 0
+}
+
+func (rrset *Raw_RRSet) Parse(r dns.RR) error {
+	if r.Header().Rrtype != rrset.Type {
+		return errInvalidType
+	}
+	if len(rrset.Data) == 0 {
+		rrset.TtlValue = r.Header().Ttl
+	}
+	rrset.Data = append(rrset.Data, Raw_RR{Data: strings.TrimPrefix(r.String(), r.Header().String())})
+	rrset.records = append(rrset.records, dns.Copy(r))
+	return nil
+}
+
 func DefaultSOA(zoneName string) *SOA_RRSet {
 	serialStr := time.Now().Format("20060102") + "00"
 	serial, _ := strconv.Atoi(serialStr)
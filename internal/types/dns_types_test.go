@@ -0,0 +1,64 @@
+package types
+
+import (
+	"github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"testing"
+)
+
+func TestSVCB(t *testing.T) {
+	RegisterTestingT(t)
+	rrset := TypeToRRSet(dns.TypeHTTPS)
+	err := jsoniter.Unmarshal([]byte(`{"ttl":300, "records":[
+		{"priority":1, "target":".", "alpn":["h2","h3"], "port":8443, "ipv4hint":["1.2.3.4"], "ech":"AEX+DQBB", "mandatory":["alpn"]},
+		{"priority":0, "target":"svc.example.com."}
+	]}`), rrset)
+	Expect(err).To(BeNil())
+	records := rrset.Value("example.com.")
+	Expect(records).To(HaveLen(2))
+	Expect(records[0].String()).To(Equal(`example.com.	300	IN	HTTPS	1 . mandatory="alpn" alpn="h2,h3" port="8443" ipv4hint="1.2.3.4" ech="AEX+DQBB"`))
+	// alias mode records carry no params
+	Expect(records[1].String()).To(Equal("example.com.\t300\tIN\tHTTPS\t0 svc.example.com."))
+	for _, rr := range records {
+		_, err = dns.PackRR(rr, make([]byte, 512), 0, nil, false)
+		Expect(err).To(BeNil())
+	}
+
+	parsed := TypeToRRSet(dns.TypeHTTPS)
+	for _, rr := range records {
+		Expect(parsed.Parse(rr)).To(BeNil())
+	}
+	Expect(parsed).To(Equal(rrset))
+	Expect(TypeToRRSet(dns.TypeSVCB).Parse(records[0])).To(Equal(errInvalidType))
+
+	rr, err := dns.NewRR(`_dns.example.com. 300 IN SVCB 1 dns.example.com. alpn=dot key65000=foo`)
+	Expect(err).To(BeNil())
+	Expect(TypeToRRSet(dns.TypeSVCB).Parse(rr)).NotTo(BeNil())
+}
+
+func TestRawRRSet(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(TypeToRRSet(dns.TypeAFSDB)).To(BeNil())
+	Expect(IsSupported(dns.TypeNAPTR)).To(BeTrue())
+
+	rrset := TypeStrToRRSet("sshfp")
+	err := jsoniter.Unmarshal([]byte(`{"ttl":300, "records":[{"data":"1 1 dc3b6a3c4f0e5f7e"},{"data":"\\# 4 01020304"}]}`), rrset)
+	Expect(err).To(BeNil())
+	records := rrset.Value("host.example.com.")
+	Expect(records).To(HaveLen(2))
+	Expect(records[0].String()).To(Equal("host.example.com.\t300\tIN\tSSHFP\t1 1 DC3B6A3C4F0E5F7E"))
+	Expect(records[1].String()).To(Equal("host.example.com.\t300\tIN\tSSHFP\t1 2 0304"))
+
+	// records parsed from zone files keep their presentation format
+	parsed := TypeToRRSet(dns.TypeSSHFP)
+	for _, rr := range records {
+		Expect(parsed.Parse(rr)).To(BeNil())
+	}
+	Expect(parsed.(*Raw_RRSet).Data).To(Equal([]Raw_RR{{Data: "1 1 DC3B6A3C4F0E5F7E"}, {Data: "1 2 0304"}}))
+	Expect(parsed.Value("host.example.com.")).To(Equal(records))
+	Expect(TypeToRRSet(dns.TypeNAPTR).Parse(records[0])).To(Equal(errInvalidType))
+
+	err = jsoniter.Unmarshal([]byte(`{"ttl":300, "records":[{"data":"not a naptr"}]}`), TypeToRRSet(dns.TypeNAPTR))
+	Expect(err).NotTo(BeNil())
+}
@@ -2,10 +2,12 @@ package types
 
 import (
 	"bytes"
+	"fmt"
 	iradix "github.com/hashicorp/go-immutable-radix"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
+	"net"
 	"strings"
 	"time"
 )
@@ -17,15 +19,132 @@ type Zone struct {
 	LocationsList []string
 	ZSK           *ZoneKey
 	KSK           *ZoneKey
-	DnsKeySig     dns.RR
+	Keys          []*ZoneKey
+	DnsKeys       []dns.RR
+	DnsKeySigs    []dns.RR
 	CacheTimeout  int64
 }
 
 type ZoneConfig struct {
-	DomainId        string     `json:"domain_id,omitempty"`
-	SOA             *SOA_RRSet `json:"soa,omitempty"`
-	DnsSec          bool       `json:"dnssec,omitempty"`
-	CnameFlattening bool       `json:"cname_flattening,omitempty"`
+	DomainId           string              `json:"domain_id,omitempty"`
+	SOA                *SOA_RRSet          `json:"soa,omitempty"`
+	DnsSec             bool                `json:"dnssec,omitempty"`
+	CnameFlattening    bool                `json:"cname_flattening,omitempty"`
+	AllowTransfer      []string            `json:"allow_transfer,omitempty"`
+	Primaries          []string            `json:"primaries,omitempty"`
+	AlsoNotify         []string            `json:"also_notify,omitempty"`
+	NSEC3              *NSEC3Config        `json:"nsec3,omitempty"`
+	CDSDelete          bool                `json:"cds_delete,omitempty"`
+	KeyAlgorithm       *KeyAlgorithmConfig `json:"key_algorithm,omitempty"`
+	Signature          *SignatureConfig    `json:"signature,omitempty"`
+	IgnoreClientSubnet bool                `json:"ignore_client_subnet,omitempty"`
+	Views              []ViewConfig        `json:"views,omitempty"`
+}
+
+// ViewConfig selects a split horizon view of zone, a view matches if client source address, ecs address or
+// listener address the request was received on is in one of its lists. entries are networks or single addresses,
+// listeners are ip:port, :port or ip
+type ViewConfig struct {
+	Name          string   `json:"name"`
+	Sources       []string `json:"sources,omitempty"`
+	ClientSubnets []string `json:"client_subnets,omitempty"`
+	Listeners     []string `json:"listeners,omitempty"`
+}
+
+// SelectView returns name of first view matching request, an empty name is the default view
+func (config *ZoneConfig) SelectView(source net.IP, subnet net.IP, listener net.Addr) string {
+	for _, view := range config.Views {
+		if view.Match(source, subnet, listener) {
+			return view.Name
+		}
+	}
+	return ""
+}
+
+func (view *ViewConfig) Match(source net.IP, subnet net.IP, listener net.Addr) bool {
+	if source != nil && NetworksContain(view.Sources, source) {
+		return true
+	}
+	if subnet != nil && NetworksContain(view.ClientSubnets, subnet) {
+		return true
+	}
+	if listener == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(listener.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, entry := range view.Listeners {
+		h, p, err := net.SplitHostPort(entry)
+		if err != nil {
+			h, p = entry, ""
+		}
+		if (h == "" || ip.Equal(net.ParseIP(h))) && (p == "" || p == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasClientSubnets reports whether views depend on ecs address, answers are then only valid for client subnet
+func (config *ZoneConfig) HasClientSubnets() bool {
+	for _, view := range config.Views {
+		if len(view.ClientSubnets) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetwork parses an address or a network in cidr notation, an address is a network of its own
+func ParseNetwork(entry string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address: %s", entry)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// NetworksContain reports whether ip is one of addresses or networks in entries, invalid entries are skipped
+func NetworksContain(entries []string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, entry := range entries {
+		if network, err := ParseNetwork(entry); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureConfig sets rrsig validity and how often signatures are regenerated, in seconds
+type SignatureConfig struct {
+	Validity int `json:"validity"`
+	Refresh  int `json:"refresh"`
+}
+
+// KeyAlgorithmConfig selects signing algorithm of zone keys, bits is only used by rsa
+type KeyAlgorithmConfig struct {
+	Algorithm string `json:"algorithm"`
+	Bits      int    `json:"bits,omitempty"`
+}
+
+// NSEC3Config enables hashed denial of existence (rfc5155) instead of nsec
+type NSEC3Config struct {
+	Algorithm  uint8  `json:"algorithm"`
+	Iterations uint16 `json:"iterations"`
+	Salt       string `json:"salt,omitempty"`
+	OptOut     bool   `json:"opt_out,omitempty"`
 }
 
 type ZoneKeys struct {
@@ -36,6 +155,35 @@ type ZoneKeys struct {
 	DS         string
 }
 
+// dnssec key lifecycle states, active keys are published and sign, published and retired keys are only
+// published and signing keys sign without being published (used by algorithm rollovers)
+const (
+	KeyStatePublished = "published"
+	KeyStateActive    = "active"
+	KeyStateRetired   = "retired"
+	KeyStateSigning   = "signing"
+)
+
+// KeySigns reports whether keys in state sign zone data
+func KeySigns(state string) bool {
+	return state == KeyStateActive || state == KeyStateSigning
+}
+
+// KeyPublished reports whether keys in state are part of dnskey rrset
+func KeyPublished(state string) bool {
+	return state != KeyStateSigning
+}
+
+// StoredZoneKey is a zone key pair with its rollover state, since is unix time of last state change
+type StoredZoneKey struct {
+	Type      string `json:"type"`
+	Public    string `json:"public"`
+	Private   string `json:"private"`
+	State     string `json:"state"`
+	Since     int64  `json:"since"`
+	Algorithm uint8  `json:"algorithm,omitempty"`
+}
+
 func ZoneConfigFromJson(zone string, configStr string) *ZoneConfig {
 	config := &ZoneConfig{
 		DnsSec:          false,
@@ -72,6 +220,11 @@ func ZoneConfigFromJson(zone string, configStr string) *ZoneConfig {
 	return config
 }
 
+// SerialLess compares zone serial numbers using rfc1982 arithmetic
+func SerialLess(a uint32, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
+
 func ReverseName(zone string) []byte {
 	runes := []rune("." + zone)
 	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
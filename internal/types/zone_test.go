@@ -2,6 +2,7 @@ package types
 
 import (
 	. "github.com/onsi/gomega"
+	"net"
 	"testing"
 )
 
@@ -77,3 +78,60 @@ func TestZone_FindLocation(t *testing.T) {
 	Expect(label).To(Equal(""))
 	Expect(matchType).To(Equal(NoMatch))
 }
+
+func TestSerialLess(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(SerialLess(1, 2)).To(BeTrue())
+	Expect(SerialLess(2, 2)).To(BeFalse())
+	Expect(SerialLess(2, 1)).To(BeFalse())
+	Expect(SerialLess(0xffffffff, 1)).To(BeTrue())
+	Expect(SerialLess(1, 0xffffffff)).To(BeFalse())
+}
+
+func TestZoneConfig_SelectView(t *testing.T) {
+	RegisterTestingT(t)
+	config := ZoneConfigFromJson("zone.com.", `{"views":[
+		{"name":"office", "sources":["10.0.0.0/8", "2001:db8::1"]},
+		{"name":"partner", "client_subnets":["192.0.2.0/24"]},
+		{"name":"internal", "listeners":["127.0.0.1:5353", ":8053", "::1"]}
+	]}`)
+	listener := func(address string) net.Addr {
+		addr, _ := net.ResolveUDPAddr("udp", address)
+		return addr
+	}
+	public := listener("192.168.1.1:53")
+
+	Expect(config.SelectView(net.ParseIP("10.1.2.3"), nil, public)).To(Equal("office"))
+	Expect(config.SelectView(net.ParseIP("2001:db8::1"), nil, public)).To(Equal("office"))
+	Expect(config.SelectView(net.ParseIP("2001:db8::2"), nil, public)).To(Equal(""))
+	// first matching view wins
+	Expect(config.SelectView(net.ParseIP("10.1.2.3"), net.ParseIP("192.0.2.0"), listener("127.0.0.1:5353"))).To(Equal("office"))
+	Expect(config.SelectView(net.ParseIP("172.16.0.1"), net.ParseIP("192.0.2.0"), public)).To(Equal("partner"))
+	// source address is not matched against client subnets
+	Expect(config.SelectView(net.ParseIP("192.0.2.1"), nil, public)).To(Equal(""))
+
+	Expect(config.SelectView(nil, nil, listener("127.0.0.1:5353"))).To(Equal("internal"))
+	Expect(config.SelectView(nil, nil, listener("127.0.0.2:5353"))).To(Equal(""))
+	Expect(config.SelectView(nil, nil, listener("192.168.1.1:8053"))).To(Equal("internal"))
+	Expect(config.SelectView(nil, nil, listener("[::1]:53"))).To(Equal("internal"))
+	Expect(config.SelectView(nil, nil, nil)).To(Equal(""))
+	Expect(config.HasClientSubnets()).To(BeTrue())
+}
+
+func TestNetworksContain(t *testing.T) {
+	RegisterTestingT(t)
+	entries := []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32", "invalid"}
+	Expect(NetworksContain(entries, net.ParseIP("10.1.2.3"))).To(BeTrue())
+	Expect(NetworksContain(entries, net.ParseIP("192.168.1.1"))).To(BeTrue())
+	Expect(NetworksContain(entries, net.ParseIP("::ffff:192.168.1.1"))).To(BeTrue())
+	Expect(NetworksContain(entries, net.ParseIP("192.168.1.2"))).To(BeFalse())
+	Expect(NetworksContain(entries, net.ParseIP("2001:db8::1"))).To(BeTrue())
+	Expect(NetworksContain(nil, net.ParseIP("10.1.2.3"))).To(BeFalse())
+	Expect(NetworksContain(entries, nil)).To(BeFalse())
+
+	_, err := ParseNetwork("invalid")
+	Expect(err).NotTo(BeNil())
+	network, err := ParseNetwork("2001:db8::1")
+	Expect(err).To(BeNil())
+	Expect(network.String()).To(Equal("2001:db8::1/128"))
+}
@@ -61,6 +61,14 @@ func (t Transaction) HSet(key string, hkey string, value string) Transaction {
 	return t
 }
 
+func (t Transaction) HDel(key string, hkey string) Transaction {
+	if t.error != nil {
+		return t
+	}
+	t.error = t.connection.Send("HDEL", t.redis.config.Prefix+key+t.redis.config.Suffix, hkey)
+	return t
+}
+
 func (t Transaction) SAdd(set string, member string) Transaction {
 	if t.error != nil {
 		return t
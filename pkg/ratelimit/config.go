@@ -1,19 +1,56 @@
 package ratelimit
 
+// Config configures a RateLimiter, list entries are addresses, networks in cidr notation or plain keys.
+// addresses are limited per network of given prefix length, lists are also loaded from
+// <list_key>:whitelist and <list_key>:blacklist redis sets when list key is set
 type Config struct {
-	Enable    bool     `json:"enable"`
-	Burst     int      `json:"burst"`
-	Rate      int      `json:"rate"`
-	WhiteList []string `json:"whitelist"`
-	BlackList []string `json:"blacklist"`
+	Enable           bool     `json:"enable"`
+	Burst            int      `json:"burst"`
+	Rate             int      `json:"rate"`
+	WhiteList        []string `json:"whitelist"`
+	BlackList        []string `json:"blacklist"`
+	IPv4PrefixLength int      `json:"ipv4_prefix_length"`
+	IPv6PrefixLength int      `json:"ipv6_prefix_length"`
+	ListKey          string   `json:"list_key"`
 }
 
 func DefaultConfig() Config {
 	return Config{
-		Enable:    false,
-		Rate:      60,
-		Burst:     10,
-		BlackList: []string{},
-		WhiteList: []string{},
+		Enable:           false,
+		Rate:             60,
+		Burst:            10,
+		BlackList:        []string{},
+		WhiteList:        []string{},
+		IPv4PrefixLength: 32,
+		IPv6PrefixLength: 128,
+		ListKey:          "",
+	}
+}
+
+// ResponseRateLimitConfig configures response rate limiting, rates are responses per second for each
+// client prefix and a rate of 0 disables limiting for that response class
+type ResponseRateLimitConfig struct {
+	Enable             bool `json:"enable"`
+	LogOnly            bool `json:"log_only"`
+	ResponsesPerSecond int  `json:"responses_per_second"`
+	NxdomainsPerSecond int  `json:"nxdomains_per_second"`
+	ErrorsPerSecond    int  `json:"errors_per_second"`
+	Window             int  `json:"window"`
+	Slip               int  `json:"slip"`
+	IPv4PrefixLength   int  `json:"ipv4_prefix_length"`
+	IPv6PrefixLength   int  `json:"ipv6_prefix_length"`
+}
+
+func DefaultResponseRateLimitConfig() ResponseRateLimitConfig {
+	return ResponseRateLimitConfig{
+		Enable:             false,
+		LogOnly:            false,
+		ResponsesPerSecond: 5,
+		NxdomainsPerSecond: 5,
+		ErrorsPerSecond:    5,
+		Window:             15,
+		Slip:               2,
+		IPv4PrefixLength:   24,
+		IPv6PrefixLength:   56,
 	}
 }
@@ -1,19 +1,31 @@
 package ratelimit
 
 import (
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+	"z42-core/pkg/hiredis"
 )
 
 type RateLimiter struct {
-	Limiters  *cache.Cache
-	MaxTime   time.Duration
-	TimeStep  time.Duration
-	Config    *Config
-	WhiteList map[string]interface{}
-	BlackList map[string]interface{}
+	Limiters *cache.Cache
+	MaxTime  time.Duration
+	TimeStep time.Duration
+	Config   *Config
+	ipv4     net.IPMask
+	ipv6     net.IPMask
+	lists    atomic.Pointer[accessLists]
+	quit     chan struct{}
+	quitWG   sync.WaitGroup
+}
+
+type accessLists struct {
+	whiteList *accessList
+	blackList *accessList
 }
 
 func NewRateLimiter(config *Config) *RateLimiter {
@@ -21,19 +33,94 @@ func NewRateLimiter(config *Config) *RateLimiter {
 		Config: config,
 	}
 	rl.Limiters = cache.New(time.Minute, time.Minute*10)
-	rl.WhiteList = make(map[string]interface{})
-	for _, x := range config.WhiteList {
-		rl.WhiteList[x] = nil
+	ipv4, ipv6 := config.IPv4PrefixLength, config.IPv6PrefixLength
+	if ipv4 < 1 || ipv4 > 8*net.IPv4len {
+		ipv4 = 8 * net.IPv4len
+	}
+	if ipv6 < 1 || ipv6 > 8*net.IPv6len {
+		ipv6 = 8 * net.IPv6len
 	}
-	rl.BlackList = make(map[string]interface{})
-	for _, x := range config.BlackList {
-		rl.BlackList[x] = nil
+	rl.ipv4 = net.CIDRMask(ipv4, 8*net.IPv4len)
+	rl.ipv6 = net.CIDRMask(ipv6, 8*net.IPv6len)
+	rl.UpdateLists(nil, nil)
+	rate := config.Rate
+	if rate < 1 {
+		rate = DefaultConfig().Rate
 	}
-	rl.TimeStep = time.Duration(60000/config.Rate) * time.Millisecond
+	rl.TimeStep = time.Duration(60000/rate) * time.Millisecond
 	rl.MaxTime = rl.TimeStep * time.Duration(config.Burst)
 	return rl
 }
 
+// UpdateLists replaces runtime white and black lists, entries from config are always kept
+func (rl *RateLimiter) UpdateLists(whiteList []string, blackList []string) {
+	rl.lists.Store(&accessLists{
+		whiteList: newAccessList(rl.Config.WhiteList, whiteList),
+		blackList: newAccessList(rl.Config.BlackList, blackList),
+	})
+}
+
+// WatchLists loads white and black lists from redis and reloads them whenever they change
+func (rl *RateLimiter) WatchLists(redis *hiredis.Redis) {
+	if !rl.Config.Enable || rl.Config.ListKey == "" {
+		return
+	}
+	rl.quit = make(chan struct{})
+	rl.loadLists(redis)
+	rl.quitWG.Add(1)
+	go func() {
+		quit := make(chan *sync.WaitGroup, 1)
+		go redis.SubscribeEvent(rl.Config.ListKey+":*",
+			func() {
+				// lists may have changed while we were not subscribed
+				rl.loadLists(redis)
+			},
+			func(channel string, data string) {
+				rl.loadLists(redis)
+			},
+			func(err error) {
+				zap.L().Error("subscribe error", zap.Error(err))
+			},
+			quit)
+
+		<-rl.quit
+		quit <- &rl.quitWG
+	}()
+}
+
+func (rl *RateLimiter) ShutDown() {
+	if rl.quit == nil {
+		return
+	}
+	close(rl.quit)
+	rl.quitWG.Wait()
+}
+
+func (rl *RateLimiter) loadLists(redis *hiredis.Redis) {
+	whiteList, err := redis.SMembers(rl.Config.ListKey + ":whitelist")
+	if err != nil {
+		zap.L().Error("cannot load whitelist", zap.Error(err))
+		return
+	}
+	blackList, err := redis.SMembers(rl.Config.ListKey + ":blacklist")
+	if err != nil {
+		zap.L().Error("cannot load blacklist", zap.Error(err))
+		return
+	}
+	rl.UpdateLists(whiteList, blackList)
+}
+
+// bucket returns key of limiter to charge, addresses are aggregated to their network
+func (rl *RateLimiter) bucket(key string, ip net.IP) string {
+	if ip == nil {
+		return key
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(rl.ipv4).String()
+	}
+	return ip.Mask(rl.ipv6).String()
+}
+
 type Limiter struct {
 	Size       time.Duration
 	LastUpdate time.Time
@@ -45,12 +132,15 @@ func (rl *RateLimiter) CanHandle(key string) bool {
 		return true
 	}
 
-	if _, exist := rl.BlackList[key]; exist {
+	ip := net.ParseIP(key)
+	lists := rl.lists.Load()
+	if lists.blackList.contains(key, ip) {
 		return false
 	}
-	if _, exist := rl.WhiteList[key]; exist {
+	if lists.whiteList.contains(key, ip) {
 		return true
 	}
+	key = rl.bucket(key, ip)
 	var (
 		res bool
 		l   *Limiter
@@ -62,3 +62,44 @@ func TestLimiter(t *testing.T) {
 	}
 	fmt.Println("fail : ", fail, " success : ", success)
 }
+
+func TestLimiterNetworks(t *testing.T) {
+	RegisterTestingT(t)
+	cfg := DefaultConfig()
+	cfg.Enable = true
+	cfg.Rate = 60
+	cfg.Burst = 2
+	cfg.IPv4PrefixLength = 24
+	cfg.IPv6PrefixLength = 48
+	cfg.WhiteList = []string{"10.10.10.0/24", "2001:db8:1::/48", "w1"}
+	cfg.BlackList = []string{"10.10.10.10", "2001:db8:2::/48", "b1"}
+	rl := NewRateLimiter(&cfg)
+
+	for i := 0; i < 100; i++ {
+		Expect(rl.CanHandle("10.10.10.1")).To(BeTrue())
+		Expect(rl.CanHandle("2001:db8:1:ffff::1")).To(BeTrue())
+		Expect(rl.CanHandle("w1")).To(BeTrue())
+	}
+	// black list wins over a white listed network
+	Expect(rl.CanHandle("10.10.10.10")).To(BeFalse())
+	Expect(rl.CanHandle("2001:db8:2::53")).To(BeFalse())
+	Expect(rl.CanHandle("b1")).To(BeFalse())
+	Expect(rl.CanHandle("2001:db8:3::53")).To(BeTrue())
+
+	// addresses in same network share a limiter
+	Expect(rl.CanHandle("192.168.1.1")).To(BeTrue())
+	Expect(rl.CanHandle("192.168.1.2")).To(BeTrue())
+	Expect(rl.CanHandle("192.168.1.3")).To(BeTrue())
+	Expect(rl.CanHandle("192.168.1.4")).To(BeFalse())
+	Expect(rl.CanHandle("192.168.2.1")).To(BeTrue())
+
+	// runtime lists are added to configured ones
+	rl.UpdateLists([]string{"192.168.1.0/24"}, []string{"192.168.3.0/24", "b2"})
+	Expect(rl.CanHandle("192.168.1.4")).To(BeTrue())
+	Expect(rl.CanHandle("192.168.3.1")).To(BeFalse())
+	Expect(rl.CanHandle("b2")).To(BeFalse())
+	Expect(rl.CanHandle("10.10.10.10")).To(BeFalse())
+	rl.UpdateLists(nil, nil)
+	Expect(rl.CanHandle("192.168.3.1")).To(BeTrue())
+	Expect(rl.CanHandle("b2")).To(BeTrue())
+}
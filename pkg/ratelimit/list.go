@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"net"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// accessList matches addresses against networks kept in a radix tree, tree keys are network bits
+// of ipv4 mapped addresses so a lookup is a longest prefix match. entries that are not addresses
+// are matched exactly against keys like user ids
+type accessList struct {
+	networks *iradix.Tree
+	keys     map[string]struct{}
+}
+
+func newAccessList(entries ...[]string) *accessList {
+	l := &accessList{
+		keys: make(map[string]struct{}),
+	}
+	txn := iradix.New().Txn()
+	for _, list := range entries {
+		for _, entry := range list {
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				ones, bits := network.Mask.Size()
+				if bits == 8*net.IPv4len {
+					ones += 8 * (net.IPv6len - net.IPv4len)
+				}
+				txn.Insert(prefixKey(network.IP, ones), network)
+			} else if ip := net.ParseIP(entry); ip != nil {
+				txn.Insert(prefixKey(ip, 8*net.IPv6len), ip)
+			} else {
+				l.keys[entry] = struct{}{}
+			}
+		}
+	}
+	l.networks = txn.Commit()
+	return l
+}
+
+func (l *accessList) contains(key string, ip net.IP) bool {
+	if ip == nil {
+		_, found := l.keys[key]
+		return found
+	}
+	_, _, found := l.networks.Root().LongestPrefix(prefixKey(ip, 8*net.IPv6len))
+	return found
+}
+
+// prefixKey returns first ones bits of ip as a byte per bit
+func prefixKey(ip net.IP, ones int) []byte {
+	ip = ip.To16()
+	key := make([]byte, ones)
+	for i := range key {
+		key[i] = (ip[i/8] >> (7 - i%8)) & 1
+	}
+	return key
+}
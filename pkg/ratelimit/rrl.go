@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+)
+
+// ResponseClass groups responses that share a rate limit bucket
+type ResponseClass int
+
+const (
+	ResponseAnswer ResponseClass = iota
+	ResponseNxDomain
+	ResponseError
+)
+
+func (c ResponseClass) String() string {
+	switch c {
+	case ResponseAnswer:
+		return "answer"
+	case ResponseNxDomain:
+		return "nxdomain"
+	default:
+		return "error"
+	}
+}
+
+// ResponseAction tells what to do with a response
+type ResponseAction int
+
+const (
+	ResponseSend ResponseAction = iota
+	ResponseSlip
+	ResponseDrop
+)
+
+func (a ResponseAction) String() string {
+	switch a {
+	case ResponseSend:
+		return "send"
+	case ResponseSlip:
+		return "slip"
+	default:
+		return "drop"
+	}
+}
+
+// ResponseRateLimitStats holds counters of a ResponseRateLimiter, in log only mode limited responses
+// are counted as if they were slipped or dropped
+type ResponseRateLimitStats struct {
+	Responses uint64 `json:"responses"`
+	Limited   uint64 `json:"limited"`
+	Slipped   uint64 `json:"slipped"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// ResponseRateLimiter limits identical responses sent to a client network, spoofed sources all share
+// the bucket of their victim so reflected traffic is limited regardless of number of sources
+type ResponseRateLimiter struct {
+	Config  *ResponseRateLimitConfig
+	buckets *cache.Cache
+	window  time.Duration
+	ipv4    net.IPMask
+	ipv6    net.IPMask
+
+	responses atomic.Uint64
+	limited   atomic.Uint64
+	slipped   atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type responseBucket struct {
+	mutex      sync.Mutex
+	balance    float64
+	lastUpdate time.Time
+	limited    int
+}
+
+func NewResponseRateLimiter(config *ResponseRateLimitConfig) *ResponseRateLimiter {
+	defaults := DefaultResponseRateLimitConfig()
+	window, ipv4, ipv6 := config.Window, config.IPv4PrefixLength, config.IPv6PrefixLength
+	if window < 1 {
+		window = defaults.Window
+	}
+	if ipv4 < 1 || ipv4 > 8*net.IPv4len {
+		ipv4 = defaults.IPv4PrefixLength
+	}
+	if ipv6 < 1 || ipv6 > 8*net.IPv6len {
+		ipv6 = defaults.IPv6PrefixLength
+	}
+	rrl := &ResponseRateLimiter{
+		Config: config,
+		window: time.Duration(window) * time.Second,
+		ipv4:   net.CIDRMask(ipv4, 8*net.IPv4len),
+		ipv6:   net.CIDRMask(ipv6, 8*net.IPv6len),
+	}
+	rrl.buckets = cache.New(rrl.window, 2*rrl.window)
+	return rrl
+}
+
+// Check accounts a response to client and returns the action to take, answers are limited per qname and qtype
+// while nxdomain and errors are limited per zone since attackers can make up any number of names
+func (rrl *ResponseRateLimiter) Check(client net.IP, qname string, qtype uint16, zone string, class ResponseClass) ResponseAction {
+	if !rrl.Config.Enable {
+		return ResponseSend
+	}
+	rate := rrl.rate(class)
+	if rate == 0 {
+		return ResponseSend
+	}
+	rrl.responses.Add(1)
+
+	key := rrl.key(client, qname, qtype, zone, class)
+	action := rrl.account(key, float64(rate))
+	switch action {
+	case ResponseSend:
+		return ResponseSend
+	case ResponseSlip:
+		rrl.slipped.Add(1)
+	case ResponseDrop:
+		rrl.dropped.Add(1)
+	}
+	rrl.limited.Add(1)
+	if rrl.Config.LogOnly {
+		zap.L().Info("response rate limit exceeded",
+			zap.String("key", key),
+			zap.String("action", action.String()),
+		)
+		return ResponseSend
+	}
+	return action
+}
+
+func (rrl *ResponseRateLimiter) Stats() ResponseRateLimitStats {
+	return ResponseRateLimitStats{
+		Responses: rrl.responses.Load(),
+		Limited:   rrl.limited.Load(),
+		Slipped:   rrl.slipped.Load(),
+		Dropped:   rrl.dropped.Load(),
+	}
+}
+
+func (rrl *ResponseRateLimiter) rate(class ResponseClass) int {
+	switch class {
+	case ResponseAnswer:
+		return rrl.Config.ResponsesPerSecond
+	case ResponseNxDomain:
+		return rrl.Config.NxdomainsPerSecond
+	default:
+		return rrl.Config.ErrorsPerSecond
+	}
+}
+
+func (rrl *ResponseRateLimiter) key(client net.IP, qname string, qtype uint16, zone string, class ResponseClass) string {
+	var prefix string
+	if ip := client.To4(); ip != nil {
+		prefix = ip.Mask(rrl.ipv4).String()
+	} else if client != nil {
+		prefix = client.Mask(rrl.ipv6).String()
+	}
+	name := strings.ToLower(qname) + "/" + strconv.Itoa(int(qtype))
+	if class != ResponseAnswer && zone != "" {
+		name = strings.ToLower(zone)
+	}
+	return prefix + "/" + class.String() + "/" + name
+}
+
+// account charges one response to bucket, bucket earns rate credits per second up to rate and
+// goes down to -rate*window so a client has to stay quiet for a while before it is answered again
+func (rrl *ResponseRateLimiter) account(key string, rate float64) ResponseAction {
+	now := time.Now()
+	var b *responseBucket
+	if value, found := rrl.buckets.Get(key); found {
+		b = value.(*responseBucket)
+	} else {
+		b = &responseBucket{balance: rate, lastUpdate: now}
+		if err := rrl.buckets.Add(key, b, cache.DefaultExpiration); err != nil {
+			if value, found := rrl.buckets.Get(key); found {
+				b = value.(*responseBucket)
+			}
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.balance += now.Sub(b.lastUpdate).Seconds() * rate
+	b.lastUpdate = now
+	if b.balance > rate {
+		b.balance = rate
+	}
+	b.balance--
+	if min := -rate * rrl.window.Seconds(); b.balance < min {
+		b.balance = min
+	}
+	rrl.buckets.SetDefault(key, b)
+
+	if b.balance >= 0 {
+		b.limited = 0
+		return ResponseSend
+	}
+	b.limited++
+	if rrl.Config.Slip > 0 && b.limited%rrl.Config.Slip == 0 {
+		return ResponseSlip
+	}
+	return ResponseDrop
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+func TestResponseRateLimiter(t *testing.T) {
+	RegisterTestingT(t)
+	cfg := DefaultResponseRateLimitConfig()
+	cfg.Enable = true
+	cfg.ResponsesPerSecond = 5
+	cfg.Slip = 2
+	rrl := NewResponseRateLimiter(&cfg)
+
+	client := net.ParseIP("10.1.2.3")
+	var actions []ResponseAction
+	for i := 0; i < 10; i++ {
+		actions = append(actions, rrl.Check(client, "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer))
+	}
+	Expect(actions).To(Equal([]ResponseAction{
+		ResponseSend, ResponseSend, ResponseSend, ResponseSend, ResponseSend,
+		ResponseDrop, ResponseSlip, ResponseDrop, ResponseSlip, ResponseDrop,
+	}))
+
+	// clients in same /24 share the bucket
+	Expect(rrl.Check(net.ParseIP("10.1.2.200"), "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).NotTo(Equal(ResponseSend))
+	Expect(rrl.Check(net.ParseIP("10.1.3.1"), "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+	// other qtypes and classes have their own buckets
+	Expect(rrl.Check(client, "www.example.com.", dns.TypeAAAA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+	Expect(rrl.Check(client, "www.example.com.", dns.TypeA, "example.com.", ResponseError)).To(Equal(ResponseSend))
+
+	// nxdomain responses are limited per zone regardless of qname
+	for i := 0; i < 5; i++ {
+		Expect(rrl.Check(client, dns.Fqdn(string(rune('a'+i))+".example.com"), dns.TypeA, "example.com.", ResponseNxDomain)).To(Equal(ResponseSend))
+	}
+	Expect(rrl.Check(client, "z.example.com.", dns.TypeA, "example.com.", ResponseNxDomain)).To(Equal(ResponseDrop))
+
+	// ipv6 clients are grouped by /56
+	client6 := net.ParseIP("2001:db8:0:1::1")
+	for i := 0; i < 5; i++ {
+		Expect(rrl.Check(client6, "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+	}
+	Expect(rrl.Check(net.ParseIP("2001:db8:0:ff::1"), "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseDrop))
+	Expect(rrl.Check(net.ParseIP("2001:db8:0:100::1"), "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+
+	stats := rrl.Stats()
+	Expect(stats.Responses).To(Equal(uint64(27)))
+	Expect(stats.Limited).To(Equal(uint64(8)))
+	Expect(stats.Slipped).To(Equal(uint64(3)))
+	Expect(stats.Dropped).To(Equal(uint64(5)))
+
+	// log only mode counts limited responses but sends them
+	cfg.LogOnly = true
+	for i := 0; i < 10; i++ {
+		Expect(rrl.Check(client, "log.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+	}
+	Expect(rrl.Stats().Limited).To(Equal(uint64(13)))
+
+	// zero rate disables limiting for a class
+	cfg.LogOnly = false
+	cfg.ErrorsPerSecond = 0
+	for i := 0; i < 20; i++ {
+		Expect(rrl.Check(client, "www.example.com.", dns.TypeA, "example.com.", ResponseError)).To(Equal(ResponseSend))
+	}
+
+	cfg.Enable = false
+	Expect(rrl.Check(client, "www.example.com.", dns.TypeA, "example.com.", ResponseAnswer)).To(Equal(ResponseSend))
+}
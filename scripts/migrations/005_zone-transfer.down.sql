@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` DROP COLUMN `AllowTransfer`;
+
+COMMIT ;
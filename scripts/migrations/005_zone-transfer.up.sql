@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `AllowTransfer` JSON NULL DEFAULT NULL AFTER `Enabled`;
+
+COMMIT ;
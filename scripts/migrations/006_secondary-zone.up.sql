@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `Primaries` JSON NULL DEFAULT NULL AFTER `AllowTransfer`;
+
+COMMIT ;
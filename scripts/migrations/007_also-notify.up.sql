@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `AlsoNotify` JSON NULL DEFAULT NULL AFTER `Primaries`;
+
+COMMIT ;
@@ -0,0 +1,9 @@
+START TRANSACTION ;
+
+DELETE FROM `z42`.`Events` WHERE `Type` IN ('add_tsig_key', 'update_tsig_key', 'delete_tsig_key');
+
+ALTER TABLE `z42`.`Events` MODIFY COLUMN `Type` ENUM('add_zone', 'update_zone', 'delete_zone', 'import_zone', 'add_location', 'update_location', 'delete_location', 'add_record', 'update_record', 'delete_record') NOT NULL;
+
+DROP TABLE IF EXISTS `z42`.`TSIGKeys`;
+
+COMMIT ;
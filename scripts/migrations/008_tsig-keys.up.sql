@@ -0,0 +1,27 @@
+START TRANSACTION ;
+
+CREATE TABLE IF NOT EXISTS `z42`.`TSIGKeys` (
+                                                `Name` VARCHAR(256) NOT NULL,
+                                                `Algorithm` VARCHAR(32) NOT NULL,
+                                                `Secret` VARCHAR(256) NOT NULL,
+                                                `Enabled` TINYINT NOT NULL,
+                                                `User_Id` CHAR(36) NOT NULL,
+                                                `Zone_Id` CHAR(36) NOT NULL,
+                                                INDEX `fk_TSIGKeys_User_idx` (`User_Id` ASC) VISIBLE,
+                                                INDEX `fk_TSIGKeys_Zone_idx` (`Zone_Id` ASC) VISIBLE,
+                                                UNIQUE INDEX `Name_UNIQUE` (`Name` ASC) VISIBLE,
+                                                CONSTRAINT `fk_TSIGKeys_User`
+                                                    FOREIGN KEY (`User_Id`)
+                                                        REFERENCES `z42`.`User` (`Id`)
+                                                        ON DELETE CASCADE
+                                                        ON UPDATE NO ACTION,
+                                                CONSTRAINT `fk_TSIGKeys_Zone`
+                                                    FOREIGN KEY (`Zone_Id`)
+                                                        REFERENCES `z42`.`Zone` (`Resource_Id`)
+                                                        ON DELETE CASCADE
+                                                        ON UPDATE NO ACTION)
+    ENGINE = InnoDB;
+
+ALTER TABLE `z42`.`Events` MODIFY COLUMN `Type` ENUM('add_zone', 'update_zone', 'delete_zone', 'import_zone', 'add_location', 'update_location', 'delete_location', 'add_record', 'update_record', 'delete_record', 'add_tsig_key', 'update_tsig_key', 'delete_tsig_key') NOT NULL;
+
+COMMIT ;
@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `NSEC3` JSON NULL DEFAULT NULL AFTER `AlsoNotify`;
+
+COMMIT ;
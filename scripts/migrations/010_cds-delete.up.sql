@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `CDSDelete` TINYINT NOT NULL DEFAULT 0 AFTER `NSEC3`;
+
+COMMIT ;
@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `KeyAlgorithm` JSON NULL DEFAULT NULL AFTER `CDSDelete`;
+
+COMMIT ;
@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`Zone` ADD COLUMN `IgnoreClientSubnet` TINYINT NOT NULL DEFAULT 0 AFTER `Signature`;
+
+COMMIT ;
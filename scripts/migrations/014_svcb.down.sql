@@ -0,0 +1,6 @@
+START TRANSACTION ;
+
+DELETE FROM `z42`.`Resource` WHERE `Id` IN (SELECT `Resource_Id` FROM `z42`.`RecordSet` WHERE `Type` IN ('https', 'svcb'));
+ALTER TABLE `z42`.`RecordSet` MODIFY COLUMN `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cname', 'ds', 'mx', 'ns', 'ptr', 'srv', 'tlsa', 'txt') NOT NULL;
+
+COMMIT ;
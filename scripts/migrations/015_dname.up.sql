@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`RecordSet` MODIFY COLUMN `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cname', 'dname', 'ds', 'https', 'mx', 'ns', 'ptr', 'srv', 'svcb', 'tlsa', 'txt') NOT NULL;
+
+COMMIT ;
@@ -0,0 +1,6 @@
+START TRANSACTION ;
+
+DELETE FROM `z42`.`Resource` WHERE `Id` IN (SELECT `Resource_Id` FROM `z42`.`RecordSet` WHERE `Type` IN ('cert', 'hinfo', 'loc', 'naptr', 'openpgpkey', 'sshfp', 'uri'));
+ALTER TABLE `z42`.`RecordSet` MODIFY COLUMN `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cname', 'dname', 'ds', 'https', 'mx', 'ns', 'ptr', 'srv', 'svcb', 'tlsa', 'txt') NOT NULL;
+
+COMMIT ;
@@ -0,0 +1,5 @@
+START TRANSACTION ;
+
+ALTER TABLE `z42`.`RecordSet` MODIFY COLUMN `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cert', 'cname', 'dname', 'ds', 'hinfo', 'https', 'loc', 'mx', 'naptr', 'ns', 'openpgpkey', 'ptr', 'srv', 'sshfp', 'svcb', 'tlsa', 'txt', 'uri') NOT NULL;
+
+COMMIT ;
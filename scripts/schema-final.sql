@@ -57,6 +57,15 @@ CREATE TABLE IF NOT EXISTS `z42`.`Zone` (
                                             `CNameFlattening` TINYINT NOT NULL,
                                             `Dnssec` TINYINT NOT NULL,
                                             `Enabled` TINYINT NOT NULL,
+                                            `AllowTransfer` JSON NULL DEFAULT NULL,
+                                            `Primaries` JSON NULL DEFAULT NULL,
+                                            `AlsoNotify` JSON NULL DEFAULT NULL,
+                                            `NSEC3` JSON NULL DEFAULT NULL,
+                                            `CDSDelete` TINYINT NOT NULL DEFAULT 0,
+                                            `KeyAlgorithm` JSON NULL DEFAULT NULL,
+                                            `Signature` JSON NULL DEFAULT NULL,
+                                            `IgnoreClientSubnet` TINYINT NOT NULL DEFAULT 0,
+                                            `Views` JSON NULL DEFAULT NULL,
                                             `Resource_Id` CHAR(36) NOT NULL,
                                             UNIQUE INDEX `Name_UNIQUE` (`Name` ASC) VISIBLE,
                                             PRIMARY KEY (`Resource_Id`),
@@ -100,7 +109,7 @@ CREATE TABLE IF NOT EXISTS `z42`.`Location` (
 DROP TABLE IF EXISTS `z42`.`RecordSet` ;
 
 CREATE TABLE IF NOT EXISTS `z42`.`RecordSet` (
-                                                 `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cname', 'ds', 'mx', 'ns', 'ptr', 'srv', 'tlsa', 'txt') NOT NULL,
+                                                 `Type` ENUM('a', 'aaaa', 'aname', 'caa', 'cert', 'cname', 'dname', 'ds', 'hinfo', 'https', 'loc', 'mx', 'naptr', 'ns', 'openpgpkey', 'ptr', 'srv', 'sshfp', 'svcb', 'tlsa', 'txt', 'uri') NOT NULL,
                                                  `Value` JSON NULL DEFAULT NULL,
                                                  `Enabled` TINYINT NOT NULL,
                                                  `Resource_Id` CHAR(36) NOT NULL,
@@ -149,7 +158,7 @@ DROP TABLE IF EXISTS `z42`.`Events` ;
 CREATE TABLE IF NOT EXISTS `z42`.`Events` (
                                               `Revision` INT NOT NULL AUTO_INCREMENT,
                                               `ZoneId` CHAR(36) NOT NULL,
-                                              `Type` ENUM('add_zone', 'update_zone', 'delete_zone', 'import_zone', 'add_location', 'update_location', 'delete_location', 'add_record', 'update_record', 'delete_record') NOT NULL,
+                                              `Type` ENUM('add_zone', 'update_zone', 'delete_zone', 'import_zone', 'add_location', 'update_location', 'delete_location', 'add_record', 'update_record', 'delete_record', 'add_tsig_key', 'update_tsig_key', 'delete_tsig_key') NOT NULL,
                                               `Value` JSON NULL DEFAULT NULL,
                                               PRIMARY KEY (`Revision`),
                                               INDEX `zone_id` (`ZoneId` ASC) VISIBLE)
@@ -230,6 +239,34 @@ CREATE TABLE IF NOT EXISTS `z42`.`APIKeys` (
     ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `z42`.`TSIGKeys`
+-- -----------------------------------------------------
+DROP TABLE IF EXISTS `z42`.`TSIGKeys` ;
+
+CREATE TABLE IF NOT EXISTS `z42`.`TSIGKeys` (
+                                                `Name` VARCHAR(256) NOT NULL,
+                                                `Algorithm` VARCHAR(32) NOT NULL,
+                                                `Secret` VARCHAR(256) NOT NULL,
+                                                `Enabled` TINYINT NOT NULL,
+                                                `User_Id` CHAR(36) NOT NULL,
+                                                `Zone_Id` CHAR(36) NOT NULL,
+                                                INDEX `fk_TSIGKeys_User_idx` (`User_Id` ASC) VISIBLE,
+                                                INDEX `fk_TSIGKeys_Zone_idx` (`Zone_Id` ASC) VISIBLE,
+                                                UNIQUE INDEX `Name_UNIQUE` (`Name` ASC) VISIBLE,
+                                                CONSTRAINT `fk_TSIGKeys_User`
+                                                    FOREIGN KEY (`User_Id`)
+                                                        REFERENCES `z42`.`User` (`Id`)
+                                                        ON DELETE CASCADE
+                                                        ON UPDATE NO ACTION,
+                                                CONSTRAINT `fk_TSIGKeys_Zone`
+                                                    FOREIGN KEY (`Zone_Id`)
+                                                        REFERENCES `z42`.`Zone` (`Resource_Id`)
+                                                        ON DELETE CASCADE
+                                                        ON UPDATE NO ACTION)
+    ENGINE = InnoDB;
+
+
 -- -----------------------------------------------------
 -- Table `z42`.`UserZone`
 -- -----------------------------------------------------
@@ -59,6 +59,7 @@ func main() {
 		ZoneReload:         1,
 		RecordCacheSize:    1000000,
 		RecordCacheTimeout: 60,
+		SignatureCacheSize: 100000,
 		MinTTL:             5,
 		MaxTTL:             300,
 		Redis: hiredis.Config{
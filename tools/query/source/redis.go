@@ -19,6 +19,7 @@ func NewRedisDumpQueryGenerator(redisAddress string) *RedisDumpQueryGenerator {
 		ZoneReload:         1,
 		RecordCacheSize:    1000000,
 		RecordCacheTimeout: 60,
+		SignatureCacheSize: 100000,
 		MinTTL:             5,
 		MaxTTL:             300,
 		Redis: hiredis.Config{